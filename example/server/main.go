@@ -10,6 +10,10 @@ import (
 	"google.golang.org/grpc"
 
 	"go.amplifyedge.org/sys-v2/main/pkg"
+	service "go.amplifyedge.org/sys-v2/sys-account/service/go"
+	accountpkg "go.amplifyedge.org/sys-v2/sys-account/service/go/pkg"
+	"go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+	"go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/dbadmin"
 )
 
 const (
@@ -86,6 +90,30 @@ func main() {
 		// run server
 		return sysSvc.Run(fmt.Sprintf("%s:%d", "127.0.0.1", mainexPort), grpcWebServer, nil, localTlsCertPath, localTlsKeyPath)
 	}
+	// offline database administration, the server must be stopped
+	rootCmd.AddCommand(dbadmin.NewDbAdminCommand(func() (*coredb.AllDBService, error) {
+		accountCfg, err := service.NewConfig(accountCfgPath)
+		if err != nil {
+			return nil, err
+		}
+		// the scheduled jobs only run when asked
+		accountCfg.DbOptions.Cron.Disabled = true
+		accountCfg.FileDbOptions.Cron.Disabled = true
+		accountSvcCfg, err := accountpkg.NewSysAccountServiceConfig(logger, "", corebus.NewCoreBus(), accountCfg)
+		if err != nil {
+			return nil, err
+		}
+		sspaths := pkg.NewServiceConfigPaths("", accountSvcCfg)
+		sscfg, err := pkg.NewSysServiceConfig(logger, nil, sspaths, defaultPort, corebus.NewCoreBus())
+		if err != nil {
+			return nil, err
+		}
+		sysSvc, err := pkg.NewService(sscfg, "127.0.0.1")
+		if err != nil {
+			return nil, err
+		}
+		return sysSvc.SysAccountSvc.AllDBs, nil
+	}))
 	if err := rootCmd.Execute(); err != nil {
 		logger.Fatalf("error running sys-main: %v", err)
 	}
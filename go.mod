@@ -1,6 +1,6 @@
 module go.amplifyedge.org/sys-v2
 
-go 1.16
+go 1.18
 
 replace go.amplifyedge.org/sys-share-v2 => ../sys-share/
 
@@ -13,9 +13,14 @@ require (
 	github.com/genjidb/genji v0.10.1
 	github.com/genjidb/genji/engine/badgerengine v0.10.0
 	github.com/go-playground/validator v9.31.0+incompatible
+	github.com/google/btree v1.0.0
 	github.com/grpc-ecosystem/go-grpc-middleware v1.2.2
 	github.com/improbable-eng/grpc-web v0.14.0
+	github.com/klauspost/compress v1.10.10
+	github.com/lib/pq v1.10.9
 	github.com/matcornic/hermes/v2 v2.1.0
+	github.com/mattn/go-sqlite3 v1.14.16
+	github.com/minio/minio-go/v7 v7.0.10
 	github.com/robfig/cron/v3 v3.0.1
 	github.com/rs/cors v1.7.0 // indirect
 	github.com/segmentio/encoding v0.2.7
@@ -26,6 +31,7 @@ require (
 	go.amplifyedge.org/sys-share-v2 v0.0.0-00010101000000-000000000000
 	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
 	golang.org/x/net v0.0.0-20210119194325-5f4716e94777
+	golang.org/x/sys v0.0.0-20201119102817-f84b799fce68
 	google.golang.org/grpc v1.35.0
 	google.golang.org/grpc/examples v0.0.0-20210205041354-b753f4903c1b // indirect
 	google.golang.org/protobuf v1.25.0
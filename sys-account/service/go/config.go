@@ -7,11 +7,14 @@ import (
 
 	commonCfg "go.amplifyedge.org/sys-share-v2/sys-core/service/config/common"
 	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go"
+	"go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
 )
 
 const (
 	errParsingConfig           = "error parsing %s config: %v\n"
 	errNoUnauthenticatedRoutes = "error: no unauthenticated routes defined"
+	errSharedDbOption          = "error: the accounts and files databases have the same %s"
+	defaultGracePeriod         = 30
 )
 
 type SysAccountConfig struct {
@@ -21,6 +24,25 @@ type SysAccountConfig struct {
 	SysCoreConfig         commonCfg.Config   `yaml:"sysCoreConfig" mapstructure:"sysCoreConfig"`
 	SysFileConfig         commonCfg.Config   `yaml:"sysFileConfig" mapstructure:"sysFileConfig"`
 	MailConfig            coresvc.MailConfig `yaml:"mailConfig" mapstructure:"mailConfig"`
+	DbOptions             coredb.Options     `yaml:"dbOptions,omitempty" mapstructure:"dbOptions"`
+	FileDbOptions         coredb.Options     `yaml:"fileDbOptions,omitempty" mapstructure:"fileDbOptions"`
+	SoftDelete            SoftDeleteConfig   `json:"softDelete" yaml:"softDelete,omitempty" mapstructure:"softDelete"`
+}
+
+// SoftDeleteConfig schedules the purge of the deleted accounts, orgs and projects.
+type SoftDeleteConfig struct {
+	// PurgeSchedule is a cron spec, deleted rows are kept until purged by hand when empty.
+	PurgeSchedule string `json:"purgeSchedule" yaml:"purgeSchedule" mapstructure:"purgeSchedule"`
+	// GracePeriod is the number of days deleted rows can still be restored, defaults to 30.
+	GracePeriod int `json:"gracePeriod" yaml:"gracePeriod" mapstructure:"gracePeriod"`
+}
+
+// GracePeriodSeconds returns the grace period with its default applied.
+func (s SoftDeleteConfig) GracePeriodSeconds() int64 {
+	if s.GracePeriod <= 0 {
+		return defaultGracePeriod * 24 * 60 * 60
+	}
+	return int64(s.GracePeriod) * 24 * 60 * 60
 }
 
 func (c SysAccountConfig) Validate() error {
@@ -39,6 +61,22 @@ func (c SysAccountConfig) Validate() error {
 	if err := c.SysFileConfig.Validate(); err != nil {
 		return err
 	}
+	return validateDbOptions(c.DbOptions, c.FileDbOptions)
+}
+
+// validateDbOptions checks DbOptions, the options of the accounts database, against FileDbOptions,
+// those of the files database. They may not take the same cron lock or keep their backups below
+// the same S3 prefix, the defaults are derived from the database names.
+func validateDbOptions(accounts, files coredb.Options) error {
+	if accounts.Cron.LockFile != "" && accounts.Cron.LockFile == files.Cron.LockFile {
+		return fmt.Errorf(errSharedDbOption, "cron lock file")
+	}
+	if accounts.Target.Type == coredb.BackupTargetS3 && files.Target.Type == coredb.BackupTargetS3 {
+		a, f := accounts.Target.S3, files.Target.S3
+		if a.Endpoint == f.Endpoint && a.Bucket == f.Bucket && a.Prefix == f.Prefix {
+			return fmt.Errorf(errSharedDbOption, "backup target prefix")
+		}
+	}
 	return nil
 }
 
@@ -1,6 +1,7 @@
 package dao
 
 import (
+	"context"
 	"fmt"
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/genjidb/genji/document"
@@ -18,83 +19,60 @@ import (
 )
 
 var (
-	accountsUniqueIdx      = fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS idx_%s_email ON %s(email)", AccTableName, AccTableName)
 	accountAvatarUniqueIdx = fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS idx_%s_avatar_resource_id ON %s(avatar_resource_id)", AccTableName, AccTableName)
 )
 
+const (
+	// loginAttemptTTL is how long the login attempts of an address are remembered after the last one,
+	// a ban running longer keeps them until it ends.
+	loginAttemptTTL = 24 * time.Hour
+	// VerificationTokenTTL is how long a verification token stays valid.
+	VerificationTokenTTL = 24 * time.Hour
+)
+
 type LoginAttempt struct {
 	OriginIP      string `json:"origin_ip" genji:"origin_ip" coredb:"primary"`
 	AccountEmail  string `json:"account_email,omitempty" genji:"account_email"`
 	TotalAttempts uint   `json:"total_attempts" genji:"total_attempts"`
 	BanPeriod     int64  `json:"ban_period" genji:"ban_period"`
+	ExpiresAt     int64  `json:"expires_at" genji:"expires_at" coredb:"expires"`
 }
 
 type Account struct {
-	ID                string `json:"id,omitempty" genji:"id" coredb:"primary"`
-	Email             string `json:"email,omitempty" genji:"email"`
-	Password          string `json:"password,omitempty" genji:"password"`
-	CreatedAt         int64  `json:"created_at" genji:"created_at"`
-	UpdatedAt         int64  `json:"updated_at" genji:"updated_at"`
-	LastLogin         int64  `json:"last_login" genji:"last_login"`
-	Disabled          bool   `json:"disabled" genji:"disabled"`
-	Verified          bool   `json:"verified" genji:"verified"`
-	VerificationToken string `json:"verification_token,omitempty" genji:"verification_token"`
+	ID                string `json:"id,omitempty" genji:"id" coredb:"primary,sortable,filterable"`
+	Email             string `json:"email,omitempty" genji:"email" coredb:"unique,sortable,filterable"`
+	Password          string `json:"password,omitempty" genji:"password" coredb:"hidden"`
+	CreatedAt         int64  `json:"created_at" genji:"created_at" coredb:"sortable,filterable"`
+	UpdatedAt         int64  `json:"updated_at" genji:"updated_at" coredb:"sortable,filterable"`
+	LastLogin         int64  `json:"last_login" genji:"last_login" coredb:"sortable,filterable"`
+	Disabled          bool   `json:"disabled" genji:"disabled" coredb:"filterable"`
+	Verified          bool   `json:"verified" genji:"verified" coredb:"filterable"`
+	VerificationToken string `json:"verification_token,omitempty" genji:"verification_token" coredb:"hidden"`
 	AvatarResourceId  string `json:"avatar_resource_id,omitempty" genji:"avatar_resource_id"`
+	DeletedAt         int64  `json:"deleted_at,omitempty" genji:"deleted_at"`
+	// VerificationTokenExpiresAt is zero for the tokens issued before tokens had an expiry.
+	VerificationTokenExpiresAt int64 `json:"verification_token_expires_at,omitempty" genji:"verification_token_expires_at" coredb:"hidden,expires,clears=verification_token"`
 }
 
-func (a *AccountDB) InsertFromRpcAccountRequest(account *accountRpc.AccountNewRequest, verified bool) (*Account, error) {
-	accountId := utilities.NewID()
-	var roles []*Role
-	if account.Roles != nil && len(account.Roles) > 0 {
-		a.log.Debugf("Convert and getting roles")
-		for _, accountRpcRole := range account.Roles {
-			role := a.FromPkgRoleRequest(accountRpcRole, accountId)
-			roles = append(roles, role)
-		}
-	} else if account.NewUserRoles != nil && len(account.NewUserRoles) > 0 {
-		a.log.Debugf("Convert and getting new roles")
-		for _, accountRpcNewRole := range account.NewUserRoles {
-			param := map[string]interface{}{}
-			if accountRpcNewRole.ProjectName != "" {
-				param["name"] = accountRpcNewRole.ProjectName
-			}
-			if accountRpcNewRole.GetProjectId() != "" {
-				param["id"] = accountRpcNewRole.GetProjectId()
-			}
-			project, err := a.GetProject(&coresvc.QueryParams{Params: param})
-			if err != nil {
-				return nil, err
-			}
-			joinedProjectMetrics := metrics.GetOrCreateCounter(fmt.Sprintf(telemetry.JoinProjectLabel, telemetry.METRICS_JOINED_PROJECT, project.OrgId, project.Id))
-			go func() {
-				joinedProjectMetrics.Inc()
-			}()
+// SetVerificationToken issues token, valid for VerificationTokenTTL.
+func (a *Account) SetVerificationToken(token string) {
+	a.VerificationToken = token
+	a.VerificationTokenExpiresAt = utilities.CurrentTimestamp() + int64(VerificationTokenTTL.Seconds())
+}
 
-			accountRpcNewRole.ProjectId = project.Id
-			accountRpcNewRole.OrgId = project.OrgId
-			role := a.FromPkgNewRoleRequest(accountRpcNewRole, accountId)
-			roles = append(roles, role)
-		}
-	} else {
-		roles = append(roles, &Role{
-			ID:        utilities.NewID(),
-			AccountId: accountId,
-			Role:      int(accountRpc.Roles_GUEST),
-			ProjectId: "",
-			OrgId:     "",
-			CreatedAt: utilities.CurrentTimestamp(),
-		})
-	}
-	for _, daoRole := range roles {
-		err := a.InsertRole(daoRole)
-		if err != nil {
-			return nil, err
-		}
-	}
-	isVerified := false
-	if verified {
-		isVerified = verified
+// CheckVerificationToken reports whether token is the verification token of the account
+// and has not expired.
+func (a *Account) CheckVerificationToken(token string) bool {
+	if a.VerificationToken == "" || a.VerificationToken != token {
+		return false
 	}
+	return a.VerificationTokenExpiresAt == 0 || a.VerificationTokenExpiresAt > utilities.CurrentTimestamp()
+}
+
+// InsertFromRpcAccountRequest inserts the account and its roles in a single transaction,
+// a failing role leaves neither the account nor any of its roles behind.
+func (a *AccountDB) InsertFromRpcAccountRequest(account *accountRpc.AccountNewRequest, verified bool) (*Account, error) {
+	accountId := utilities.NewID()
 	acc := &Account{
 		ID:               accountId,
 		Email:            account.Email,
@@ -103,13 +81,64 @@ func (a *AccountDB) InsertFromRpcAccountRequest(account *accountRpc.AccountNewRe
 		UpdatedAt:        utilities.CurrentTimestamp(),
 		LastLogin:        utilities.CurrentTimestamp(),
 		Disabled:         false,
-		Verified:         isVerified,
+		Verified:         verified,
 		AvatarResourceId: account.AvatarFilepath,
 	}
-
-	if err := a.InsertAccount(acc); err != nil {
+	var joinedProjects []*Project
+	err := a.db.Update(context.Background(), func(tx *coresvc.Tx) error {
+		var roles []*Role
+		if account.Roles != nil && len(account.Roles) > 0 {
+			a.log.Debugf("Convert and getting roles")
+			for _, accountRpcRole := range account.Roles {
+				role := a.FromPkgRoleRequest(accountRpcRole, accountId)
+				roles = append(roles, role)
+			}
+		} else if account.NewUserRoles != nil && len(account.NewUserRoles) > 0 {
+			a.log.Debugf("Convert and getting new roles")
+			for _, accountRpcNewRole := range account.NewUserRoles {
+				param := map[string]interface{}{}
+				if accountRpcNewRole.ProjectName != "" {
+					param["name"] = accountRpcNewRole.ProjectName
+				}
+				if accountRpcNewRole.GetProjectId() != "" {
+					param["id"] = accountRpcNewRole.GetProjectId()
+				}
+				project, err := a.getProject(tx, &coresvc.QueryParams{Params: param})
+				if err != nil {
+					return err
+				}
+				joinedProjects = append(joinedProjects, project)
+				accountRpcNewRole.ProjectId = project.Id
+				accountRpcNewRole.OrgId = project.OrgId
+				role := a.FromPkgNewRoleRequest(accountRpcNewRole, accountId)
+				roles = append(roles, role)
+			}
+		} else {
+			roles = append(roles, &Role{
+				ID:        utilities.NewID(),
+				AccountId: accountId,
+				Role:      int(accountRpc.Roles_GUEST),
+				ProjectId: "",
+				OrgId:     "",
+				CreatedAt: utilities.CurrentTimestamp(),
+			})
+		}
+		for _, daoRole := range roles {
+			if err := a.insertRole(tx, daoRole); err != nil {
+				return err
+			}
+		}
+		return a.insertAccount(tx, acc)
+	})
+	if err != nil {
 		return nil, err
 	}
+	for _, project := range joinedProjects {
+		joinedProjectMetrics := metrics.GetOrCreateCounter(fmt.Sprintf(telemetry.JoinProjectLabel, telemetry.METRICS_JOINED_PROJECT, project.OrgId, project.Id))
+		go func() {
+			joinedProjectMetrics.Inc()
+		}()
+	}
 	return acc, nil
 }
 
@@ -127,6 +156,7 @@ func (a *AccountDB) FromRpcAccount(account *accountRpc.Account) (*Account, error
 	}, nil
 }
 
+// ToRpcAccount leaves out the hidden fields, the password hash and the verification token.
 func (a *Account) ToRpcAccount(roles []*accountRpc.UserRoles, avatar []byte) (*accountRpc.Account, error) {
 	createdAt := time.Unix(a.CreatedAt, 0)
 	updatedAt := time.Unix(a.UpdatedAt, 0)
@@ -138,7 +168,6 @@ func (a *Account) ToRpcAccount(roles []*accountRpc.UserRoles, avatar []byte) (*a
 	return &accountRpc.Account{
 		Id:               a.ID,
 		Email:            a.Email,
-		Password:         a.Password,
 		Roles:            roles,
 		CreatedAt:        timestamppb.New(createdAt),
 		UpdatedAt:        timestamppb.New(updatedAt),
@@ -156,8 +185,7 @@ func accountToQueryParams(acc *Account) (res coresvc.QueryParams, err error) {
 
 // CreateSQL will only be called once by sys-core see sys-core API.
 func (a Account) CreateSQL() []string {
-	fields := coresvc.GetStructTags(a)
-	tbl := coresvc.NewTable(AccTableName, fields, []string{accountsUniqueIdx})
+	tbl := coresvc.NewModelTable(AccTableName, a)
 	return tbl.CreateTable()
 }
 
@@ -168,7 +196,7 @@ func (a *AccountDB) GetAccount(filterParams *coresvc.QueryParams) (*Account, err
 		AccTableName,
 		a.accountColumns,
 		"eq",
-	).ToSql()
+	).Where(notDeleted).ToSql()
 	if err != nil {
 		return nil, err
 	}
@@ -180,36 +208,33 @@ func (a *AccountDB) GetAccount(filterParams *coresvc.QueryParams) (*Account, err
 	return &acc, err
 }
 
-func (a *AccountDB) ListAccount(filterParams *coresvc.QueryParams, orderBy string, limit, cursor int64, sqlMatcher string) ([]*Account, int64, error) {
-	var accs []*Account
-	if sqlMatcher == "" {
-		sqlMatcher = "like"
-	}
-	baseStmt := coresvc.BaseQueryBuilder(filterParams.Params, AccTableName, a.accountColumns, sqlMatcher)
-	selectStmt, args, err := coresvc.ListSelectStatement(baseStmt, orderBy, limit, &cursor, DefaultCursor)
-	if err != nil {
-		return nil, 0, err
-	}
-	res, err := a.db.Query(selectStmt, args...)
+// ListAccount lists the accounts within scope matching filter, only filter is checked
+// against the columns clients may filter on.
+func (a *AccountDB) ListAccount(ctx context.Context, scope, filter *coresvc.Filter, page coresvc.PageRequest) ([]*Account, *coresvc.PageInfo, error) {
+	res, err := a.db.QueryPage(ctx, listQuery(AccTableName, a.accountColumns, scope, filter, page))
 	if err != nil {
-		return nil, 0, err
+		return nil, nil, err
 	}
+	var accs []*Account
 	err = res.Iterate(func(d document.Document) error {
 		var acc Account
-		if err = document.StructScan(d, &acc); err != nil {
+		if err := document.StructScan(d, &acc); err != nil {
 			return err
 		}
 		accs = append(accs, &acc)
 		return nil
 	})
-	res.Close()
 	if err != nil {
-		return nil, 0, err
+		return nil, nil, err
 	}
-	return accs, accs[len(accs)-1].CreatedAt, nil
+	return accs, &res.PageInfo, nil
 }
 
 func (a *AccountDB) InsertAccount(acc *Account) error {
+	return a.insertAccount(a.db, acc)
+}
+
+func (a *AccountDB) insertAccount(q coresvc.Querier, acc *Account) error {
 	passwd, err := pass.GenHash(acc.Password)
 	if err != nil {
 		return err
@@ -228,7 +253,7 @@ func (a *AccountDB) InsertAccount(acc *Account) error {
 	if err != nil {
 		return err
 	}
-	return a.db.Exec(stmt, args...)
+	return q.Exec(stmt, args...)
 }
 
 func (a *AccountDB) UpdateAccount(acc *Account) error {
@@ -249,27 +274,53 @@ func (a *AccountDB) UpdateAccount(acc *Account) error {
 	return a.db.Exec(stmt, args...)
 }
 
+// DeleteAccount soft deletes the account along with its roles, all with the same deleted_at
+// so that UndeleteAccount brings back these roles only. The roles are removed when it is purged.
 func (a *AccountDB) DeleteAccount(id string) error {
-	stmt, args, err := sq.Delete(AccTableName).Where("id = ?", id).ToSql()
+	now := utilities.CurrentTimestamp()
+	rstmt, err := softDeleteStmt(RolesTableName, sq.Eq{"account_id": id}, now)
 	if err != nil {
 		return err
 	}
-	rstmt, rargs, err := sq.Delete(RolesTableName).Where("account_id = ?", id).ToSql()
+	stmt, err := softDeleteStmt(AccTableName, sq.Eq{"id": id}, now)
 	if err != nil {
 		return err
 	}
-	return a.db.BulkExec(map[string][]interface{}{
-		stmt:  args,
-		rstmt: rargs,
+	return a.db.ExecAll(context.Background(), rstmt, stmt)
+}
+
+// UndeleteAccount restores a soft deleted account along with the roles deleted with it.
+func (a *AccountDB) UndeleteAccount(id string) error {
+	return a.db.Update(context.Background(), func(tx *coresvc.Tx) error {
+		at, err := deletedAt(tx, AccTableName, id)
+		if err != nil {
+			return err
+		}
+		rstmt, err := undeleteStmt(RolesTableName, sq.Eq{"account_id": id, deletedAtColumn: at})
+		if err != nil {
+			return err
+		}
+		stmt, err := undeleteStmt(AccTableName, sq.Eq{"id": id})
+		if err != nil {
+			return err
+		}
+		return tx.ExecAll(rstmt, stmt)
 	})
 }
 
+// UpsertLoginAttempt records the attempts of an address, they expire loginAttemptTTL later
+// or when the ban ends, whichever comes last.
 func (a *AccountDB) UpsertLoginAttempt(originIp string, accountEmail string, attempt uint, banPeriod int64) (*LoginAttempt, error) {
+	expiresAt := utilities.CurrentTimestamp() + int64(loginAttemptTTL.Seconds())
+	if banPeriod > expiresAt {
+		expiresAt = banPeriod
+	}
 	newLoginAttempt := &LoginAttempt{
 		OriginIP:      originIp,
 		AccountEmail:  accountEmail,
 		TotalAttempts: attempt,
 		BanPeriod:     banPeriod,
+		ExpiresAt:     expiresAt,
 	}
 	queryParam, err := coresvc.AnyToQueryParam(newLoginAttempt, true)
 	if err != nil {
@@ -277,16 +328,22 @@ func (a *AccountDB) UpsertLoginAttempt(originIp string, accountEmail string, att
 	}
 	columns, values := queryParam.ColumnsAndValues()
 
-	_, err = a.GetLoginAttempt(originIp)
+	// an expired row which has not been swept yet is overwritten
+	stmt, args, err := sq.Select("origin_ip").From(LoginAttemptsTableName).Where(sq.Eq{"origin_ip": originIp}).ToSql()
 	if err != nil {
+		return nil, err
+	}
+	if _, err = a.db.QueryOne(stmt, args...); err != nil {
 		return a.insertLoginAttempt(originIp, columns, values)
 	}
 	return a.updateLoginAttempt(originIp, queryParam.Params)
 }
 
+// GetLoginAttempt returns the unexpired login attempts of an address.
 func (a *AccountDB) GetLoginAttempt(originIp string) (*LoginAttempt, error) {
 	var la LoginAttempt
-	selectStmt, args, err := coresvc.BaseQueryBuilder(map[string]interface{}{"origin_ip": originIp}, LoginAttemptsTableName, a.loginAttemptColumns, "eq").ToSql()
+	selectStmt, args, err := coresvc.BaseQueryBuilder(map[string]interface{}{"origin_ip": originIp}, LoginAttemptsTableName, a.loginAttemptColumns, "eq").
+		Where(a.db.NotExpired(LoginAttemptsTableName)).ToSql()
 	if err != nil {
 		return nil, err
 	}
@@ -316,7 +373,7 @@ func (a *AccountDB) insertLoginAttempt(originIp string, columns []string, values
 
 func (a *AccountDB) updateLoginAttempt(originIp string, requestMap map[string]interface{}) (*LoginAttempt, error) {
 	stmt, args, err := sq.Update(LoginAttemptsTableName).
-		SetMap(requestMap).ToSql()
+		SetMap(requestMap).Where(sq.Eq{"origin_ip": originIp}).ToSql()
 	if err != nil {
 		return nil, err
 	}
@@ -1,13 +1,16 @@
 package dao_test
 
 import (
+	"bytes"
+	"context"
+	"strings"
 	"go.amplifyedge.org/sys-share-v2/sys-core/service/logging/zaplog"
 	"github.com/stretchr/testify/assert"
 	"testing"
 
+	accountRpc "go.amplifyedge.org/sys-share-v2/sys-account/service/go/rpc/v2"
 	utilities "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
 	"go.amplifyedge.org/sys-v2/sys-account/service/go/pkg/dao"
-	corecfg "go.amplifyedge.org/sys-v2/sys-core/service/go"
 	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
 )
 
@@ -60,14 +63,9 @@ var (
 )
 
 func init() {
-	var csc *corecfg.SysCoreConfig
 	logger := zaplog.NewZapLogger(zaplog.DEBUG, "sys-account-dao-test", true, "")
 	logger.InitLogger(nil)
-	csc, err = corecfg.NewConfig("./testdata/syscore.yml")
-	if err != nil {
-		logger.Fatalf("error initializing db: %v", err)
-	}
-	testDb, err = coresvc.NewCoreDB(logger, &csc.SysCoreConfig, nil)
+	testDb, err = coresvc.NewTestDB(logger)
 	if err != nil {
 		logger.Fatalf("error creating CoreDB: %v", err)
 	}
@@ -81,12 +79,14 @@ func init() {
 
 func TestAll(t *testing.T) {
 	t.Run("Test Account Insert", testAccountInsert)
+	t.Run("Test Account Insert Rollback", testAccountInsertRollback)
 	t.Run("Test Org Insert", testOrgInsert)
 	t.Run("Test Org Get", testOrgGet)
 	t.Run("Test Org List", testOrgList)
 	t.Run("Test Project Insert", testProjInsert)
 	t.Run("Test Project Get", testProjGet)
 	t.Run("Test Account Query", testQueryAccounts)
+	t.Run("Test Account Export", testAccountExport)
 	t.Run("Test Project List", testProjList)
 	t.Run("Test Role Insert", testRolesInsert)
 	t.Run("Test Role List", testRolesList)
@@ -95,10 +95,17 @@ func TestAll(t *testing.T) {
 	t.Run("Test Project Update", testProjUpdate)
 	t.Run("Test Role Update", testRolesUpdate)
 	t.Run("Test Account Update", testUpdateAccounts)
+	t.Run("Test Account Watch", testAccountWatch)
 	t.Run("Test Org Delete", testDeleteOrg)
 	t.Run("Test Account Delete", testDeleteAccounts)
 	t.Run("Test Project Delete", testProjDelete)
 	t.Run("Test Role Delete", testRoleDelete)
+	t.Run("Test Undelete", testUndelete)
+	t.Run("Test Purge Deleted", testPurgeDeleted)
+	t.Run("Test Login Attempt Expiry", testLoginAttemptExpiry)
+	t.Run("Test Login Attempt Migration", testLoginAttemptMigration)
+	t.Run("Test Verification Token Expiry", testVerificationTokenExpiry)
+	t.Run("Test Search Sources", testSearchSources)
 }
 
 func testAccountInsert(t *testing.T) {
@@ -111,6 +118,28 @@ func testAccountInsert(t *testing.T) {
 
 }
 
+func testAccountInsertRollback(t *testing.T) {
+	roles, err := accdb.ListRole(&coresvc.QueryParams{Params: map[string]interface{}{}})
+	assert.NoError(t, err)
+
+	// the second role references a missing org, the first one must not be left behind
+	_, err = accdb.InsertFromRpcAccountRequest(&accountRpc.AccountNewRequest{
+		Email:    "orphan@example.com",
+		Password: "orphan_password",
+		Roles: []*accountRpc.UserRoles{
+			{Role: accountRpc.Roles_GUEST},
+			{Role: accountRpc.Roles_ADMIN, OrgId: utilities.NewID()},
+		},
+	}, false)
+	assert.Error(t, err)
+
+	_, err = accdb.GetAccount(&coresvc.QueryParams{Params: map[string]interface{}{"email": "orphan@example.com"}})
+	assert.Error(t, err)
+	after, err := accdb.ListRole(&coresvc.QueryParams{Params: map[string]interface{}{}})
+	assert.NoError(t, err)
+	assert.Len(t, after, len(roles))
+}
+
 func testQueryAccounts(t *testing.T) {
 	t.Logf("on querying accounts")
 	queryParams := []*coresvc.QueryParams{
@@ -133,13 +162,56 @@ func testQueryAccounts(t *testing.T) {
 		accs = append(accs, acc)
 	}
 	assert.NotEqual(t, accs[0], accs[1])
-	var next int64
-
+	// the password hash is read for login, but never sent out
+	assert.NotEmpty(t, accs[0].Password)
+	rpcAcc, err := accs[0].ToRpcAccount(nil, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, rpcAcc.Password)
 	for _, qp := range queryParams {
-		accs, next, err = accdb.ListAccount(qp, "email", 1, 0, "")
+		var info *coresvc.PageInfo
+		accs, info, err = accdb.ListAccount(context.Background(), nil, coresvc.FilterFromParams(qp.Params, "like"), coresvc.PageRequest{OrderBy: "email", Limit: 1})
 		assert.NoError(t, err)
-		assert.NotEqual(t, 0, next)
+		assert.Len(t, accs, 1)
+		assert.False(t, info.HasMore)
 	}
+
+	// no match is an empty page
+	accs, info, err := accdb.ListAccount(context.Background(), nil, &coresvc.Filter{
+		Field: "email", Op: coresvc.FilterEq, Value: "nobody@example.com",
+	}, coresvc.PageRequest{})
+	assert.NoError(t, err)
+	assert.Empty(t, accs)
+	assert.EqualValues(t, 0, info.Total)
+	assert.Empty(t, info.NextCursor)
+
+	// hidden columns can be neither filtered nor sorted on
+	_, _, err = accdb.ListAccount(context.Background(), nil, &coresvc.Filter{
+		Field: "password", Op: coresvc.FilterLike, Value: "$",
+	}, coresvc.PageRequest{})
+	assert.True(t, coresvc.IsInvalidQuery(err))
+	_, _, err = accdb.ListAccount(context.Background(), nil, nil, coresvc.PageRequest{OrderBy: "verification_token"})
+	assert.True(t, coresvc.IsInvalidQuery(err))
+	_, _, err = accdb.ListAccount(context.Background(), nil, nil, coresvc.PageRequest{OrderBy: "email; DROP TABLE accounts"})
+	assert.True(t, coresvc.IsInvalidQuery(err))
+}
+
+func testAccountExport(t *testing.T) {
+	var buf bytes.Buffer
+	rows, err := testDb.ExportTable(context.Background(), &buf, dao.AccTableName, coresvc.ExportOptions{Format: coresvc.ExportFormatCSV})
+	assert.NoError(t, err)
+	assert.EqualValues(t, len(accs), rows)
+	header := strings.SplitN(buf.String(), "\n", 2)[0]
+	assert.Contains(t, strings.Split(header, ","), "email")
+	assert.NotContains(t, strings.Split(header, ","), "password")
+	assert.NotContains(t, strings.Split(header, ","), "verification_token")
+
+	// hidden columns are exported when asked for by name
+	buf.Reset()
+	_, err = testDb.ExportTable(context.Background(), &buf, dao.AccTableName, coresvc.ExportOptions{
+		Format: coresvc.ExportFormatCSV, Columns: []string{"id", "password"},
+	})
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(buf.String(), "id,password\n"))
 }
 
 func testUpdateAccounts(t *testing.T) {
@@ -169,4 +241,12 @@ func testUpdateAccounts(t *testing.T) {
 
 func testDeleteAccounts(t *testing.T) {
 	assert.NoError(t, accdb.DeleteAccount(accs[0].ID))
+	// the deleted account is no longer a member of its org
+	roles, err := accdb.ListRole(&coresvc.QueryParams{Params: map[string]interface{}{"org_id": org1ID}})
+	assert.NoError(t, err)
+	for _, role := range roles {
+		assert.NotEqual(t, accs[0].ID, role.AccountId)
+	}
+	_, err = accdb.GetRole(&coresvc.QueryParams{Params: map[string]interface{}{"id": role1ID}})
+	assert.Error(t, err)
 }
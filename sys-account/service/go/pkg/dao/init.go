@@ -24,15 +24,18 @@ func NewAccountDB(db *coresvc.CoreDB, l logging.Logger) (*AccountDB, error) {
 	loginAttemptColumns := coresvc.GetStructColumns(LoginAttempt{})
 
 	err := db.RegisterModels(map[string]coresvc.DbModel{
-		AccTableName:        Account{},
-		RolesTableName:      Role{},
-		OrgTableName:        Org{},
-		ProjectTableName:    Project{},
-		loginAttemptColumns: LoginAttempt{},
+		AccTableName:           Account{},
+		RolesTableName:         Role{},
+		OrgTableName:           Org{},
+		ProjectTableName:       Project{},
+		LoginAttemptsTableName: LoginAttempt{},
 	})
 	if err != nil {
 		return nil, err
 	}
+	if err = db.RegisterMigrations(migrations()); err != nil {
+		return nil, err
+	}
 	if err := db.MakeSchema(); err != nil {
 		return nil, err
 	}
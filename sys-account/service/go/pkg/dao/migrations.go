@@ -0,0 +1,45 @@
+package dao
+
+import (
+	"fmt"
+
+	utilities "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+)
+
+// migrations of the sys-account database, built when the database is opened.
+// CreateSQL of each model always describes the latest schema,
+// every change to it has to be appended here as well so existing databases pick it up.
+// Never edit or renumber a migration once it has been released.
+func migrations() []coresvc.Migration {
+	// the login attempts written before they expired are kept as a fresh one would be
+	attemptsExpireAt := utilities.CurrentTimestamp() + int64(loginAttemptTTL.Seconds())
+	return []coresvc.Migration{
+		{
+			// deleted_at needs no ALTER TABLE, the rows written before it read as null, that is not deleted.
+			// Rolling back removes the rows soft deleted in the meantime, as the older code would have,
+			// starting with the roles deleted along with their account.
+			Version:     1,
+			Description: "soft delete accounts, orgs and projects",
+			Down: []string{
+				fmt.Sprintf("DELETE FROM %s WHERE %s IS NOT NULL", RolesTableName, deletedAtColumn),
+				fmt.Sprintf("DELETE FROM %s WHERE %s IS NOT NULL", ProjectTableName, deletedAtColumn),
+				fmt.Sprintf("DELETE FROM %s WHERE %s IS NOT NULL", OrgTableName, deletedAtColumn),
+				fmt.Sprintf("DELETE FROM %s WHERE %s IS NOT NULL", AccTableName, deletedAtColumn),
+			},
+		},
+		{
+			// The login attempts written before they expired have no expires_at and would be kept forever,
+			// they expire loginAttemptTTL after the migration or when their ban ends, whichever comes last.
+			// The verification tokens issued before keep working until used, the older code ignores the
+			// expiry so there is nothing to roll back.
+			Version:     2,
+			Description: "expire login attempts and verification tokens",
+			Up: []string{
+				fmt.Sprintf("UPDATE %s SET expires_at = ban_period WHERE expires_at IS NULL AND ban_period > %d",
+					LoginAttemptsTableName, attemptsExpireAt),
+				fmt.Sprintf("UPDATE %s SET expires_at = %d WHERE expires_at IS NULL", LoginAttemptsTableName, attemptsExpireAt),
+			},
+		},
+	}
+}
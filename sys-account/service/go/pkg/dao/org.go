@@ -1,6 +1,7 @@
 package dao
 
 import (
+	"context"
 	"fmt"
 	sq "github.com/Masterminds/squirrel"
 	"github.com/genjidb/genji/document"
@@ -13,19 +14,15 @@ import (
 )
 
 type Org struct {
-	Id             string `genji:"id" json:"id,omitempty" coredb:"primary"`
-	Name           string `genji:"name" json:"name,omitempty"`
-	LogoResourceId string `genji:"logo_resource_id" json:"logo_resource_id,omitempty"`
-	Contact        string `genji:"contact" json:"contact,omitempty"`
-	CreatedAt      int64  `genji:"created_at" json:"created_at"`
-	AccountId      string `genji:"account_id" json:"account_id"`
+	Id             string `genji:"id" json:"id,omitempty" coredb:"primary,sortable,filterable"`
+	Name           string `genji:"name" json:"name,omitempty" coredb:"unique,sortable,filterable"`
+	LogoResourceId string `genji:"logo_resource_id" json:"logo_resource_id,omitempty" coredb:"unique"`
+	Contact        string `genji:"contact" json:"contact,omitempty" coredb:"filterable"`
+	CreatedAt      int64  `genji:"created_at" json:"created_at" coredb:"sortable,filterable"`
+	AccountId      string `genji:"account_id" json:"account_id" coredb:"filterable"`
+	DeletedAt      int64  `genji:"deleted_at" json:"deleted_at,omitempty"`
 }
 
-var (
-	orgUniqueIndex     = fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS idx_%s_name ON %s(name)", OrgTableName, OrgTableName)
-	orgLogoUniqueIndex = fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS idx_%s_logo_resource_id ON %s(logo_resource_id)", OrgTableName, OrgTableName)
-)
-
 func (a *AccountDB) FromrpcOrgRequest(org *rpc.OrgRequest, id string) (*Org, error) {
 	orgId := id
 	if orgId == "" {
@@ -64,9 +61,7 @@ func (o *Org) ToRpcOrg(projects []*rpc.Project, logo []byte) (*rpc.Org, error) {
 }
 
 func (o Org) CreateSQL() []string {
-	fields := coresvc.GetStructTags(o)
-	// tbl := coresvc.NewTable(OrgTableName, fields, []string{orgUniqueIndex})
-	tbl := coresvc.NewTable(OrgTableName, fields, []string{orgUniqueIndex, orgLogoUniqueIndex})
+	tbl := coresvc.NewModelTable(OrgTableName, o)
 	return tbl.CreateTable()
 }
 
@@ -75,12 +70,16 @@ func orgToQueryParam(org *Org) (res coresvc.QueryParams, err error) {
 }
 
 func (a *AccountDB) GetOrg(filterParam *coresvc.QueryParams) (*Org, error) {
+	return a.getOrg(a.db, filterParam)
+}
+
+func (a *AccountDB) getOrg(q coresvc.Querier, filterParam *coresvc.QueryParams) (*Org, error) {
 	var o Org
-	selectStmt, args, err := coresvc.BaseQueryBuilder(filterParam.Params, OrgTableName, a.orgColumns, "eq").ToSql()
+	selectStmt, args, err := coresvc.BaseQueryBuilder(filterParam.Params, OrgTableName, a.orgColumns, "eq").Where(notDeleted).ToSql()
 	if err != nil {
 		return nil, err
 	}
-	doc, err := a.db.QueryOne(selectStmt, args...)
+	doc, err := q.QueryOne(selectStmt, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -88,44 +87,36 @@ func (a *AccountDB) GetOrg(filterParam *coresvc.QueryParams) (*Org, error) {
 	return &o, err
 }
 
-func (a *AccountDB) ListOrg(filterParam *coresvc.QueryParams, orderBy string, limit, cursor int64, sqlMatcher string) ([]*Org, int64, error) {
-	var orgs []*Org
-	if sqlMatcher == "" {
-		sqlMatcher = "like"
-	}
-	baseStmt := coresvc.BaseQueryBuilder(filterParam.Params, OrgTableName, a.orgColumns, sqlMatcher)
-	selectStmt, args, err := coresvc.ListSelectStatement(baseStmt, orderBy, limit, &cursor, DefaultCursor)
-	if err != nil {
-		return nil, 0, err
-	}
-	res, err := a.db.Query(selectStmt, args...)
+func (a *AccountDB) ListOrg(ctx context.Context, filter *coresvc.Filter, page coresvc.PageRequest) ([]*Org, *coresvc.PageInfo, error) {
+	return a.listOrgs(ctx, listQuery(OrgTableName, a.orgColumns, nil, filter, page))
+}
+
+func (a *AccountDB) listOrgs(ctx context.Context, query coresvc.PageQuery) ([]*Org, *coresvc.PageInfo, error) {
+	res, err := a.db.QueryPage(ctx, query)
 	if err != nil {
-		return nil, 0, err
+		return nil, nil, err
 	}
+	var orgs []*Org
 	err = res.Iterate(func(d document.Document) error {
 		var org Org
-		if err = document.StructScan(d, &org); err != nil {
+		if err := document.StructScan(d, &org); err != nil {
 			return err
 		}
 		orgs = append(orgs, &org)
 		return nil
 	})
 	if err != nil {
-		return nil, 0, err
-	}
-	_ = res.Close()
-	if len(orgs) == 1 {
-		return orgs, orgs[0].CreatedAt, nil
+		return nil, nil, err
 	}
-	return orgs, orgs[len(orgs)-1].CreatedAt, nil
+	return orgs, &res.PageInfo, nil
 }
 
-func (a *AccountDB) ListNonSubbed(accountId string, filterParams *coresvc.QueryParams, orderBy string, limit, cursor int64) ([]*Org, int64, error) {
-	baseStmt := sq.Select(a.orgColumns).From(OrgTableName)
+func (a *AccountDB) ListNonSubbed(ctx context.Context, accountId string, filter *coresvc.Filter, page coresvc.PageRequest) ([]*Org, *coresvc.PageInfo, error) {
+	query := listQuery(OrgTableName, a.orgColumns, nil, filter, page)
 	if accountId != "" {
 		roles, err := a.FetchRoles(accountId)
 		if err != nil {
-			return nil, 0, err
+			return nil, nil, err
 		}
 		orgIdMap := map[string]string{}
 		for _, r := range roles {
@@ -139,39 +130,12 @@ func (a *AccountDB) ListNonSubbed(accountId string, filterParams *coresvc.QueryP
 			for k, _ := range orgIdMap {
 				orgIdList = append(orgIdList, k)
 			}
-			baseStmt = baseStmt.Where("id NOT IN ?", orgIdList)
-		}
-	}
-	if filterParams != nil && filterParams.Params != nil {
-		for k, v := range filterParams.Params {
-			baseStmt = baseStmt.Where(sq.Like{k: a.BuildSearchQuery(v.(string))})
-		}
-	}
-	var orgs []*Org
-	selectStmt, args, err := coresvc.ListSelectStatement(baseStmt, orderBy, limit, &cursor, DefaultCursor)
-	if err != nil {
-		return nil, 0, err
-	}
-	res, err := a.db.Query(selectStmt, args...)
-	if err != nil {
-		return nil, 0, err
-	}
-	err = res.Iterate(func(d document.Document) error {
-		var org Org
-		if err = document.StructScan(d, &org); err != nil {
-			return err
+			query.Scope = sq.And{query.Scope, &coresvc.Filter{
+				Field: "id", Op: coresvc.FilterNotIn, Value: orgIdList,
+			}}
 		}
-		orgs = append(orgs, &org)
-		return nil
-	})
-	if err != nil {
-		return nil, 0, err
 	}
-	_ = res.Close()
-	if len(orgs) == 1 {
-		return orgs, 0, nil
-	}
-	return orgs, orgs[len(orgs)-1].CreatedAt, nil
+	return a.listOrgs(ctx, query)
 }
 
 func (a *AccountDB) InsertOrg(o *Org) error {
@@ -213,17 +177,36 @@ func (a *AccountDB) UpdateOrg(o *Org) error {
 	return a.db.Exec(stmt, args...)
 }
 
+// DeleteOrg soft deletes the org and its projects, all with the same deleted_at
+// so that UndeleteOrg brings back these projects only.
 func (a *AccountDB) DeleteOrg(id string) error {
-	stmt, args, err := sq.Delete(OrgTableName).Where("id = ?", id).ToSql()
+	now := utilities.CurrentTimestamp()
+	pstmt, err := softDeleteStmt(ProjectTableName, sq.Eq{"org_id": id}, now)
 	if err != nil {
 		return err
 	}
-	pstmt, pargs, err := sq.Delete(ProjectTableName).Where("org_id = ?", id).ToSql()
+	stmt, err := softDeleteStmt(OrgTableName, sq.Eq{"id": id}, now)
 	if err != nil {
 		return err
 	}
-	return a.db.BulkExec(map[string][]interface{}{
-		stmt:  args,
-		pstmt: pargs,
+	return a.db.ExecAll(context.Background(), pstmt, stmt)
+}
+
+// UndeleteOrg restores a soft deleted org along with the projects deleted with it.
+func (a *AccountDB) UndeleteOrg(id string) error {
+	return a.db.Update(context.Background(), func(tx *coresvc.Tx) error {
+		at, err := deletedAt(tx, OrgTableName, id)
+		if err != nil {
+			return err
+		}
+		pstmt, err := undeleteStmt(ProjectTableName, sq.Eq{"org_id": id, deletedAtColumn: at})
+		if err != nil {
+			return err
+		}
+		stmt, err := undeleteStmt(OrgTableName, sq.Eq{"id": id})
+		if err != nil {
+			return err
+		}
+		return tx.ExecAll(pstmt, stmt)
 	})
 }
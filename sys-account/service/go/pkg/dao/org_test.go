@@ -1,6 +1,7 @@
 package dao_test
 
 import (
+	"context"
 	"testing"
 
 	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
@@ -65,9 +66,9 @@ func testOrgList(t *testing.T) {
 	}
 	var allOrgs [][]*dao.Org
 	for _, qp := range qps {
-		orgs, next, err := accdb.ListOrg(qp, "name", 2, 0, "like")
+		orgs, info, err := accdb.ListOrg(context.Background(), coresvc.FilterFromParams(qp.Params, "like"), coresvc.PageRequest{OrderBy: "name", Limit: 2})
 		assert.NoError(t, err)
-		assert.NotEqual(t, 0, next)
+		assert.NotNil(t, info)
 		assert.NotEqual(t, nil, orgs)
 		allOrgs = append(allOrgs, orgs)
 	}
@@ -0,0 +1,27 @@
+package dao
+
+import (
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+)
+
+// listQuery pages through the rows of a table which are not deleted, sorted on DefaultCursor
+// unless the request says otherwise. filter comes from the request and is checked against
+// the sortable and filterable columns of the model, scope is set by the server and is not.
+func listQuery(table, columns string, scope, filter *coresvc.Filter, page coresvc.PageRequest) coresvc.PageQuery {
+	if page.OrderBy == "" {
+		page.OrderBy = DefaultCursor
+	}
+	if page.Limit == 0 {
+		page.Limit = DefaultLimit
+	}
+	query := coresvc.PageQuery{
+		PageRequest: page,
+		Table:       table,
+		Columns:     columns,
+	}
+	query.Scope = withNotDeleted(scope)
+	if filter != nil {
+		query.Filter = filter
+	}
+	return query
+}
@@ -1,6 +1,7 @@
 package dao
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	sq "github.com/Masterminds/squirrel"
@@ -14,20 +15,16 @@ import (
 )
 
 type Project struct {
-	Id             string `json:"id" genji:"id" coredb:"primary"`
-	Name           string `json:"name,omitempty" genji:"name"`
-	LogoResourceId string `json:"logo_resource_id" genji:"logo_resource_id"`
-	CreatedAt      int64  `json:"created_at" genji:"created_at"`
-	AccountId      string `json:"account_id" genji:"account_id"`
-	OrgId          string `json:"org_id" genji:"org_id"`
-	OrgName        string `json:"org_name" genji:"org_name"`
+	Id             string `json:"id" genji:"id" coredb:"primary,sortable,filterable"`
+	Name           string `json:"name,omitempty" genji:"name" coredb:"unique,sortable,filterable"`
+	LogoResourceId string `json:"logo_resource_id" genji:"logo_resource_id" coredb:"unique"`
+	CreatedAt      int64  `json:"created_at" genji:"created_at" coredb:"sortable,filterable"`
+	AccountId      string `json:"account_id" genji:"account_id" coredb:"filterable"`
+	OrgId          string `json:"org_id" genji:"org_id" coredb:"filterable"`
+	OrgName        string `json:"org_name" genji:"org_name" coredb:"sortable,filterable"`
+	DeletedAt      int64  `json:"deleted_at,omitempty" genji:"deleted_at"`
 }
 
-var (
-	projectUniqueIndex     = fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS idx_%s_name ON %s(name)", ProjectTableName, ProjectTableName)
-	projectLogoUniqueIndex = fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS idx_%s_logo_resource_id ON %s(logo_resource_id)", ProjectTableName, ProjectTableName)
-)
-
 func (a *AccountDB) FromRpcProject(p *rpc.ProjectRequest) (*Project, error) {
 	var orgId, orgName string
 	if p.OrgId == "" && p.OrgName == "" {
@@ -68,8 +65,7 @@ func (p *Project) ToRpcProject(org *rpc.Org, logo []byte) (*rpc.Project, error)
 }
 
 func (p Project) CreateSQL() []string {
-	fields := coresvc.GetStructTags(p)
-	tbl := coresvc.NewTable(ProjectTableName, fields, []string{projectUniqueIndex, projectLogoUniqueIndex})
+	tbl := coresvc.NewModelTable(ProjectTableName, p)
 	return tbl.CreateTable()
 }
 
@@ -82,8 +78,12 @@ func projectToQueryParam(p *Project) (res coresvc.QueryParams, err error) {
 }
 
 func (a *AccountDB) GetProject(filterParam *coresvc.QueryParams) (*Project, error) {
+	return a.getProject(a.db, filterParam)
+}
+
+func (a *AccountDB) getProject(q coresvc.Querier, filterParam *coresvc.QueryParams) (*Project, error) {
 	var p Project
-	selectStmt, args, err := coresvc.BaseQueryBuilder(filterParam.Params, ProjectTableName, a.projectColumns, "eq").ToSql()
+	selectStmt, args, err := coresvc.BaseQueryBuilder(filterParam.Params, ProjectTableName, a.projectColumns, "eq").Where(notDeleted).ToSql()
 	if err != nil {
 		return nil, err
 	}
@@ -91,7 +91,7 @@ func (a *AccountDB) GetProject(filterParam *coresvc.QueryParams) (*Project, erro
 		"queryStatement": selectStmt,
 		"arguments":      args,
 	}).Debug("Querying projects")
-	doc, err := a.db.QueryOne(selectStmt, args...)
+	doc, err := q.QueryOne(selectStmt, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -102,40 +102,30 @@ func (a *AccountDB) GetProject(filterParam *coresvc.QueryParams) (*Project, erro
 	return &p, nil
 }
 
-func (a *AccountDB) ListProject(filterParam *coresvc.QueryParams, orderBy string, limit, cursor int64, sqlMatcher string) ([]*Project, int64, error) {
-	var projs []*Project
-	if sqlMatcher == "" {
-		sqlMatcher = "like"
-	}
-	baseStmt := coresvc.BaseQueryBuilder(filterParam.Params, ProjectTableName, a.projectColumns, sqlMatcher)
-	selectStmt, args, err := coresvc.ListSelectStatement(baseStmt, orderBy, limit, &cursor, DefaultCursor)
-	if err != nil {
-		return nil, 0, err
-	}
+func (a *AccountDB) ListProject(ctx context.Context, filter *coresvc.Filter, page coresvc.PageRequest) ([]*Project, *coresvc.PageInfo, error) {
+	query := listQuery(ProjectTableName, a.projectColumns, nil, filter, page)
 	a.log.WithFields(map[string]interface{}{
-		"queryStatement": selectStmt,
-		"arguments":      args,
+		"filter":  filter.String(),
+		"orderBy": query.OrderBy,
+		"cursor":  query.Cursor,
 	}).Debug("List projects")
-	res, err := a.db.Query(selectStmt, args...)
+	res, err := a.db.QueryPage(ctx, query)
 	if err != nil {
-		return nil, 0, err
+		return nil, nil, err
 	}
+	var projs []*Project
 	err = res.Iterate(func(d document.Document) error {
 		var p Project
-		if err = document.StructScan(d, &p); err != nil {
+		if err := document.StructScan(d, &p); err != nil {
 			return err
 		}
 		projs = append(projs, &p)
 		return nil
 	})
 	if err != nil {
-		return nil, 0, err
+		return nil, nil, err
 	}
-	if len(projs) > 0 {
-		return projs, projs[len(projs)-1].CreatedAt, nil
-	}
-	res.Close()
-	return projs, 0, nil
+	return projs, &res.PageInfo, nil
 }
 
 func (a *AccountDB) InsertProject(p *Project) error {
@@ -181,10 +171,41 @@ func (a *AccountDB) UpdateProject(p *Project) error {
 	return a.db.Exec(stmt, args...)
 }
 
+// DeleteProject soft deletes the project.
 func (a *AccountDB) DeleteProject(id string) error {
-	stmt, args, err := sq.Delete(ProjectTableName).Where("id = ?", id).ToSql()
+	stmt, err := softDeleteStmt(ProjectTableName, sq.Eq{"id": id}, sharedConfig.CurrentTimestamp())
 	if err != nil {
 		return err
 	}
-	return a.db.Exec(stmt, args...)
+	return a.db.ExecAll(context.Background(), stmt)
+}
+
+// UndeleteProject restores a soft deleted project, the org has to be restored first
+// when it is deleted as well.
+func (a *AccountDB) UndeleteProject(id string) error {
+	return a.db.Update(context.Background(), func(tx *coresvc.Tx) error {
+		if _, err := deletedAt(tx, ProjectTableName, id); err != nil {
+			return err
+		}
+		stmt, args, err := sq.Select("org_id").From(ProjectTableName).Where(sq.Eq{"id": id}).ToSql()
+		if err != nil {
+			return err
+		}
+		doc, err := tx.QueryOne(stmt, args...)
+		if err != nil {
+			return err
+		}
+		orgId, err := doc.Doc.GetByField("org_id")
+		if err != nil {
+			return err
+		}
+		if _, err = a.getOrg(tx, &coresvc.QueryParams{Params: map[string]interface{}{"id": orgId.V}}); err != nil {
+			return fmt.Errorf("org %v of project %s: %w", orgId.V, id, err)
+		}
+		ustmt, err := undeleteStmt(ProjectTableName, sq.Eq{"id": id})
+		if err != nil {
+			return err
+		}
+		return tx.ExecAll(ustmt)
+	})
 }
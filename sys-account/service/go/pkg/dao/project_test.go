@@ -1,6 +1,7 @@
 package dao_test
 
 import (
+	"context"
 	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
 	"testing"
 
@@ -72,9 +73,9 @@ func testProjList(t *testing.T) {
 	}
 	var allProjects [][]*dao.Project
 	for _, qp := range qps {
-		projs, next, err := accdb.ListProject(qp, "name", 2, 0, "like")
+		projs, info, err := accdb.ListProject(context.Background(), coresvc.FilterFromParams(qp.Params, "like"), coresvc.PageRequest{OrderBy: "name", Limit: 2})
 		assert.NoError(t, err)
-		assert.NotEqual(t, 0, next)
+		assert.NotNil(t, info)
 		assert.NotEqual(t, nil, projs)
 		allProjects = append(allProjects, projs)
 	}
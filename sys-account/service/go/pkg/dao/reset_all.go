@@ -1,7 +1,10 @@
 package dao
 
 import (
+	"context"
 	"fmt"
+
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
 )
 
 func delAllStmt(tblName string) string {
@@ -9,15 +12,10 @@ func delAllStmt(tblName string) string {
 }
 
 func (a *AccountDB) ResetAll() error {
-	deleteAllProjectsStmt := delAllStmt(ProjectTableName)
-	deleteAllOrgsStmt := delAllStmt(OrgTableName)
-	deleteAllRoles := fmt.Sprintf("DELETE FROM %s", RolesTableName)
-	deleteAllAccounts := fmt.Sprintf("DELETE FROM %s", AccTableName)
-
-	return a.db.BulkExec(map[string][]interface{}{
-		deleteAllProjectsStmt: nil,
-		deleteAllOrgsStmt:     nil,
-		deleteAllRoles:        []interface{}{},
-		deleteAllAccounts:     []interface{}{},
-	})
+	return a.db.ExecAll(context.Background(),
+		coresvc.Statement{Query: delAllStmt(RolesTableName)},
+		coresvc.Statement{Query: delAllStmt(ProjectTableName)},
+		coresvc.Statement{Query: delAllStmt(OrgTableName)},
+		coresvc.Statement{Query: delAllStmt(AccTableName)},
+	)
 }
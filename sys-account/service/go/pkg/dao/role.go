@@ -14,12 +14,14 @@ import (
 
 type Role struct {
 	ID        string `genji:"id" coredb:"primary"`
-	AccountId string `genji:"account_id"`
+	AccountId string `genji:"account_id" coredb:"index"`
 	Role      int    `genji:"role"`
-	ProjectId string `genji:"project_id"`
-	OrgId     string `genji:"org_id"`
+	OrgId     string `genji:"org_id" coredb:"index"`
+	ProjectId string `genji:"project_id" coredb:"index"`
 	CreatedAt int64  `genji:"created_at"`
 	UpdatedAt int64  `genji:"updated_at"`
+	// DeletedAt is set along with the deleted_at of its account, see DeleteAccount.
+	DeletedAt int64 `json:"deleted_at,omitempty" genji:"deleted_at"`
 }
 
 func (a *AccountDB) FromPkgRoleRequest(role *rpc.UserRoles, accountId string) *Role {
@@ -79,13 +81,12 @@ func roleToQueryParam(acc *Role) (res coresvc.QueryParams, err error) {
 
 // CreateSQL will only be called once by sys-core see sys-core API.
 func (p Role) CreateSQL() []string {
-	fields := coresvc.GetStructTags(p)
-	tbl := coresvc.NewTable(RolesTableName, fields, []string{})
+	tbl := coresvc.NewModelTable(RolesTableName, p)
 	return tbl.CreateTable()
 }
 
 func (a *AccountDB) getRolesSelectStatements(filterParam *coresvc.QueryParams) (string, []interface{}, error) {
-	baseStmt := sq.Select(a.roleColumns).From(RolesTableName)
+	baseStmt := sq.Select(a.roleColumns).From(RolesTableName).Where(notDeleted)
 	if filterParam != nil && filterParam.Params != nil {
 		for k, v := range filterParam.Params {
 			baseStmt = baseStmt.Where(sq.Eq{k: v})
@@ -142,14 +143,18 @@ func (a *AccountDB) ListRole(filterParam *coresvc.QueryParams) ([]*Role, error)
 }
 
 func (a *AccountDB) InsertRole(p *Role) error {
+	return a.insertRole(a.db, p)
+}
+
+func (a *AccountDB) insertRole(q coresvc.Querier, p *Role) error {
 	if p.OrgId != "" {
-		_, err := a.GetOrg(&coresvc.QueryParams{Params: map[string]interface{}{"id": p.OrgId}})
+		_, err := a.getOrg(q, &coresvc.QueryParams{Params: map[string]interface{}{"id": p.OrgId}})
 		if err != nil {
 			return err
 		}
 	}
 	if p.ProjectId != "" {
-		_, err := a.GetProject(&coresvc.QueryParams{Params: map[string]interface{}{"id": p.ProjectId}})
+		_, err := a.getProject(q, &coresvc.QueryParams{Params: map[string]interface{}{"id": p.ProjectId}})
 		if err != nil {
 			return err
 		}
@@ -169,7 +174,7 @@ func (a *AccountDB) InsertRole(p *Role) error {
 	if err != nil {
 		return err
 	}
-	return a.db.Exec(stmt, args...)
+	return q.Exec(stmt, args...)
 }
 
 func (a *AccountDB) UpdateRole(p *Role) error {
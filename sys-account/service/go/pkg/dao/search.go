@@ -0,0 +1,67 @@
+package dao
+
+import (
+	"github.com/genjidb/genji/document"
+
+	"go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/search"
+)
+
+// Types of the search index documents.
+const (
+	SearchTypeAccount = "account"
+	SearchTypeOrg     = "org"
+	SearchTypeProject = "project"
+
+	// SearchMetaOrgId is the meta of a project document holding its org.
+	SearchMetaOrgId = "org_id"
+)
+
+// SearchSources are the tables of the search index: the accounts by email, the orgs by name and contact,
+// the projects by name and org name. The soft deleted rows are left out.
+func SearchSources() []search.Source {
+	return []search.Source{
+		{Table: AccTableName, Type: SearchTypeAccount, Document: accountSearchDoc},
+		{Table: OrgTableName, Type: SearchTypeOrg, Document: orgSearchDoc},
+		{Table: ProjectTableName, Type: SearchTypeProject, Document: projectSearchDoc},
+	}
+}
+
+func accountSearchDoc(d document.Document) (search.Document, bool, error) {
+	var acc Account
+	if err := document.StructScan(d, &acc); err != nil {
+		return search.Document{}, false, err
+	}
+	return search.Document{
+		ID:     acc.ID,
+		Fields: []search.Field{{Name: "email", Text: acc.Email}},
+	}, acc.DeletedAt == 0, nil
+}
+
+func orgSearchDoc(d document.Document) (search.Document, bool, error) {
+	var org Org
+	if err := document.StructScan(d, &org); err != nil {
+		return search.Document{}, false, err
+	}
+	return search.Document{
+		ID: org.Id,
+		Fields: []search.Field{
+			{Name: "name", Text: org.Name, Boost: 2},
+			{Name: "contact", Text: org.Contact},
+		},
+	}, org.DeletedAt == 0, nil
+}
+
+func projectSearchDoc(d document.Document) (search.Document, bool, error) {
+	var p Project
+	if err := document.StructScan(d, &p); err != nil {
+		return search.Document{}, false, err
+	}
+	return search.Document{
+		ID: p.Id,
+		Fields: []search.Field{
+			{Name: "name", Text: p.Name, Boost: 2},
+			{Name: "org_name", Text: p.OrgName},
+		},
+		Meta: map[string]string{SearchMetaOrgId: p.OrgId},
+	}, p.DeletedAt == 0, nil
+}
@@ -0,0 +1,56 @@
+package dao_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	utilities "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
+	"go.amplifyedge.org/sys-share-v2/sys-core/service/logging/zaplog"
+	"go.amplifyedge.org/sys-v2/sys-account/service/go/pkg/dao"
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+	"go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/search"
+)
+
+func testSearchSources(t *testing.T) {
+	logger := zaplog.NewZapLogger(zaplog.DEBUG, "sys-account-dao-test", true, "")
+	db, err := coresvc.NewTestDB(logger)
+	require.NoError(t, err)
+	defer db.Close()
+	store, err := dao.NewAccountDB(db, logger)
+	require.NoError(t, err)
+
+	orgId, projId, accId := utilities.NewID(), utilities.NewID(), utilities.NewID()
+	require.NoError(t, store.InsertOrg(&dao.Org{Id: orgId, Name: "Acme Rockets", Contact: "sales@acme.example.com", LogoResourceId: orgId}))
+	require.NoError(t, store.InsertProject(&dao.Project{Id: projId, Name: "Lunar Lander", OrgId: orgId, OrgName: "Acme Rockets", LogoResourceId: projId}))
+
+	ix := search.NewIndex()
+	syncer := search.NewSyncer(db, ix, logger, dao.SearchSources()...)
+	require.NoError(t, syncer.Start(context.Background()))
+	defer syncer.Close()
+
+	hits := ix.Search(search.Query{Text: "acme"})
+	require.Len(t, hits, 2)
+	// the org name is boosted above the org name of the project
+	assert.Equal(t, dao.SearchTypeOrg, hits[0].Type)
+	assert.Equal(t, orgId, hits[0].ID)
+	assert.Equal(t, dao.SearchTypeProject, hits[1].Type)
+	assert.Equal(t, orgId, hits[1].Meta[dao.SearchMetaOrgId])
+	assert.Len(t, ix.Search(search.Query{Text: "lunr lander"}), 1)
+
+	require.NoError(t, store.InsertAccount(&dao.Account{ID: accId, Email: "wile.coyote@acme.example.com", AvatarResourceId: accId}))
+	assert.Eventually(t, func() bool {
+		hits := ix.Search(search.Query{Text: "coyot", Types: []string{dao.SearchTypeAccount}})
+		return len(hits) == 1 && hits[0].ID == accId
+	}, 5*time.Second, 20*time.Millisecond)
+
+	// soft deleted rows leave the index
+	require.NoError(t, store.DeleteOrg(orgId))
+	require.NoError(t, store.DeleteAccount(accId))
+	assert.Eventually(t, func() bool {
+		return len(ix.Search(search.Query{Text: "acme"})) == 0
+	}, 5*time.Second, 20*time.Millisecond)
+}
@@ -0,0 +1,132 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/genjidb/genji/database"
+	"github.com/genjidb/genji/document"
+
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+)
+
+// Accounts, orgs and projects are soft deleted: deleted_at is set to the time of the
+// delete and the row is left out of every query until it is purged after the grace period.
+// The roles of an account are soft deleted along with it.
+// genji has no partial index, so the unique columns of a deleted row, the email of an account
+// or the name of an org or a project, stay taken until it is purged and it can be restored.
+const deletedAtColumn = "deleted_at"
+
+// ErrNotDeleted is returned when restoring a row which does not exist or is not deleted.
+var ErrNotDeleted = errors.New("no such deleted row")
+
+var (
+	notDeleted = sq.Eq{deletedAtColumn: nil}
+	isDeleted  = sq.NotEq{deletedAtColumn: nil}
+)
+
+// withNotDeleted adds the exclusion of deleted rows to the scope of a list.
+func withNotDeleted(scope *coresvc.Filter) *coresvc.Filter {
+	return coresvc.AndFilters(scope, &coresvc.Filter{Field: deletedAtColumn, Op: coresvc.FilterIsNull})
+}
+
+func softDeleteStmt(table string, where sq.Sqlizer, at int64) (coresvc.Statement, error) {
+	return coresvc.NewStatement(sq.Update(table).Set(deletedAtColumn, at).Where(sq.And{where, notDeleted}))
+}
+
+// undeleteStmt clears deleted_at, squirrel has no UNSET so the statement is built by hand.
+func undeleteStmt(table string, where sq.Sqlizer) (coresvc.Statement, error) {
+	cond, args, err := sq.And{where, isDeleted}.ToSql()
+	if err != nil {
+		return coresvc.Statement{}, err
+	}
+	return coresvc.Statement{
+		Query: fmt.Sprintf("UPDATE %s UNSET %s WHERE %s", table, deletedAtColumn, cond),
+		Args:  args,
+	}, nil
+}
+
+// deletedAt returns when the row of table with id was deleted, it fails when the row
+// does not exist or is not deleted.
+func deletedAt(q coresvc.Querier, table, id string) (int64, error) {
+	stmt, args, err := sq.Select(deletedAtColumn).From(table).Where(sq.And{sq.Eq{"id": id}, isDeleted}).ToSql()
+	if err != nil {
+		return 0, err
+	}
+	doc, err := q.QueryOne(stmt, args...)
+	if errors.Is(err, database.ErrDocumentNotFound) {
+		return 0, fmt.Errorf("%s %s: %w", table, id, ErrNotDeleted)
+	}
+	if err != nil {
+		return 0, err
+	}
+	v, err := doc.Doc.GetByField(deletedAtColumn)
+	if err != nil {
+		return 0, err
+	}
+	at, _ := v.V.(int64)
+	return at, nil
+}
+
+// PurgeDeleted removes for good the accounts, orgs and projects deleted before the unix
+// timestamp, along with their roles.
+func (a *AccountDB) PurgeDeleted(ctx context.Context, before int64) error {
+	purged := sq.And{isDeleted, sq.LtOrEq{deletedAtColumn: before}}
+	return a.db.Update(ctx, func(tx *coresvc.Tx) error {
+		var stmts []coresvc.Statement
+		// the roles of the purged rows go first, in the same transaction
+		for _, ref := range []struct{ table, roleColumn string }{
+			{AccTableName, "account_id"},
+			{OrgTableName, "org_id"},
+			{ProjectTableName, "project_id"},
+		} {
+			ids, err := selectIds(tx, ref.table, purged)
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				rstmt, err := coresvc.NewStatement(sq.Delete(RolesTableName).Where(sq.Eq{ref.roleColumn: id}))
+				if err != nil {
+					return err
+				}
+				stmts = append(stmts, rstmt)
+			}
+		}
+		for _, table := range []string{ProjectTableName, OrgTableName, AccTableName} {
+			dstmt, err := coresvc.NewStatement(sq.Delete(table).Where(purged))
+			if err != nil {
+				return err
+			}
+			stmts = append(stmts, dstmt)
+		}
+		a.log.Debugf("purging accounts, orgs and projects deleted before %d", before)
+		return tx.ExecAll(stmts...)
+	})
+}
+
+// selectIds returns the ids of the rows of table matching where.
+func selectIds(tx *coresvc.Tx, table string, where sq.Sqlizer) ([]interface{}, error) {
+	stmt, args, err := sq.Select("id").From(table).Where(where).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	res, err := tx.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	var ids []interface{}
+	err = res.Iterate(func(d document.Document) error {
+		v, err := d.GetByField("id")
+		if err != nil {
+			return err
+		}
+		ids = append(ids, v.V)
+		return nil
+	})
+	if closeErr := res.Close(); err == nil {
+		err = closeErr
+	}
+	return ids, err
+}
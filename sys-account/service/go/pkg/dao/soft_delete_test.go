@@ -0,0 +1,91 @@
+package dao_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	utilities "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
+	"go.amplifyedge.org/sys-v2/sys-account/service/go/pkg/dao"
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+)
+
+func byId(id string) *coresvc.QueryParams {
+	return &coresvc.QueryParams{Params: map[string]interface{}{"id": id}}
+}
+
+func testUndelete(t *testing.T) {
+	// deleted rows are left out of gets and lists
+	_, err := accdb.GetOrg(byId(org1ID))
+	assert.Error(t, err)
+	_, err = accdb.GetProject(byId(proj2ID))
+	assert.Error(t, err)
+	_, err = accdb.GetAccount(byId(account0ID))
+	assert.Error(t, err)
+	projs, info, err := accdb.ListProject(context.Background(), nil, coresvc.PageRequest{})
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, info.Total)
+	assert.Equal(t, proj3ID, projs[0].Id)
+
+	// a project waits for its org to be restored
+	err = accdb.UndeleteProject(proj1ID)
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, dao.ErrNotDeleted))
+	assert.True(t, errors.Is(accdb.UndeleteOrg(org2ID), dao.ErrNotDeleted))
+
+	require.NoError(t, accdb.UndeleteOrg(org1ID))
+	_, err = accdb.GetOrg(byId(org1ID))
+	assert.NoError(t, err)
+	for _, id := range []string{proj1ID, proj2ID} {
+		_, err = accdb.GetProject(byId(id))
+		assert.NoError(t, err)
+	}
+	require.NoError(t, accdb.UndeleteAccount(account0ID))
+	_, err = accdb.GetAccount(byId(account0ID))
+	assert.NoError(t, err)
+	assert.True(t, errors.Is(accdb.UndeleteAccount(account0ID), dao.ErrNotDeleted))
+
+	// the roles of an account are deleted and restored along with it
+	orgMembers := &coresvc.QueryParams{Params: map[string]interface{}{"org_id": org1ID}}
+	require.NoError(t, accdb.InsertRole(&dao.Role{ID: utilities.NewID(), AccountId: account0ID, Role: 2, OrgId: org1ID}))
+	require.NoError(t, accdb.DeleteAccount(account0ID))
+	roles, err := accdb.ListRole(orgMembers)
+	require.NoError(t, err)
+	assert.Empty(t, roles)
+	require.NoError(t, accdb.UndeleteAccount(account0ID))
+	roles, err = accdb.ListRole(orgMembers)
+	require.NoError(t, err)
+	require.Len(t, roles, 1)
+	assert.Equal(t, account0ID, roles[0].AccountId)
+}
+
+func testPurgeDeleted(t *testing.T) {
+	ctx := context.Background()
+	require.NoError(t, accdb.DeleteProject(proj3ID))
+	require.NoError(t, accdb.DeleteAccount(accs[1].ID))
+	// rows deleted after the cutoff are kept
+	require.NoError(t, accdb.PurgeDeleted(ctx, utilities.CurrentTimestamp()-60))
+	require.NoError(t, accdb.UndeleteProject(proj3ID))
+
+	require.NoError(t, accdb.InsertRole(&dao.Role{ID: utilities.NewID(), AccountId: accs[2].ID, OrgId: org2ID, ProjectId: proj3ID}))
+	require.NoError(t, accdb.DeleteProject(proj3ID))
+	// the name of a deleted project stays taken until it is purged
+	sameName := &dao.Project{Id: utilities.NewID(), Name: projects[2].Name, OrgId: org2ID, LogoResourceId: utilities.NewID()}
+	assert.Error(t, accdb.InsertProject(sameName))
+
+	require.NoError(t, accdb.PurgeDeleted(ctx, utilities.CurrentTimestamp()))
+	assert.True(t, errors.Is(accdb.UndeleteProject(proj3ID), dao.ErrNotDeleted))
+	assert.True(t, errors.Is(accdb.UndeleteAccount(accs[1].ID), dao.ErrNotDeleted))
+	// the roles of the purged account and project are gone, not only soft deleted
+	for col, id := range map[string]string{"account_id": accs[1].ID, "project_id": proj3ID} {
+		_, err := testDb.QueryOne("SELECT id FROM "+dao.RolesTableName+" WHERE "+col+" = ?", id)
+		assert.Error(t, err, col)
+	}
+	require.NoError(t, accdb.InsertProject(sameName))
+	// the rows which are not deleted stay
+	_, err = accdb.GetProject(byId(proj1ID))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,93 @@
+package dao_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	utilities "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
+	"go.amplifyedge.org/sys-v2/sys-account/service/go/pkg/dao"
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+)
+
+func testLoginAttemptExpiry(t *testing.T) {
+	first, err := accdb.UpsertLoginAttempt("10.0.0.1", "2pac@example.com", 1, 0)
+	require.NoError(t, err)
+	assert.Greater(t, first.ExpiresAt, utilities.CurrentTimestamp())
+	_, err = accdb.UpsertLoginAttempt("10.0.0.2", "bigg@example.com", 6, 0)
+	require.NoError(t, err)
+
+	// the update only touches the attempts of its own address
+	_, err = accdb.UpsertLoginAttempt("10.0.0.2", "bigg@example.com", 7, 0)
+	require.NoError(t, err)
+	first, err = accdb.GetLoginAttempt("10.0.0.1")
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, first.TotalAttempts)
+
+	// a ban outlives the ttl
+	banEnd := utilities.CurrentTimestamp() + 7*24*3600
+	banned, err := accdb.UpsertLoginAttempt("10.0.0.3", "shakur@example.com", 6, banEnd)
+	require.NoError(t, err)
+	assert.Equal(t, banEnd, banned.ExpiresAt)
+
+	require.NoError(t, testDb.Exec("UPDATE login_attempts SET expires_at = ? WHERE origin_ip = ?", utilities.CurrentTimestamp()-1, "10.0.0.2"))
+	_, err = accdb.GetLoginAttempt("10.0.0.2")
+	assert.Error(t, err)
+	// an expired row is started over before it is swept
+	again, err := accdb.UpsertLoginAttempt("10.0.0.2", "bigg@example.com", 1, 0)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, again.TotalAttempts)
+
+	require.NoError(t, testDb.Exec("UPDATE login_attempts SET expires_at = ? WHERE origin_ip = ?", utilities.CurrentTimestamp()-1, "10.0.0.1"))
+	require.NoError(t, testDb.SweepExpired(context.Background()))
+	_, err = testDb.QueryOne("SELECT origin_ip FROM login_attempts WHERE origin_ip = ?", "10.0.0.1")
+	assert.Error(t, err)
+	_, err = accdb.GetLoginAttempt("10.0.0.3")
+	assert.NoError(t, err)
+}
+
+func testLoginAttemptMigration(t *testing.T) {
+	_, err := testDb.MigrateDown(1)
+	require.NoError(t, err)
+	// the attempts written before they expired, one of them banned for a week
+	banEnd := utilities.CurrentTimestamp() + 7*24*3600
+	require.NoError(t, testDb.Exec("INSERT INTO login_attempts (origin_ip, account_email, total_attempts, ban_period) VALUES (?, ?, ?, ?)",
+		"10.0.1.1", "2pac@example.com", 2, 0))
+	require.NoError(t, testDb.Exec("INSERT INTO login_attempts (origin_ip, account_email, total_attempts, ban_period) VALUES (?, ?, ?, ?)",
+		"10.0.1.2", "bigg@example.com", 6, banEnd))
+	_, err = testDb.MigrateUp(0)
+	require.NoError(t, err)
+
+	// they stay until the ttl or the ban is over
+	attempt, err := accdb.GetLoginAttempt("10.0.1.1")
+	require.NoError(t, err)
+	assert.Greater(t, attempt.ExpiresAt, utilities.CurrentTimestamp())
+	assert.Less(t, attempt.ExpiresAt, banEnd)
+	banned, err := accdb.GetLoginAttempt("10.0.1.2")
+	require.NoError(t, err)
+	assert.Equal(t, banEnd, banned.ExpiresAt)
+}
+
+func testVerificationTokenExpiry(t *testing.T) {
+	acc := &dao.Account{ID: utilities.NewID(), Email: "biggie@example.com", Password: "ready_to_die"}
+	require.NoError(t, accdb.InsertAccount(acc))
+	acc.SetVerificationToken("fresh_token")
+	require.NoError(t, accdb.UpdateAccount(acc))
+	assert.True(t, acc.CheckVerificationToken("fresh_token"))
+	assert.False(t, acc.CheckVerificationToken("other_token"))
+	assert.False(t, (&dao.Account{}).CheckVerificationToken(""))
+
+	require.NoError(t, testDb.Exec("UPDATE accounts SET verification_token_expires_at = ? WHERE id = ?", utilities.CurrentTimestamp()-1, acc.ID))
+	acc, err = accdb.GetAccount(&coresvc.QueryParams{Params: map[string]interface{}{"id": acc.ID}})
+	require.NoError(t, err)
+	assert.False(t, acc.CheckVerificationToken("fresh_token"))
+
+	// the sweeper clears the token and keeps the account
+	require.NoError(t, testDb.SweepExpired(context.Background()))
+	acc, err = accdb.GetAccount(&coresvc.QueryParams{Params: map[string]interface{}{"id": acc.ID}})
+	require.NoError(t, err)
+	assert.Empty(t, acc.VerificationToken)
+	assert.Zero(t, acc.VerificationTokenExpiresAt)
+}
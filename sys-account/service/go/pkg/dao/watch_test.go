@@ -0,0 +1,60 @@
+package dao_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	utilities "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
+	"go.amplifyedge.org/sys-v2/sys-account/service/go/pkg/dao"
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+)
+
+// watchStream keeps the first event sent and ends the watch.
+type watchStream struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	event  *coresvc.WatchEvent
+}
+
+func (s *watchStream) Context() context.Context { return s.ctx }
+
+func (s *watchStream) Send(ev *coresvc.WatchEvent) error {
+	s.event = ev
+	s.cancel()
+	return nil
+}
+
+func testAccountWatch(t *testing.T) {
+	all := coresvc.NewAllDBService()
+	all.RegisterCoreDB(testDb)
+	stream := &watchStream{}
+	stream.ctx, stream.cancel = context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- all.Watch(&coresvc.WatchRequest{Tables: []string{dao.AccTableName}}, stream)
+	}()
+
+	// the watch subscribes asynchronously, keep writing until it sees a change
+	deadline := time.Now().Add(5 * time.Second)
+	for watching := true; watching; {
+		require.True(t, time.Now().Before(deadline), "no change event")
+		require.NoError(t, testDb.Exec("UPDATE "+dao.AccTableName+" SET last_login = ? WHERE id = ?", utilities.CurrentTimestamp(), accs[2].ID))
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+			watching = false
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	require.NotNil(t, stream.event)
+	assert.Equal(t, string(coresvc.ChangeUpdate), stream.event.Op)
+	for _, doc := range []string{stream.event.Doc, stream.event.Old} {
+		assert.Contains(t, doc, accs[2].Email)
+		assert.NotContains(t, doc, "password")
+		assert.NotContains(t, doc, "verification_token")
+	}
+}
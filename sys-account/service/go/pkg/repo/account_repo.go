@@ -85,81 +85,54 @@ func (ad *SysAccountRepo) GetAccount(ctx context.Context, in *rpc.IdRequest) (*r
 }
 
 func (ad *SysAccountRepo) ListAccounts(ctx context.Context, in *rpc.ListAccountsRequest) (*rpc.ListAccountsResponse, error) {
-	var limit, cursor int64
-	var err error
 	if in == nil {
 		return &rpc.ListAccountsResponse{}, status.Errorf(codes.InvalidArgument, "cannot list user accounts: %v", sharedAuth.Error{Reason: sharedAuth.ErrInvalidParameters})
 	}
-	limit = in.PerPageEntries
-	filter, err := ad.allowListAccount(ctx)
+	allowed, err := ad.allowListAccount(ctx)
 	if err != nil {
 		return nil, err
 	}
-	orderBy := in.OrderBy
-	if in.IsDescending {
-		orderBy += " DESC"
-	} else {
-		orderBy += " ASC"
-	}
-	cursor, err = ad.getCursor(in.CurrentPageId)
+	scope, err := accountScope(allowed, in.Matcher)
 	if err != nil {
 		return nil, err
 	}
-
-	if in.PerPageEntries == 0 {
-		limit = dao.DefaultLimit
-	}
-
-	accounts, next, err := ad.listAccountsAndRoles(ctx, filter, orderBy, limit, cursor, in.Matcher)
+	page := pageRequest(in.PerPageEntries, in.OrderBy, in.IsDescending, in.CurrentPageId)
+	accounts, info, err := ad.listAccountsAndRoles(ctx, scope, nil, page)
 	if err != nil {
 		return nil, err
 	}
-
+	setPageHeaders(ctx, info)
 	return &rpc.ListAccountsResponse{
 		Accounts:   accounts,
-		NextPageId: fmt.Sprintf("%d", next),
+		NextPageId: info.NextCursor,
 	}, nil
 }
 
 // TODO @gutterbacon: In the absence of actual enforcement policy function, this method is a stub. We allow everyone to query anything at this point.
 func (ad *SysAccountRepo) SearchAccounts(ctx context.Context, in *rpc.SearchAccountsRequest) (*rpc.SearchAccountsResponse, error) {
-	var limit, cursor int64
-	var err error
 	if in == nil {
 		return &rpc.SearchAccountsResponse{}, status.Errorf(codes.InvalidArgument, "cannot search user accounts: %v", sharedAuth.Error{Reason: sharedAuth.ErrInvalidParameters})
 	}
-	filter, err := ad.allowListAccount(ctx)
+	allowed, err := ad.allowListAccount(ctx)
 	if err != nil {
 		return nil, err
 	}
-	query := map[string]interface{}{}
-	if err := utilities.UnmarshalJson(in.GetQuery(), &query); err != nil {
-		return nil, err
-	}
-	for k, v := range query {
-		filter.Params[k] = v
-	}
-	orderBy := in.GetSearchParams().GetOrderBy()
-	if in.GetSearchParams().IsDescending {
-		orderBy += " DESC"
-	} else {
-		orderBy += " ASC"
-	}
-	cursor, err = ad.getCursor(in.GetSearchParams().CurrentPageId)
+	params := in.GetSearchParams()
+	filter, err := coresvc.ParseFilter(in.GetQuery(), params.GetMatcher())
 	if err != nil {
-		return nil, err
-	}
-	if in.GetSearchParams().PerPageEntries == 0 {
-		limit = dao.DefaultLimit
+		return nil, listError("cannot search user accounts", err)
 	}
-	accounts, next, err := ad.listAccountsAndRoles(ctx, filter, orderBy, limit, cursor, in.GetSearchParams().Matcher)
+	page := pageRequest(params.GetPerPageEntries(), params.GetOrderBy(), params.GetIsDescending(), params.GetCurrentPageId())
+	// the matcher is the one of the query, the authz params are matched exactly
+	accounts, info, err := ad.listAccountsAndRoles(ctx, coresvc.FilterFromParams(allowed.Params, "eq"), filter, page)
 	if err != nil {
 		return nil, err
 	}
+	setPageHeaders(ctx, info)
 	return &rpc.SearchAccountsResponse{
 		SearchResponse: &rpc.ListAccountsResponse{
 			Accounts:   accounts,
-			NextPageId: fmt.Sprintf("%d", next),
+			NextPageId: info.NextCursor,
 		},
 	}, nil
 }
@@ -376,3 +349,17 @@ func (ad *SysAccountRepo) DeleteAccount(ctx context.Context, in *rpc.DisableAcco
 	}
 	return &emptypb.Empty{}, nil
 }
+
+// UndeleteAccount restores a deleted account within the grace period, superadmins only.
+func (ad *SysAccountRepo) UndeleteAccount(ctx context.Context, in *rpc.IdRequest) (*rpc.Account, error) {
+	if in == nil || in.Id == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "cannot undelete account: %v", sharedAuth.Error{Reason: sharedAuth.ErrInvalidParameters})
+	}
+	if err := ad.allowUndelete(ctx); err != nil {
+		return nil, err
+	}
+	if err := ad.store.UndeleteAccount(in.Id); err != nil {
+		return nil, undeleteError("cannot undelete account", err)
+	}
+	return ad.getAccountAndRole(ctx, in.Id, "")
+}
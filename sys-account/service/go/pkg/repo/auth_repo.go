@@ -165,7 +165,7 @@ func (ad *SysAccountRepo) genVerificationToken(param *coredb.QueryParams) (strin
 	if err != nil {
 		return "", nil, err
 	}
-	acc.VerificationToken = vtoken
+	acc.SetVerificationToken(vtoken)
 	err = ad.store.UpdateAccount(acc)
 	if err != nil {
 		return "", nil, err
@@ -201,7 +201,7 @@ func (ad *SysAccountRepo) Login(ctx context.Context, in *rpc.LoginRequest) (*rpc
 	u, err := ad.getAndVerifyAccount(ctx, in)
 	if err != nil {
 		if loginAttempts.TotalAttempts >= 5 {
-			loginAttempts, _ = ad.store.UpsertLoginAttempt(loginAttempts.OriginIP, loginAttempts.AccountEmail, loginAttempts.TotalAttempts+1, utilities.CurrentTimestamp()+banDuration.Nanoseconds())
+			loginAttempts, _ = ad.store.UpsertLoginAttempt(loginAttempts.OriginIP, loginAttempts.AccountEmail, loginAttempts.TotalAttempts+1, utilities.CurrentTimestamp()+int64(banDuration.Seconds()))
 		} else {
 			loginAttempts, _ = ad.store.UpsertLoginAttempt(loginAttempts.OriginIP, loginAttempts.AccountEmail, loginAttempts.TotalAttempts+1, 0)
 		}
@@ -340,8 +340,8 @@ func (ad *SysAccountRepo) ResetPassword(ctx context.Context, in *rpc.ResetPasswo
 		}, err
 	}
 	ad.log.Debugf("reset password account: %v", *acc)
-	if acc.VerificationToken != in.VerifyToken {
-		ad.log.Debugf("mismatch verification token: wanted %s\n got: %s", acc.VerificationToken, in.VerifyToken)
+	if !acc.CheckVerificationToken(in.VerifyToken) {
+		ad.log.Debugf("mismatch or expired verification token: wanted %s\n got: %s", acc.VerificationToken, in.VerifyToken)
 		return &rpc.ResetPasswordResponse{
 			Success:                  false,
 			SuccessMsg:               "",
@@ -384,7 +384,7 @@ func (ad *SysAccountRepo) VerifyAccount(ctx context.Context, in *rpc.VerifyAccou
 	if err != nil {
 		return nil, err
 	}
-	if acc.VerificationToken != in.VerifyToken {
+	if !acc.CheckVerificationToken(in.VerifyToken) {
 		return nil, status.Errorf(codes.InvalidArgument, "cannot verify account: %v", sharedAuth.Error{Reason: sharedAuth.ErrVerificationTokenMismatch})
 	}
 	acc.Verified = true
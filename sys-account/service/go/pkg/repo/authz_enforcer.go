@@ -169,6 +169,18 @@ func (ad *SysAccountRepo) allowAssignToRole(ctx context.Context, in *rpc.AssignA
 	return status.Errorf(codes.PermissionDenied, sharedAuth.Error{Reason: sharedAuth.ErrRequestUnauthenticated, Err: err}.Error())
 }
 
+// only allow superadmin to restore deleted accounts, orgs and projects.
+func (ad *SysAccountRepo) allowUndelete(ctx context.Context) error {
+	_, curAcc, err := ad.accountFromClaims(ctx)
+	if err != nil {
+		return status.Errorf(codes.Unauthenticated, sharedAuth.Error{Reason: sharedAuth.ErrRequestUnauthenticated, Err: err}.Error())
+	}
+	if sharedAuth.IsSuperadmin(curAcc.GetRoles()) {
+		return nil
+	}
+	return status.Errorf(codes.PermissionDenied, sharedAuth.Error{Reason: sharedAuth.ErrRequestUnauthenticated, Err: err}.Error())
+}
+
 // only allow superadmin to create new org.
 func (ad *SysAccountRepo) allowNewOrg(ctx context.Context) error {
 	_, curAcc, err := ad.accountFromClaims(ctx)
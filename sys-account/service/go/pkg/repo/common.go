@@ -2,12 +2,16 @@ package repo
 
 import (
 	"context"
+	"errors"
 	rpc "go.amplifyedge.org/sys-share-v2/sys-account/service/go/rpc/v2"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"strconv"
 
 	sharedAuth "go.amplifyedge.org/sys-share-v2/sys-account/service/go/pkg/shared"
+	"go.amplifyedge.org/sys-v2/sys-account/service/go/pkg/dao"
 	"go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
 	fileDao "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/filesvc/dao"
 )
@@ -53,10 +57,21 @@ func (ad *SysAccountRepo) getAccountAndRole(ctx context.Context, id, email strin
 	return acc.ToRpcAccount(pkgRoles, nil)
 }
 
-func (ad *SysAccountRepo) listAccountsAndRoles(ctx context.Context, filter *coredb.QueryParams, orderBy string, limit, cursor int64, sqlMatcher string) ([]*rpc.Account, *int64, error) {
-	listAccounts, next, err := ad.store.ListAccount(filter, orderBy, limit, cursor, sqlMatcher)
+// accountScope matches the authz params with the matcher of the request. It may only narrow
+// them: eq, like or the default, like.
+func accountScope(allowed *coredb.QueryParams, matcher string) (*coredb.Filter, error) {
+	switch coredb.ToSnakeCase(matcher) {
+	case "", "eq", "like":
+		return coredb.FilterFromParams(allowed.Params, matcher), nil
+	}
+	return nil, status.Errorf(codes.InvalidArgument, "cannot list user accounts: matcher %q does not apply to the allowed accounts", matcher)
+}
+
+// listAccountsAndRoles lists the accounts within the authz scope which match the filter.
+func (ad *SysAccountRepo) listAccountsAndRoles(ctx context.Context, scope, filter *coredb.Filter, page coredb.PageRequest) ([]*rpc.Account, *coredb.PageInfo, error) {
+	listAccounts, info, err := ad.store.ListAccount(ctx, scope, filter, page)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, listError("cannot list user accounts", err)
 	}
 	var accounts []*rpc.Account
 
@@ -93,7 +108,7 @@ func (ad *SysAccountRepo) listAccountsAndRoles(ctx context.Context, filter *core
 	}
 
 	// superuser
-	if len(filter.Params) == 0 {
+	if scope == nil && filter == nil {
 		supers, err := ad.superDao.List(ctx, "")
 		if err != nil {
 			return nil, nil, err
@@ -101,13 +116,47 @@ func (ad *SysAccountRepo) listAccountsAndRoles(ctx context.Context, filter *core
 		accounts = append(accounts, supers...)
 	}
 
-	return accounts, &next, nil
+	return accounts, info, nil
+}
+
+const (
+	totalCountHeader = "x-total-count"
+	hasMoreHeader    = "x-has-more"
+)
+
+// pageRequest reads the paging fields of a list request, the page ids are opaque cursors.
+func pageRequest(perPageEntries int64, orderBy string, isDescending bool, currentPageId string) coredb.PageRequest {
+	return coredb.PageRequest{
+		OrderBy:    orderBy,
+		Descending: isDescending,
+		Limit:      perPageEntries,
+		Cursor:     currentPageId,
+	}
+}
+
+// setPageHeaders sends the total count and whether more pages follow as response headers,
+// the list responses only carry the id of the next page. The total count is only sent with
+// the first page.
+func setPageHeaders(ctx context.Context, info *coredb.PageInfo) {
+	md := metadata.Pairs(hasMoreHeader, strconv.FormatBool(info.HasMore))
+	if info.Total >= 0 {
+		md.Set(totalCountHeader, strconv.FormatInt(info.Total, 10))
+	}
+	// fails outside of a gRPC call, the response is still complete
+	_ = grpc.SetHeader(ctx, md)
+}
+
+// undeleteError maps the errors of restoring a deleted row to a status.
+func undeleteError(msg string, err error) error {
+	if errors.Is(err, dao.ErrNotDeleted) {
+		return status.Errorf(codes.NotFound, "%s: %v", msg, err)
+	}
+	return status.Errorf(codes.FailedPrecondition, "%s: %v", msg, err)
 }
 
-func (ad *SysAccountRepo) getCursor(currentCursor string) (int64, error) {
-	if currentCursor != "" {
-		return strconv.ParseInt(currentCursor, 10, 64)
-	} else {
-		return 0, nil
+func listError(msg string, err error) error {
+	if coredb.IsInvalidQuery(err) {
+		return status.Errorf(codes.InvalidArgument, "%s: %v", msg, err)
 	}
+	return err
 }
@@ -2,7 +2,6 @@ package repo
 
 import (
 	"context"
-	"fmt"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
@@ -54,14 +53,14 @@ func (ad *SysAccountRepo) NewOrg(ctx context.Context, in *rpc.OrgRequest) (*rpc.
 	return org.ToRpcOrg(nil, logoFile.Binary)
 }
 
-func (ad *SysAccountRepo) orgFetchProjects(org *dao.Org) (*rpc.Org, error) {
+func (ad *SysAccountRepo) orgFetchProjects(ctx context.Context, org *dao.Org) (*rpc.Org, error) {
 	orgLogo, err := ad.frepo.DownloadFile("", org.LogoResourceId)
 	if err != nil {
 		return nil, err
 	}
-	projects, _, err := ad.store.ListProject(
-		&coresvc.QueryParams{Params: map[string]interface{}{"org_id": org.Id}},
-		"name ASC", dao.DefaultLimit, 0, "eq",
+	projects, _, err := ad.store.ListProject(ctx,
+		&coresvc.Filter{Field: "org_id", Op: coresvc.FilterEq, Value: org.Id},
+		coresvc.PageRequest{OrderBy: "name", Limit: dao.DefaultLimit},
 	)
 	if err != nil {
 		if err.Error() == "document not found" {
@@ -102,46 +101,34 @@ func (ad *SysAccountRepo) GetOrg(ctx context.Context, in *rpc.IdRequest) (*rpc.O
 	if err != nil {
 		return nil, err
 	}
-	return ad.orgFetchProjects(org)
+	return ad.orgFetchProjects(ctx, org)
 }
 
 func (ad *SysAccountRepo) ListOrg(ctx context.Context, in *rpc.ListRequest) (*rpc.ListResponse, error) {
 	if in == nil {
 		return nil, status.Errorf(codes.InvalidArgument, "cannot list org: %v", sharedAuth.Error{Reason: sharedAuth.ErrInvalidParameters})
 	}
-	var limit, cursor int64
-	limit = in.PerPageEntries
-	orderBy := in.OrderBy
-	var err error
-	filtersJson := map[string]interface{}{}
-	if err = sharedConfig.UnmarshalJson(in.GetFilters(), &filtersJson); err != nil {
-		return nil, err
-	}
-	filter := &coresvc.QueryParams{Params: filtersJson}
-	if in.IsDescending {
-		orderBy += " DESC"
-	} else {
-		orderBy += " ASC"
-	}
-	cursor, err = ad.getCursor(in.CurrentPageId)
+	filter, err := coresvc.ParseFilter(in.GetFilters(), in.Matcher)
 	if err != nil {
-		return nil, err
+		return nil, listError("cannot list org", err)
 	}
-	if limit == 0 {
-		limit = dao.DefaultLimit
+	page := pageRequest(in.PerPageEntries, in.OrderBy, in.IsDescending, in.CurrentPageId)
+	orgs, info, err := ad.store.ListOrg(ctx, filter, page)
+	if err != nil {
+		return nil, listError("cannot list org", err)
 	}
-	orgs, next, err := ad.store.ListOrg(filter, orderBy, limit, cursor, in.Matcher)
 	var pkgOrgs []*rpc.Org
 	for _, org := range orgs {
-		pkgOrg, err := ad.orgFetchProjects(org)
+		pkgOrg, err := ad.orgFetchProjects(ctx, org)
 		if err != nil {
 			return nil, err
 		}
 		pkgOrgs = append(pkgOrgs, pkgOrg)
 	}
+	setPageHeaders(ctx, info)
 	return &rpc.ListResponse{
 		Orgs:       pkgOrgs,
-		NextPageId: fmt.Sprintf("%d", next),
+		NextPageId: info.NextCursor,
 	}, nil
 }
 
@@ -149,39 +136,27 @@ func (ad *SysAccountRepo) ListNonSubscribedOrgs(ctx context.Context, in *rpc.Lis
 	if in == nil {
 		return nil, status.Errorf(codes.InvalidArgument, "cannot list org: %v", sharedAuth.Error{Reason: sharedAuth.ErrInvalidParameters})
 	}
-	var limit, cursor int64
-	limit = in.PerPageEntries
-	orderBy := in.OrderBy
-	var err error
-	filtersJson := map[string]interface{}{}
-	if err = sharedConfig.UnmarshalJson(in.GetFilters(), &filtersJson); err != nil {
-		return nil, err
-	}
-	filter := &coresvc.QueryParams{Params: filtersJson}
-	if in.IsDescending {
-		orderBy += " DESC"
-	} else {
-		orderBy += " ASC"
-	}
-	cursor, err = ad.getCursor(in.CurrentPageId)
+	filter, err := coresvc.ParseFilter(in.GetFilters(), in.Matcher)
 	if err != nil {
-		return nil, err
+		return nil, listError("cannot list org", err)
 	}
-	if limit == 0 {
-		limit = dao.DefaultLimit
+	page := pageRequest(in.PerPageEntries, in.OrderBy, in.IsDescending, in.CurrentPageId)
+	orgs, info, err := ad.store.ListNonSubbed(ctx, in.AccountId, filter, page)
+	if err != nil {
+		return nil, listError("cannot list org", err)
 	}
-	orgs, next, err := ad.store.ListNonSubbed(in.AccountId, filter, orderBy, limit, cursor)
 	var pkgOrgs []*rpc.Org
 	for _, org := range orgs {
-		pkgOrg, err := ad.orgFetchProjects(org)
+		pkgOrg, err := ad.orgFetchProjects(ctx, org)
 		if err != nil {
 			return nil, err
 		}
 		pkgOrgs = append(pkgOrgs, pkgOrg)
 	}
+	setPageHeaders(ctx, info)
 	return &rpc.ListResponse{
 		Orgs:       pkgOrgs,
-		NextPageId: fmt.Sprintf("%d", next),
+		NextPageId: info.NextCursor,
 	}, nil
 }
 
@@ -215,7 +190,7 @@ func (ad *SysAccountRepo) UpdateOrg(ctx context.Context, in *rpc.OrgUpdateReques
 		return nil, err
 	}
 	org, err = ad.store.GetOrg(&coresvc.QueryParams{Params: map[string]interface{}{"id": org.Id}})
-	return ad.orgFetchProjects(org)
+	return ad.orgFetchProjects(ctx, org)
 }
 
 func (ad *SysAccountRepo) DeleteOrg(ctx context.Context, in *rpc.IdRequest) (*emptypb.Empty, error) {
@@ -229,14 +204,24 @@ func (ad *SysAccountRepo) DeleteOrg(ctx context.Context, in *rpc.IdRequest) (*em
 	if err = ad.allowUpdateDeleteOrg(ctx, org.Id); err != nil {
 		return nil, err
 	}
-	for _, proj := range org.Projects {
-		if _, err = ad.DeleteProject(ctx, &rpc.IdRequest{Id: proj.Id}); err != nil {
-			return nil, err
-		}
-	}
+	// the projects of the org are deleted along with it
 	err = ad.store.DeleteOrg(in.Id)
 	if err != nil {
 		return nil, err
 	}
 	return &emptypb.Empty{}, nil
 }
+
+// UndeleteOrg restores a deleted org and the projects deleted with it, superadmins only.
+func (ad *SysAccountRepo) UndeleteOrg(ctx context.Context, in *rpc.IdRequest) (*rpc.Org, error) {
+	if in == nil || in.Id == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "cannot undelete org: %v", sharedAuth.Error{Reason: sharedAuth.ErrInvalidParameters})
+	}
+	if err := ad.allowUndelete(ctx); err != nil {
+		return nil, err
+	}
+	if err := ad.store.UndeleteOrg(in.Id); err != nil {
+		return nil, undeleteError("cannot undelete org", err)
+	}
+	return ad.GetOrg(ctx, in)
+}
@@ -2,7 +2,6 @@ package repo
 
 import (
 	"context"
-	"fmt"
 
 	sharedConfig "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
 	"go.amplifyedge.org/sys-v2/sys-account/service/go/pkg/dao"
@@ -103,28 +102,15 @@ func (ad *SysAccountRepo) ListProject(ctx context.Context, in *rpc.ListRequest)
 	if in == nil {
 		return nil, status.Errorf(codes.InvalidArgument, "cannot list project: %v", sharedAuth.Error{Reason: sharedAuth.ErrInvalidParameters})
 	}
-	var limit, cursor int64
-	limit = in.PerPageEntries
-	orderBy := in.OrderBy
-	var err error
-	filtersJson := map[string]interface{}{}
-	if err = sharedConfig.UnmarshalJson(in.GetFilters(), &filtersJson); err != nil {
-		return nil, err
-	}
-	filter := &coresvc.QueryParams{Params: filtersJson}
-	if in.IsDescending {
-		orderBy += " DESC"
-	} else {
-		orderBy += " ASC"
-	}
-	cursor, err = ad.getCursor(in.CurrentPageId)
+	filter, err := coresvc.ParseFilter(in.GetFilters(), in.Matcher)
 	if err != nil {
-		return nil, err
+		return nil, listError("cannot list project", err)
 	}
-	if limit == 0 {
-		limit = dao.DefaultLimit
+	page := pageRequest(in.PerPageEntries, in.OrderBy, in.IsDescending, in.CurrentPageId)
+	projects, info, err := ad.store.ListProject(ctx, filter, page)
+	if err != nil {
+		return nil, listError("cannot list project", err)
 	}
-	projects, next, err := ad.store.ListProject(filter, orderBy, limit, cursor, in.Matcher)
 	var pkgProjects []*rpc.Project
 	for _, p := range projects {
 		pkgProject, err := ad.projectFetchOrg(p)
@@ -133,9 +119,10 @@ func (ad *SysAccountRepo) ListProject(ctx context.Context, in *rpc.ListRequest)
 		}
 		pkgProjects = append(pkgProjects, pkgProject)
 	}
+	setPageHeaders(ctx, info)
 	return &rpc.ListResponse{
 		Projects:   pkgProjects,
-		NextPageId: fmt.Sprintf("%d", next),
+		NextPageId: info.NextCursor,
 	}, nil
 }
 
@@ -188,3 +175,18 @@ func (ad *SysAccountRepo) DeleteProject(ctx context.Context, in *rpc.IdRequest)
 	}
 	return &emptypb.Empty{}, nil
 }
+
+// UndeleteProject restores a deleted project, superadmins only. The org of the project
+// has to be restored first when it is deleted too.
+func (ad *SysAccountRepo) UndeleteProject(ctx context.Context, in *rpc.IdRequest) (*rpc.Project, error) {
+	if in == nil || in.Id == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "cannot undelete project: %v", sharedAuth.Error{Reason: sharedAuth.ErrInvalidParameters})
+	}
+	if err := ad.allowUndelete(ctx); err != nil {
+		return nil, err
+	}
+	if err := ad.store.UndeleteProject(in.Id); err != nil {
+		return nil, undeleteError("cannot undelete project", err)
+	}
+	return ad.GetProject(ctx, in)
+}
@@ -0,0 +1,178 @@
+package repo
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	sharedAuth "go.amplifyedge.org/sys-share-v2/sys-account/service/go/pkg/shared"
+	rpc "go.amplifyedge.org/sys-share-v2/sys-account/service/go/rpc/v2"
+	"go.amplifyedge.org/sys-v2/sys-account/service/go/pkg/dao"
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+	"go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/search"
+)
+
+// maxSearchLimit bounds the hits of a search, each one is fetched from the database.
+const maxSearchLimit = 100
+
+// SearchRequest is a full-text search over the accounts, orgs and projects.
+type SearchRequest struct {
+	Query string `json:"query"`
+	// Types restricts the hits to "account", "org" or "project", all of them if empty.
+	Types []string `json:"types"`
+	// Limit is the number of hits, 20 by default and 100 at most.
+	Limit int `json:"limit"`
+}
+
+// SearchHit is a match of a search, with the account, the org or the project matched.
+type SearchHit struct {
+	Type    string       `json:"type"`
+	Id      string       `json:"id"`
+	Score   float64      `json:"score"`
+	Account *rpc.Account `json:"account,omitempty"`
+	Org     *rpc.Org     `json:"org,omitempty"`
+	Project *rpc.Project `json:"project,omitempty"`
+}
+
+// SearchResponse holds the hits of a search, best first.
+type SearchResponse struct {
+	Hits []*SearchHit `json:"hits"`
+}
+
+// searchScope is what a caller may find: superadmins everything, the others the orgs and projects
+// they have a role in, with all the projects of the orgs they have an org role in, their own account
+// and the accounts of the orgs and projects they administer.
+type searchScope struct {
+	all                      bool
+	accounts, orgs, projects map[string]bool
+	// orgProjects holds the orgs whose projects are all visible
+	orgProjects map[string]bool
+}
+
+func (s *searchScope) allow(h *search.Hit) bool {
+	if s.all {
+		return true
+	}
+	switch h.Type {
+	case dao.SearchTypeAccount:
+		return s.accounts[h.ID]
+	case dao.SearchTypeOrg:
+		return s.orgs[h.ID]
+	case dao.SearchTypeProject:
+		return s.projects[h.ID] || s.orgProjects[h.Meta[dao.SearchMetaOrgId]]
+	}
+	return false
+}
+
+// Search looks up the accounts by email, the orgs by name or contact and the projects by name
+// or org name in the full-text index, keeping the ones the caller is allowed to see.
+// The last word of the query matches as a prefix and the longer words tolerate typos.
+func (ad *SysAccountRepo) Search(ctx context.Context, in *SearchRequest) (*SearchResponse, error) {
+	if in == nil || in.Query == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "cannot search: %v", sharedAuth.Error{Reason: sharedAuth.ErrInvalidParameters})
+	}
+	for _, typ := range in.Types {
+		if typ != dao.SearchTypeAccount && typ != dao.SearchTypeOrg && typ != dao.SearchTypeProject {
+			return nil, status.Errorf(codes.InvalidArgument, "cannot search: unknown type %q", typ)
+		}
+	}
+	limit := in.Limit
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+	scope, err := ad.searchScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hits := ad.index.Search(search.Query{Text: in.Query, Types: in.Types, Filter: scope.allow, Limit: limit})
+	resp := &SearchResponse{Hits: make([]*SearchHit, 0, len(hits))}
+	for _, h := range hits {
+		hit, err := ad.searchHit(ctx, h)
+		if err != nil {
+			// removed since it was indexed, the index catches up on its own
+			ad.log.Debugf("skipping search hit %s %s: %v", h.Type, h.ID, err)
+			continue
+		}
+		resp.Hits = append(resp.Hits, hit)
+	}
+	return resp, nil
+}
+
+func (ad *SysAccountRepo) searchScope(ctx context.Context) (*searchScope, error) {
+	_, curAcc, err := ad.accountFromClaims(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, sharedAuth.Error{Reason: sharedAuth.ErrRequestUnauthenticated, Err: err}.Error())
+	}
+	if sharedAuth.IsSuperadmin(curAcc.GetRoles()) {
+		return &searchScope{all: true}, nil
+	}
+	scope := &searchScope{
+		accounts:    map[string]bool{curAcc.Id: true},
+		orgs:        map[string]bool{},
+		projects:    map[string]bool{},
+		orgProjects: map[string]bool{},
+	}
+	for _, role := range curAcc.GetRoles() {
+		if role.OrgId != "" {
+			scope.orgs[role.OrgId] = true
+		}
+		if role.ProjectId != "" {
+			scope.projects[role.ProjectId] = true
+		} else if role.OrgId != "" {
+			scope.orgProjects[role.OrgId] = true
+		}
+		if role.Role != rpc.Roles_ADMIN {
+			continue
+		}
+		// the members of an org or a project are the accounts with a role in it
+		params := map[string]interface{}{}
+		switch {
+		case role.ProjectId != "":
+			params["project_id"] = role.ProjectId
+		case role.OrgId != "":
+			params["org_id"] = role.OrgId
+		default:
+			continue
+		}
+		members, err := ad.store.ListRole(&coresvc.QueryParams{Params: params})
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range members {
+			scope.accounts[m.AccountId] = true
+		}
+	}
+	return scope, nil
+}
+
+func (ad *SysAccountRepo) searchHit(ctx context.Context, h *search.Hit) (*SearchHit, error) {
+	hit := &SearchHit{Type: h.Type, Id: h.ID, Score: h.Score}
+	byId := &coresvc.QueryParams{Params: map[string]interface{}{"id": h.ID}}
+	var err error
+	switch h.Type {
+	case dao.SearchTypeAccount:
+		hit.Account, err = ad.getAccountAndRole(ctx, h.ID, "")
+	case dao.SearchTypeOrg:
+		var org *dao.Org
+		if org, err = ad.store.GetOrg(byId); err == nil {
+			hit.Org, err = ad.orgFetchProjects(ctx, org)
+		}
+	case dao.SearchTypeProject:
+		var p *dao.Project
+		if p, err = ad.store.GetProject(byId); err == nil {
+			hit.Project, err = ad.projectFetchOrg(p)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return hit, nil
+}
+
+// startSearch indexes the accounts, orgs and projects and keeps the index in sync with their tables.
+func (ad *SysAccountRepo) startSearch(db *coresvc.CoreDB) error {
+	ad.index = search.NewIndex()
+	ad.searchSync = search.NewSyncer(db, ad.index, ad.log, dao.SearchSources()...)
+	return ad.searchSync.Start(context.Background())
+}
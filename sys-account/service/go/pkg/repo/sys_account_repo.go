@@ -1,7 +1,10 @@
 package repo
 
 import (
+	"context"
+
 	rpc "go.amplifyedge.org/sys-share-v2/sys-account/service/go/rpc/v2"
+	sharedConfig "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
 	"go.amplifyedge.org/sys-share-v2/sys-core/service/logging"
 	"go.amplifyedge.org/sys-v2/sys-account/service/go/pkg/superusers"
 	"go.amplifyedge.org/sys-v2/sys-account/service/go/pkg/telemetry"
@@ -13,8 +16,12 @@ import (
 	"go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
 	corefile "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/filesvc/repo"
 	coremail "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/mailer"
+	"go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/search"
 )
 
+// purgeDeletedJobName is the coredb job purging the soft deleted rows past their grace period.
+const purgeDeletedJobName = "purge-deleted"
+
 type (
 	// SysAccountRepo is the repository layer of the authn & authz && accounts
 	SysAccountRepo struct {
@@ -31,6 +38,9 @@ type (
 		//initialSuperusersMail []string
 		bizmetrics *telemetry.SysAccountMetrics
 		superDao   *superusers.SuperUserIO
+		// index is the full-text index of Search, kept in sync by searchSync
+		index      *search.Index
+		searchSync *search.Syncer
 		*rpc.UnimplementedAccountServiceServer
 		*rpc.UnimplementedAuthServiceServer
 		*rpc.UnimplementedOrgProjServiceServer
@@ -62,6 +72,19 @@ func NewAuthRepo(l logging.Logger, db *coredb.CoreDB, cfg *service.SysAccountCon
 		bizmetrics: bizmetrics,
 		superDao:   superDao,
 	}
+	if spec := cfg.SoftDelete.PurgeSchedule; spec != "" {
+		grace := cfg.SoftDelete.GracePeriodSeconds()
+		err = db.RegisterJob(purgeDeletedJobName, spec, func(ctx context.Context) error {
+			return accdb.PurgeDeleted(ctx, sharedConfig.CurrentTimestamp()-grace)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err = repo.startSearch(db); err != nil {
+		l.Errorf("Error while building the search index: %v", err)
+		return nil, err
+	}
 	// Register Bus Dispatchers
 	bus.RegisterAction("onDeleteOrg", repo.onDeleteOrg)
 	bus.RegisterAction("onDeleteAccount", repo.onDeleteAccount)
@@ -12,6 +12,7 @@ import (
 	"google.golang.org/grpc/status"
 
 	sharedAuth "go.amplifyedge.org/sys-share-v2/sys-account/service/go/pkg/shared"
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
 )
 
 var (
@@ -55,3 +56,22 @@ func testUserLogin(t *testing.T) {
 	t.Logf("Successfully logged in user: %s => %s, %s",
 		loginRequests[1].Email, resp.AccessToken, resp.RefreshToken)
 }
+
+func TestAccountScope(t *testing.T) {
+	allowed := &coresvc.QueryParams{Params: map[string]interface{}{"id": "some-account"}}
+	// the matcher of the list request applies to the authz params, like by default
+	for matcher, op := range map[string]string{"": coresvc.FilterLike, "like": coresvc.FilterLike, "eq": coresvc.FilterEq} {
+		scope, err := accountScope(allowed, matcher)
+		assert.NoError(t, err)
+		assert.Equal(t, &coresvc.Filter{And: []*coresvc.Filter{{Field: "id", Op: op, Value: "some-account"}}}, scope)
+	}
+	// a superadmin has no scope
+	scope, err := accountScope(&coresvc.QueryParams{Params: map[string]interface{}{}}, "eq")
+	assert.NoError(t, err)
+	assert.Nil(t, scope)
+	// the matchers which would widen the scope are refused
+	for _, matcher := range []string{"not_eq", "notEq", "gt", "in"} {
+		_, err = accountScope(allowed, matcher)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), matcher)
+	}
+}
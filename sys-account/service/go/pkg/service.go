@@ -48,14 +48,14 @@ func NewSysAccountServiceConfig(l logging.Logger, filepath string, bus *sharedBu
 		}
 	}
 	// accounts database
-	db, err := coredb.NewCoreDB(l, &accountCfg.SysCoreConfig, nil)
+	db, err := coredb.NewCoreDBWithOptions(l, &accountCfg.SysCoreConfig, nil, accountCfg.DbOptions)
 	if err != nil {
 		return nil, err
 	}
 
 	mailSvc := coremail.NewMailSvc(&accountCfg.MailConfig, l)
 	// files database
-	fileDb, err := coredb.NewCoreDB(l, &accountCfg.SysFileConfig, nil)
+	fileDb, err := coredb.NewCoreDBWithOptions(l, &accountCfg.SysFileConfig, nil, accountCfg.FileDbOptions)
 	if err != nil {
 		return nil, err
 	}
@@ -13,6 +13,9 @@ local tokencfg = import "vendor/github.com/amplify-edge/sys-share/sys-core/servi
          rotateSchedule: "@every 24h",
          backupDir: cfg.CoreDB.dbDir + "/sysaccount-backup"
     },
+    // no backup is pruned unless rules are set, e.g. keepLast: 7, keepDaily: 7, keepWeekly: 4,
+    // the backups taken before the backup chain only with pruneLegacy: true
+    CoreRetention:: {},
     CoreMail:: {
       senderName: "gutterbacon",
       senderMail: "gutterbacon@example.com",
@@ -74,5 +77,15 @@ local tokencfg = import "vendor/github.com/amplify-edge/sys-share/sys-core/servi
             cron: cfg.FileCron,
         },
         mailConfig: cfg.CoreMail,
+        dbOptions: {
+            retention: cfg.CoreRetention,
+        },
+        fileDbOptions: {
+            retention: cfg.CoreRetention,
+        },
+        softDelete: {
+            purgeSchedule: "@daily",
+            gracePeriod: 30,
+        },
     }
 }
\ No newline at end of file
@@ -6,6 +6,7 @@ import (
 	"gopkg.in/yaml.v2"
 
 	commonCfg "go.amplifyedge.org/sys-share-v2/sys-core/service/config/common"
+	"go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
 )
 
 const (
@@ -15,6 +16,7 @@ const (
 type SysCoreConfig struct {
 	SysCoreConfig commonCfg.Config `yaml:"sysCoreConfig" mapstructure:"sysCoreConfig"`
 	MailConfig    MailConfig       `yaml:"mailConfig" mapstructure:"mailConfig"`
+	DbOptions     coredb.Options   `yaml:"dbOptions,omitempty" mapstructure:"dbOptions"`
 }
 
 func (s *SysCoreConfig) Validate() error {
@@ -0,0 +1,130 @@
+package coredb
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Options of the coredb struct tag, comma separated as in coredb:"primary,sortable,filterable".
+const (
+	tagPrimary    = "primary"
+	tagNotNull    = "not_null"
+	tagSortable   = "sortable"
+	tagFilterable = "filterable"
+	// tagHidden fields are never exposed, whatever their other options: they cannot be sorted
+	// or filtered on, and are left out of exports and watch events.
+	tagHidden = "hidden"
+	// tagExpires marks the unix time a row expires at, see ttl.go.
+	tagExpires = "expires"
+	// tagClears lists the columns unset on expiry instead of deleting the row, as in clears=a|b.
+	tagClears = "clears"
+	// tagIndex and tagUnique declare a secondary index on the column, see index.go.
+	tagIndex  = "index"
+	tagUnique = "unique"
+)
+
+// tagOptions splits a coredb struct tag.
+func tagOptions(tag string) map[string]bool {
+	opts := map[string]bool{}
+	for _, opt := range strings.Split(tag, ",") {
+		if opt = strings.TrimSpace(opt); opt != "" {
+			opts[opt] = true
+		}
+	}
+	return opts
+}
+
+// tagValue returns the value of a name=value option of a coredb struct tag.
+func tagValue(tag, name string) (string, bool) {
+	for _, opt := range strings.Split(tag, ",") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(opt), "="); ok && k == name {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// FieldAccess holds which columns of a model list requests may sort and filter on,
+// from the sortable, filterable and hidden options of its coredb tags.
+// A model which tags no field sortable or filterable leaves every field but the hidden ones open.
+type FieldAccess struct {
+	open       bool
+	sortable   map[string]bool
+	filterable map[string]bool
+	hidden     map[string]bool
+}
+
+// NewFieldAccess reads the coredb tags of a model struct or pointer to it.
+func NewFieldAccess(model interface{}) *FieldAccess {
+	fa := &FieldAccess{
+		sortable:   map[string]bool{},
+		filterable: map[string]bool{},
+		hidden:     map[string]bool{},
+	}
+	modelType := reflect.Indirect(reflect.ValueOf(model)).Type()
+	for i := 0; i < modelType.NumField(); i++ {
+		field := modelType.Field(i)
+		column := field.Tag.Get("genji")
+		if column == "" {
+			column = strings.ToLower(field.Name)
+		}
+		opts := tagOptions(field.Tag.Get("coredb"))
+		switch {
+		case opts[tagHidden]:
+			fa.hidden[column] = true
+		default:
+			fa.sortable[column] = opts[tagSortable]
+			fa.filterable[column] = opts[tagFilterable]
+		}
+	}
+	fa.open = true
+	for column := range fa.sortable {
+		if fa.sortable[column] || fa.filterable[column] {
+			fa.open = false
+		}
+	}
+	return fa
+}
+
+func notAllowed(format string, args ...interface{}) error {
+	return Error{Reason: errFieldNotAllowed, Err: fmt.Errorf(format, args...)}
+}
+
+// CheckSort fails unless the column may be sorted on.
+func (fa *FieldAccess) CheckSort(column string) error {
+	if fa.hidden[column] {
+		return notAllowed("cannot sort on %s", column)
+	}
+	sortable, known := fa.sortable[column]
+	if !known || !(sortable || fa.open) {
+		return notAllowed("cannot sort on %s", column)
+	}
+	return nil
+}
+
+// CheckFilter fails unless every field of the filter may be filtered on.
+func (fa *FieldAccess) CheckFilter(f *Filter) error {
+	for _, field := range f.Fields() {
+		// nested fields of a document column follow the rules of the column
+		column := strings.SplitN(field, ".", 2)[0]
+		if fa.hidden[column] {
+			return notAllowed("cannot filter on %s", field)
+		}
+		filterable, known := fa.filterable[column]
+		if !known || !(filterable || fa.open) {
+			return notAllowed("cannot filter on %s", field)
+		}
+	}
+	return nil
+}
+
+// Hidden reports whether the column is tagged hidden.
+func (fa *FieldAccess) Hidden(column string) bool {
+	return fa.hidden[column]
+}
+
+// fieldAccess returns the rules of a registered table, nil for other tables.
+func (c *CoreDB) fieldAccess(table string) *FieldAccess {
+	return c.access[table]
+}
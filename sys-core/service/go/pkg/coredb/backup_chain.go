@@ -0,0 +1,133 @@
+package coredb
+
+import (
+	"fmt"
+
+	sharedConfig "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
+)
+
+const (
+	backupChainFormat = "%s.chain.json"
+	defaultFullEvery  = 24
+)
+
+// BackupOptions configures the scheduled and on demand backups.
+type BackupOptions struct {
+	// Incremental only dumps the changes since the previous backup of the chain.
+	Incremental bool `json:"incremental" yaml:"incremental" mapstructure:"incremental"`
+	// FullEvery starts a new chain with a full backup after that many incrementals, defaults to 24.
+	FullEvery int `json:"fullEvery" yaml:"fullEvery" mapstructure:"fullEvery"`
+	// Compression of the backup files, either none (default) or zstd.
+	Compression string `json:"compression" yaml:"compression" mapstructure:"compression"`
+	// EncryptKey encrypts the backup files when set, it is independent of the database encryption key
+	// so that backups can be kept and restored without handing out the latter.
+	EncryptKey string `json:"encryptKey" yaml:"encryptKey" mapstructure:"encryptKey"`
+}
+
+// BackupEntry is one backup file of a database, incrementals link to the full backup they build on.
+type BackupEntry struct {
+	File        string `json:"file"`
+	Version     string `json:"version"`
+	Incremental bool   `json:"incremental"`
+	Base        string `json:"base,omitempty"`
+	// Since and Until are the badger versions covered by the backup.
+	Since     uint64 `json:"since"`
+	Until     uint64 `json:"until"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+// backupChain is the manifest stored alongside the backups of a database.
+type backupChain struct {
+	Entries []*BackupEntry `json:"entries"`
+}
+
+func (c *CoreDB) backupChainName() string {
+	return fmt.Sprintf(backupChainFormat, c.config.DbConfig.Name)
+}
+
+func (c *CoreDB) loadBackupChain() (*backupChain, error) {
+	chain := &backupChain{}
+	b, err := readBackupObject(c.target, c.backupChainName())
+	if err != nil {
+		if IsBackupNotFound(err) {
+			return chain, nil
+		}
+		return nil, err
+	}
+	if err = sharedConfig.UnmarshalJson(b, chain); err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
+func (c *CoreDB) saveBackupChain(chain *backupChain) error {
+	b, err := MarshalPretty(chain)
+	if err != nil {
+		return err
+	}
+	return writeBackupObject(c.target, c.backupChainName(), b)
+}
+
+// BackupChain returns the backups of the database in the order they were taken.
+func (c *CoreDB) BackupChain() ([]*BackupEntry, error) {
+	chain, err := c.loadBackupChain()
+	if err != nil {
+		return nil, err
+	}
+	return chain.Entries, nil
+}
+
+// next returns the badger version and the base file the next backup starts from,
+// a zero since and empty base meaning a full backup.
+func (b *backupChain) next(opts BackupOptions) (since uint64, base string) {
+	if !opts.Incremental || len(b.Entries) == 0 {
+		return 0, ""
+	}
+	fullEvery := opts.FullEvery
+	if fullEvery <= 0 {
+		fullEvery = defaultFullEvery
+	}
+	last := b.Entries[len(b.Entries)-1]
+	base = last.File
+	if last.Incremental {
+		base = last.Base
+	}
+	incrementals := 0
+	for _, e := range b.Entries {
+		if e.Incremental && e.Base == base {
+			incrementals++
+		}
+	}
+	if incrementals >= fullEvery {
+		return 0, ""
+	}
+	return last.Until + 1, base
+}
+
+func (b *backupChain) find(match func(e *BackupEntry) bool) int {
+	for i := len(b.Entries) - 1; i >= 0; i-- {
+		if match(b.Entries[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// replayPlan lists the backups to load in order to restore the backup at idx:
+// its full base followed by every incremental of the chain up to idx.
+func (b *backupChain) replayPlan(idx int) ([]*BackupEntry, error) {
+	target := b.Entries[idx]
+	if !target.Incremental {
+		return []*BackupEntry{target}, nil
+	}
+	var plan []*BackupEntry
+	for _, e := range b.Entries[:idx+1] {
+		if e.File == target.Base || (e.Incremental && e.Base == target.Base) {
+			plan = append(plan, e)
+		}
+	}
+	if len(plan) == 0 || plan[0].File != target.Base {
+		return nil, Error{Reason: errBackupChainBroken, Err: fmt.Errorf("base %s of %s", target.Base, target.File)}
+	}
+	return plan, nil
+}
@@ -0,0 +1,289 @@
+package coredb
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/crypto/argon2"
+)
+
+// Backup files written with compression or encryption start with a header:
+//
+//	magic "CDBK" | version | flags
+//	encrypted only: salt (16) | wrap nonce (12) | wrapped data key (48) | nonce prefix (4)
+//
+// The badger stream is zstd compressed first, then sealed with AES-256-GCM in chunks
+// using a random data key, which is itself sealed with a key derived from BackupOptions.EncryptKey.
+// Files without the header are plain badger backups.
+const (
+	BackupCompressionNone = "none"
+	BackupCompressionZstd = "zstd"
+
+	backupMagic        = "CDBK"
+	backupCodecVersion = 1
+	backupFlagZstd     = 1 << 0
+	backupFlagAesGcm   = 1 << 1
+
+	backupSaltLen        = 16
+	backupNoncePrefixLen = 4
+	backupChunkSize      = 64 * 1024
+)
+
+func backupKEK(secret string, salt []byte) []byte {
+	return argon2.IDKey([]byte(secret), salt, defaultArgonTime, defaultArgonMemory, defaultArgonThreads, masterKeyLen)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chainedCloser closes the writers of an encoding chain from the outermost one inwards.
+type chainedCloser struct {
+	io.Writer
+	closers []io.Closer
+}
+
+func (c *chainedCloser) Close() error {
+	for _, cl := range c.closers {
+		if err := cl.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeBackup wraps w according to the backup options, closing the result
+// flushes the encoding but leaves w open.
+func (c *CoreDB) encodeBackup(w io.Writer) (io.WriteCloser, error) {
+	opts := c.opts.Backup
+	var flags byte
+	switch opts.Compression {
+	case "", BackupCompressionNone:
+	case BackupCompressionZstd:
+		flags |= backupFlagZstd
+	default:
+		return nil, Error{Reason: errBackupCodec, Err: fmt.Errorf("unknown compression %q", opts.Compression)}
+	}
+	if opts.EncryptKey != "" {
+		flags |= backupFlagAesGcm
+	}
+	chain := &chainedCloser{Writer: w}
+	if flags == 0 {
+		return chain, nil
+	}
+	header := []byte{backupMagic[0], backupMagic[1], backupMagic[2], backupMagic[3], backupCodecVersion, flags}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	if flags&backupFlagAesGcm != 0 {
+		sw, err := newSealWriter(w, opts.EncryptKey, header)
+		if err != nil {
+			return nil, err
+		}
+		chain.Writer = sw
+		chain.closers = append(chain.closers, sw)
+	}
+	if flags&backupFlagZstd != 0 {
+		zw, err := zstd.NewWriter(chain.Writer)
+		if err != nil {
+			return nil, err
+		}
+		chain.Writer = zw
+		chain.closers = append([]io.Closer{zw}, chain.closers...)
+	}
+	return chain, nil
+}
+
+// decodeBackup detects the format of the backup stream and returns the plain badger stream.
+func (c *CoreDB) decodeBackup(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	peek, err := br.Peek(len(backupMagic) + 2)
+	if err != nil || string(peek[:len(backupMagic)]) != backupMagic {
+		// too short for a header or no header at all, a plain badger backup
+		return io.NopCloser(br), nil
+	}
+	header := make([]byte, len(peek))
+	copy(header, peek)
+	if _, err = br.Discard(len(header)); err != nil {
+		return nil, err
+	}
+	if header[4] != backupCodecVersion {
+		return nil, Error{Reason: errBackupCodec, Err: fmt.Errorf("unknown version %d", header[4])}
+	}
+	flags := header[5]
+	var plain io.Reader = br
+	if flags&backupFlagAesGcm != 0 {
+		if c.opts.Backup.EncryptKey == "" {
+			return nil, Error{Reason: errBackupCodec, Err: fmt.Errorf("backup is encrypted but no backup key is configured")}
+		}
+		plain, err = newOpenReader(br, c.opts.Backup.EncryptKey, header)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if flags&backupFlagZstd != 0 {
+		zr, err := zstd.NewReader(plain)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}
+	return io.NopCloser(plain), nil
+}
+
+// sealWriter seals the stream in chunks, the last chunk is marked to detect truncation.
+type sealWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	nonce   []byte
+	counter uint64
+	buf     []byte
+}
+
+func newSealWriter(w io.Writer, secret string, header []byte) (*sealWriter, error) {
+	salt := make([]byte, backupSaltLen)
+	dataKey := make([]byte, masterKeyLen)
+	nonce := make([]byte, 12)
+	for _, b := range [][]byte{salt, dataKey, nonce} {
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+	}
+	kek, err := newGCM(backupKEK(secret, salt))
+	if err != nil {
+		return nil, err
+	}
+	wrapped := kek.Seal(nil, nonce, dataKey, header)
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	streamNonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(streamNonce[:backupNoncePrefixLen]); err != nil {
+		return nil, err
+	}
+	for _, b := range [][]byte{salt, nonce, wrapped, streamNonce[:backupNoncePrefixLen]} {
+		if _, err = w.Write(b); err != nil {
+			return nil, err
+		}
+	}
+	return &sealWriter{w: w, aead: aead, nonce: streamNonce, buf: make([]byte, 0, backupChunkSize)}, nil
+}
+
+func (s *sealWriter) seal(final bool) error {
+	binary.BigEndian.PutUint64(s.nonce[backupNoncePrefixLen:], s.counter)
+	s.counter++
+	ad := []byte{0}
+	if final {
+		ad[0] = 1
+	}
+	_, err := s.w.Write(s.aead.Seal(nil, s.nonce, s.buf, ad))
+	s.buf = s.buf[:0]
+	return err
+}
+
+func (s *sealWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		if len(s.buf) == backupChunkSize {
+			if err := s.seal(false); err != nil {
+				return n, err
+			}
+		}
+		m := copy(s.buf[len(s.buf):backupChunkSize], p)
+		s.buf = s.buf[:len(s.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+func (s *sealWriter) Close() error {
+	return s.seal(true)
+}
+
+// openReader is the counterpart of sealWriter.
+type openReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	nonce   []byte
+	counter uint64
+	chunk   []byte
+	plain   []byte
+	done    bool
+}
+
+func newOpenReader(r *bufio.Reader, secret string, header []byte) (*openReader, error) {
+	salt := make([]byte, backupSaltLen)
+	nonce := make([]byte, 12)
+	wrapped := make([]byte, masterKeyLen+16)
+	prefix := make([]byte, backupNoncePrefixLen)
+	for _, b := range [][]byte{salt, nonce, wrapped, prefix} {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, Error{Reason: errBackupCodec, Err: fmt.Errorf("truncated header: %v", err)}
+		}
+	}
+	kek, err := newGCM(backupKEK(secret, salt))
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := kek.Open(nil, nonce, wrapped, header)
+	if err != nil {
+		return nil, Error{Reason: errBackupCodec, Err: fmt.Errorf("wrong backup key or corrupted header")}
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	streamNonce := make([]byte, aead.NonceSize())
+	copy(streamNonce, prefix)
+	return &openReader{r: r, aead: aead, nonce: streamNonce, chunk: make([]byte, backupChunkSize+aead.Overhead())}, nil
+}
+
+func (o *openReader) next() error {
+	n, err := io.ReadFull(o.r, o.chunk)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			return Error{Reason: errBackupCodec, Err: fmt.Errorf("truncated backup")}
+		}
+		return err
+	}
+	_, peekErr := o.r.Peek(1)
+	final := peekErr == io.EOF
+	ad := []byte{0}
+	if final {
+		ad[0] = 1
+	}
+	binary.BigEndian.PutUint64(o.nonce[backupNoncePrefixLen:], o.counter)
+	o.counter++
+	o.plain, err = o.aead.Open(o.plain[:0], o.nonce, o.chunk[:n], ad)
+	if err != nil {
+		return Error{Reason: errBackupCodec, Err: fmt.Errorf("chunk %d: %v", o.counter-1, err)}
+	}
+	o.done = final
+	return nil
+}
+
+func (o *openReader) Read(p []byte) (int, error) {
+	for len(o.plain) == 0 {
+		if o.done {
+			return 0, io.EOF
+		}
+		if err := o.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, o.plain)
+	o.plain = o.plain[n:]
+	return n, nil
+}
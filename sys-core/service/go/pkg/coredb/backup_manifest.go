@@ -0,0 +1,199 @@
+package coredb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	sharedConfig "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
+)
+
+const (
+	backupManifestSuffix = ".manifest.json"
+)
+
+// BackupManifest is written next to every backup file and allows verifying it before a restore.
+type BackupManifest struct {
+	DbName string `json:"dbName"`
+	*BackupEntry
+	Size          int64  `json:"size"`
+	Sha256        string `json:"sha256"`
+	SchemaVersion int    `json:"schemaVersion"`
+	Compression   string `json:"compression,omitempty"`
+	Encrypted     bool   `json:"encrypted,omitempty"`
+}
+
+func backupManifestPath(backupFile string) string {
+	return strings.TrimSuffix(backupFile, ".bak") + backupManifestSuffix
+}
+
+// hashingWriter computes size and checksum of everything written through it.
+type hashingWriter struct {
+	w    io.Writer
+	size int64
+}
+
+func newHashingWriter(w io.Writer) (*hashingWriter, func() (int64, string)) {
+	h := sha256.New()
+	hw := &hashingWriter{w: io.MultiWriter(w, h)}
+	return hw, func() (int64, string) {
+		return hw.size, hex.EncodeToString(h.Sum(nil))
+	}
+}
+
+func (hw *hashingWriter) Write(p []byte) (int, error) {
+	n, err := hw.w.Write(p)
+	hw.size += int64(n)
+	return n, err
+}
+
+func (c *CoreDB) writeBackupManifest(backupFile string, m *BackupManifest) error {
+	b, err := MarshalPretty(m)
+	if err != nil {
+		return err
+	}
+	return writeBackupObject(c.target, backupManifestPath(backupFile), b)
+}
+
+func (c *CoreDB) readBackupManifest(backupFile string) (*BackupManifest, error) {
+	b, err := readBackupObject(c.target, backupManifestPath(backupFile))
+	if err != nil {
+		return nil, err
+	}
+	m := &BackupManifest{}
+	if err = sharedConfig.UnmarshalJson(b, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// verifyBackupFile checks the backup file against its manifest.
+// A missing manifest is reported as an error satisfying IsBackupNotFound.
+func (c *CoreDB) verifyBackupFile(backupFile string) error {
+	m, err := c.readBackupManifest(backupFile)
+	if err != nil {
+		return err
+	}
+	if m.DbName != c.config.DbConfig.Name {
+		return Error{Reason: errBackupWrongDatabase, Err: fmt.Errorf("%s belongs to %s", backupFile, m.DbName)}
+	}
+	f, err := c.target.Open(backupFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+	if size != m.Size {
+		return Error{Reason: errBackupCorrupted, Err: fmt.Errorf("%s has %d bytes, expected %d", backupFile, size, m.Size)}
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != m.Sha256 {
+		return Error{Reason: errBackupCorrupted, Err: fmt.Errorf("%s has checksum %s, expected %s", backupFile, sum, m.Sha256)}
+	}
+	return nil
+}
+
+// verifyRestoreFiles verifies every file of a restore before anything is loaded.
+// Backups taken before manifests existed are restored unverified.
+func (c *CoreDB) verifyRestoreFiles(files []string) error {
+	for _, file := range files {
+		err := c.verifyBackupFile(file)
+		if IsBackupNotFound(err) && c.backupExists(file) {
+			c.logger.Warnf("%s backup %s has no manifest, restoring unverified", moduleName, file)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *CoreDB) backupExists(file string) bool {
+	_, err := c.target.Stat(file)
+	return err == nil
+}
+
+// VerifyBackupRequest selects a backup by version, or by file when DbName is set.
+type VerifyBackupRequest struct {
+	DbName        string `json:"dbName"`
+	BackupVersion string `json:"backupVersion"`
+	BackupFile    string `json:"backupFile"`
+}
+
+type BackupFileVerification struct {
+	File  string `json:"file"`
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+}
+
+type VerifyBackupResult struct {
+	DbName string                    `json:"dbName"`
+	Valid  bool                      `json:"valid"`
+	Files  []*BackupFileVerification `json:"files"`
+}
+
+type VerifyBackupAllResult struct {
+	Results []*VerifyBackupResult `json:"results"`
+}
+
+// VerifyBackup checks the backup and, for an incremental, every backup it is restored from.
+func (c *CoreDB) VerifyBackup(backupFile string) (*VerifyBackupResult, error) {
+	files, err := c.restoreFiles(backupFile)
+	if err != nil {
+		return nil, err
+	}
+	res := &VerifyBackupResult{DbName: c.config.DbConfig.Name, Valid: true}
+	for _, file := range files {
+		v := &BackupFileVerification{File: c.target.Location(file), Valid: true}
+		if err := c.verifyBackupFile(file); err != nil {
+			if IsBackupNotFound(err) {
+				err = fmt.Errorf("missing backup or manifest: %v", err)
+			}
+			v.Valid, v.Error = false, err.Error()
+			res.Valid = false
+		}
+		res.Files = append(res.Files, v)
+	}
+	return res, nil
+}
+
+// VerifyBackup checks the integrity of a backup of one or every registered database without restoring it.
+// `db backups verify` calls it; Restore runs the same checks before it touches the database.
+func (a *AllDBService) VerifyBackup(_ context.Context, in *VerifyBackupRequest) (*VerifyBackupAllResult, error) {
+	if in == nil || (in.BackupVersion == "" && in.BackupFile == "") {
+		return nil, status.Errorf(codes.InvalidArgument, "backup version or backup file has to be specified")
+	}
+	if in.BackupFile != "" && in.DbName == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "backup file requires a database name")
+	}
+	cdbs, err := a.selectCoreDBs(in.DbName)
+	if err != nil {
+		return nil, err
+	}
+	var results []*VerifyBackupResult
+	for _, cdb := range cdbs {
+		backupFile := in.BackupFile
+		if backupFile == "" {
+			backupFile, err = cdb.lookupBackup(in.BackupVersion)
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "backup version %s for database %s not found", in.BackupVersion, cdb.config.DbConfig.Name)
+			}
+		}
+		res, err := cdb.VerifyBackup(backupFile)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "unable to verify backup of %s: %v", cdb.config.DbConfig.Name, err)
+		}
+		results = append(results, res)
+	}
+	return &VerifyBackupAllResult{Results: results}, nil
+}
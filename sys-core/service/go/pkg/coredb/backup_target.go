@@ -0,0 +1,159 @@
+package coredb
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	BackupTargetFilesystem = "filesystem"
+	BackupTargetS3         = "s3"
+)
+
+// BackupTarget stores backup files and their manifests by name.
+type BackupTarget interface {
+	// Create writes the object name, it replaces any previous one once Close returns without error.
+	Create(name string) (io.WriteCloser, error)
+	// Open and Stat report missing objects with an error satisfying IsBackupNotFound.
+	Open(name string) (io.ReadCloser, error)
+	Stat(name string) (size int64, err error)
+	List() ([]string, error)
+	// Remove does not fail on missing objects.
+	Remove(name string) error
+	// Location describes where the object lives, for humans.
+	Location(name string) string
+}
+
+// BackupTargetOptions selects where backups are stored,
+// by default the filesystem directory CronConfig.BackupDir.
+type BackupTargetOptions struct {
+	Type string    `json:"type" yaml:"type" mapstructure:"type"`
+	S3   S3Options `json:"s3" yaml:"s3" mapstructure:"s3"`
+}
+
+// IsBackupNotFound reports whether err is about a missing backup object.
+func IsBackupNotFound(err error) bool {
+	e, ok := err.(Error)
+	return ok && e.Reason == errBackupNotFound
+}
+
+func newBackupTarget(opts BackupTargetOptions, backupDir string) (BackupTarget, error) {
+	switch opts.Type {
+	case "", BackupTargetFilesystem:
+		return &fsTarget{dir: backupDir}, nil
+	case BackupTargetS3:
+		return newS3Target(opts.S3)
+	default:
+		return nil, Error{Reason: errUnknownBackupTarget, Err: fmt.Errorf("type %q", opts.Type)}
+	}
+}
+
+func readBackupObject(target BackupTarget, name string) ([]byte, error) {
+	r, err := target.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+func writeBackupObject(target BackupTarget, name string, b []byte) error {
+	w, err := target.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(b); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// fsTarget keeps the backups in a local directory.
+type fsTarget struct {
+	dir string
+}
+
+func (f *fsTarget) path(name string) string {
+	return filepath.Join(f.dir, name)
+}
+
+func notFound(name string, err error) error {
+	if os.IsNotExist(err) {
+		return Error{Reason: errBackupNotFound, Err: fmt.Errorf("%s", name)}
+	}
+	return err
+}
+
+// atomicFile is written next to its destination and renamed into place on Close.
+type atomicFile struct {
+	*os.File
+	dest string
+}
+
+func (a *atomicFile) Close() error {
+	if err := a.File.Close(); err != nil {
+		_ = os.Remove(a.Name())
+		return err
+	}
+	return os.Rename(a.Name(), a.dest)
+}
+
+func (f *fsTarget) Create(name string) (io.WriteCloser, error) {
+	if err := os.MkdirAll(f.dir, 0700); err != nil {
+		return nil, err
+	}
+	tmp, err := os.Create(f.path(name) + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{File: tmp, dest: f.path(name)}, nil
+}
+
+func (f *fsTarget) Open(name string) (io.ReadCloser, error) {
+	r, err := os.Open(f.path(name))
+	if err != nil {
+		return nil, notFound(name, err)
+	}
+	return r, nil
+}
+
+func (f *fsTarget) Stat(name string) (int64, error) {
+	fi, err := os.Stat(f.path(name))
+	if err != nil {
+		return 0, notFound(name, err)
+	}
+	return fi.Size(), nil
+}
+
+func (f *fsTarget) List() ([]string, error) {
+	fileInfos, err := ioutil.ReadDir(f.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, fi := range fileInfos {
+		if !fi.IsDir() {
+			names = append(names, fi.Name())
+		}
+	}
+	return names, nil
+}
+
+func (f *fsTarget) Remove(name string) error {
+	err := os.Remove(f.path(name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (f *fsTarget) Location(name string) string {
+	return f.path(name)
+}
@@ -0,0 +1,131 @@
+package coredb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Options configures an S3 compatible object store, MinIO included.
+type S3Options struct {
+	Endpoint  string `json:"endpoint" yaml:"endpoint" mapstructure:"endpoint"`
+	Region    string `json:"region" yaml:"region" mapstructure:"region"`
+	Bucket    string `json:"bucket" yaml:"bucket" mapstructure:"bucket"`
+	Prefix    string `json:"prefix" yaml:"prefix" mapstructure:"prefix"`
+	AccessKey string `json:"accessKey" yaml:"accessKey" mapstructure:"accessKey"`
+	SecretKey string `json:"secretKey" yaml:"secretKey" mapstructure:"secretKey"`
+	UseSSL    bool   `json:"useSSL" yaml:"useSSL" mapstructure:"useSSL"`
+}
+
+// s3Target keeps the backups as objects below a prefix of a bucket.
+type s3Target struct {
+	client *minio.Client
+	opts   S3Options
+}
+
+func newS3Target(opts S3Options) (*s3Target, error) {
+	if opts.Endpoint == "" || opts.Bucket == "" {
+		return nil, Error{Reason: errUnknownBackupTarget, Err: fmt.Errorf("s3 endpoint and bucket have to be specified")}
+	}
+	client, err := minio.New(opts.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(opts.AccessKey, opts.SecretKey, ""),
+		Secure: opts.UseSSL,
+		Region: opts.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s3Target{client: client, opts: opts}, nil
+}
+
+func (s *s3Target) key(name string) string {
+	return path.Join(s.opts.Prefix, name)
+}
+
+func (s *s3Target) notFound(name string, err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return Error{Reason: errBackupNotFound, Err: fmt.Errorf("%s", s.Location(name))}
+	}
+	return err
+}
+
+// s3Writer streams into a multipart upload, Close waits for it to complete.
+type s3Writer struct {
+	*io.PipeWriter
+	done chan error
+}
+
+func (w *s3Writer) Close() error {
+	if err := w.PipeWriter.Close(); err != nil {
+		return err
+	}
+	return <-w.done
+}
+
+func (s *s3Target) Create(name string) (io.WriteCloser, error) {
+	pr, pw := io.Pipe()
+	w := &s3Writer{PipeWriter: pw, done: make(chan error, 1)}
+	go func() {
+		_, err := s.client.PutObject(context.Background(), s.opts.Bucket, s.key(name), pr, -1, minio.PutObjectOptions{
+			ContentType: "application/octet-stream",
+		})
+		// unblock the writer if the upload failed midway
+		pr.CloseWithError(err)
+		w.done <- err
+	}()
+	return w, nil
+}
+
+func (s *s3Target) Open(name string) (io.ReadCloser, error) {
+	if _, err := s.Stat(name); err != nil {
+		return nil, err
+	}
+	obj, err := s.client.GetObject(context.Background(), s.opts.Bucket, s.key(name), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s.notFound(name, err)
+	}
+	return obj, nil
+}
+
+func (s *s3Target) Stat(name string) (int64, error) {
+	info, err := s.client.StatObject(context.Background(), s.opts.Bucket, s.key(name), minio.StatObjectOptions{})
+	if err != nil {
+		return 0, s.notFound(name, err)
+	}
+	return info.Size, nil
+}
+
+func (s *s3Target) List() ([]string, error) {
+	prefix := s.opts.Prefix
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	var names []string
+	for obj := range s.client.ListObjects(context.Background(), s.opts.Bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		if strings.HasSuffix(obj.Key, "/") {
+			continue
+		}
+		names = append(names, strings.TrimPrefix(obj.Key, prefix))
+	}
+	return names, nil
+}
+
+func (s *s3Target) Remove(name string) error {
+	err := s.client.RemoveObject(context.Background(), s.opts.Bucket, s.key(name), minio.RemoveObjectOptions{})
+	if err != nil && minio.ToErrorResponse(err).Code != "NoSuchKey" {
+		return err
+	}
+	return nil
+}
+
+func (s *s3Target) Location(name string) string {
+	return fmt.Sprintf("s3://%s/%s", s.opts.Bucket, s.key(name))
+}
@@ -0,0 +1,233 @@
+package coredb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	sharedConfig "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
+	"go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb/sqlengine"
+)
+
+// Cron locks, deciding which of the replicas of a database runs a scheduled job.
+const (
+	// CronLockNone runs the jobs on every replica.
+	CronLockNone = "none"
+	// CronLockFile elects a leader among the replicas sharing a file system: the replica locking
+	// the lock file runs every job, the others take over once it exits.
+	CronLockFile = "file"
+	// CronLockLease runs a job on the replica taking its lease in the tables of the sql engine,
+	// the holder keeps the lease as long as it runs the job on schedule.
+	CronLockLease = "lease"
+
+	defaultCronLeaseTTL = time.Minute
+)
+
+// CronOptions makes the replicas of a database run its scheduled jobs once per schedule.
+// The jobs run through RunJob run on the replica asked, whatever the lock.
+type CronOptions struct {
+	// Lock is none, file or lease. It defaults to lease on the sql engines, which replicas share,
+	// and to none otherwise.
+	Lock string `json:"lock" yaml:"lock" mapstructure:"lock"`
+	// LockFile is the file of the file lock, <name>.cron.lock in the backup directory by default.
+	LockFile string `json:"lockFile" yaml:"lockFile" mapstructure:"lockFile"`
+	// LeaseTTL is how long a lease outlives the run taking it, one minute by default.
+	// The clocks of the replicas have to agree well within it.
+	LeaseTTL time.Duration `json:"leaseTTL" yaml:"leaseTTL" mapstructure:"leaseTTL"`
+	// Disabled registers the scheduled jobs without ever running them on schedule, for the
+	// processes administering a database offline. RunJob still runs them.
+	Disabled bool `json:"disabled" yaml:"disabled" mapstructure:"disabled"`
+}
+
+func (o CronOptions) lock(engine string) string {
+	switch {
+	case o.Lock != "":
+		return o.Lock
+	case engine == EngineSQLite || engine == EnginePostgres:
+		return CronLockLease
+	default:
+		return CronLockNone
+	}
+}
+
+func (o CronOptions) leaseTTL() time.Duration {
+	if o.LeaseTTL <= 0 {
+		return defaultCronLeaseTTL
+	}
+	return o.LeaseTTL
+}
+
+// cronLock elects the replica running a scheduled job.
+type cronLock interface {
+	// acquire reports whether the replica runs job now, and keeps it running it until release.
+	acquire(ctx context.Context, job string) (bool, error)
+	// renew keeps job with the replica while its run goes on.
+	renew(ctx context.Context, job string) error
+	// release gives up every job, for another replica to take over.
+	release(ctx context.Context) error
+	// renewEvery is how often a run in progress is renewed, zero for never.
+	renewEvery() time.Duration
+}
+
+// newCronLock creates the cron lock of the options, nil for none.
+func (c *CoreDB) newCronLock() (cronLock, error) {
+	opts := c.opts.Cron
+	switch opts.lock(c.opts.Engine.kind()) {
+	case CronLockNone:
+		return nil, nil
+	case CronLockFile:
+		path := opts.LockFile
+		if path == "" {
+			path = filepath.Join(c.config.CronConfig.BackupDir, c.config.DbConfig.Name+".cron.lock")
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+		return &fileCronLock{path: path}, nil
+	case CronLockLease:
+		if _, ok := c.engine.(*sqlengine.Engine); !ok {
+			return nil, Error{Reason: errEngineUnsupported, Err: fmt.Errorf("cron leases of %s need a sql engine", c.config.DbConfig.Name)}
+		}
+		return &leaseCronLock{c: c, holder: cronHolder(), ttl: opts.leaseTTL()}, nil
+	default:
+		return nil, Error{Reason: errInvalidCronLock, Err: fmt.Errorf("%q", opts.Lock)}
+	}
+}
+
+// cronHolder names the replica in the leases.
+func cronHolder() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), sharedConfig.NewID())
+}
+
+// fileCronLock makes the replica locking the file the leader, until it exits or releases it.
+type fileCronLock struct {
+	path string
+	mu   sync.Mutex
+	f    *os.File
+}
+
+func (l *fileCronLock) acquire(context.Context, string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f != nil {
+		return true, nil
+	}
+	f, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return false, err
+	}
+	locked, err := lockFile(f)
+	if err != nil || !locked {
+		_ = f.Close()
+		return false, err
+	}
+	l.f = f
+	return true, nil
+}
+
+func (l *fileCronLock) renew(context.Context, string) error {
+	return nil
+}
+
+func (l *fileCronLock) release(context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := unlockFile(l.f)
+	if closeErr := l.f.Close(); err == nil {
+		err = closeErr
+	}
+	l.f = nil
+	return err
+}
+
+func (l *fileCronLock) renewEvery() time.Duration {
+	return 0
+}
+
+// leaseCronLock takes a lease per job in the tables of the sql engine.
+type leaseCronLock struct {
+	c      *CoreDB
+	holder string
+	ttl    time.Duration
+}
+
+func (l *leaseCronLock) engine() (*sqlengine.Engine, func()) {
+	l.c.storeMu.RLock()
+	ng, _ := l.c.engine.(*sqlengine.Engine)
+	return ng, l.c.storeMu.RUnlock
+}
+
+func (l *leaseCronLock) acquire(ctx context.Context, job string) (bool, error) {
+	ng, done := l.engine()
+	defer done()
+	return ng.AcquireLease(ctx, "cron:"+job, l.holder, l.ttl)
+}
+
+func (l *leaseCronLock) renew(ctx context.Context, job string) error {
+	ok, err := l.acquire(ctx, job)
+	if err == nil && !ok {
+		err = fmt.Errorf("lease of %s taken over", job)
+	}
+	return err
+}
+
+func (l *leaseCronLock) release(ctx context.Context) error {
+	ng, done := l.engine()
+	defer done()
+	return ng.ReleaseLeases(ctx, l.holder)
+}
+
+func (l *leaseCronLock) renewEvery() time.Duration {
+	return l.ttl / 3
+}
+
+// runScheduled runs a job on its schedule, unless another replica does.
+func (c *CoreDB) runScheduled(name string) {
+	ctx := context.Background()
+	dbName := c.config.DbConfig.Name
+	if c.cronLock != nil {
+		ok, err := c.cronLock.acquire(ctx, name)
+		if err != nil {
+			c.logger.Warnf("%s %s job of %s skipped, unable to lock: %v", moduleName, name, dbName, err)
+			return
+		}
+		if !ok {
+			c.logger.Debugf("%s %s job of %s runs on another replica", moduleName, name, dbName)
+			return
+		}
+		if every := c.cronLock.renewEvery(); every > 0 {
+			stop := make(chan struct{})
+			defer close(stop)
+			go c.renewCronLock(name, every, stop)
+		}
+	}
+	if _, err := c.runJob(ctx, name, false, nil); err != nil {
+		c.logger.Warnf("%s %s job of %s skipped: %v", moduleName, name, dbName, err)
+	}
+}
+
+// renewCronLock keeps a job with the replica until stop is closed.
+func (c *CoreDB) renewCronLock(name string, every time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := c.cronLock.renew(context.Background(), name); err != nil {
+				c.logger.Warnf("%s %s job of %s: unable to renew its lock: %v", moduleName, name, c.config.DbConfig.Name, err)
+			}
+		}
+	}
+}
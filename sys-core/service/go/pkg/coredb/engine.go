@@ -0,0 +1,130 @@
+package coredb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/dgraph-io/badger/v2"
+	genjiEngine "github.com/genjidb/genji/engine"
+	"github.com/genjidb/genji/engine/badgerengine"
+	// database/sql drivers of the sql engines
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+
+	"go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb/memengine"
+	"go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb/sqlengine"
+)
+
+// Storage engines genji keeps the databases in.
+const (
+	EngineBadger = "badger"
+	// EngineMemory keeps the database in memory, it is lost on close.
+	EngineMemory = "memory"
+	// EngineSQLite and EnginePostgres store the key values of genji in a SQL database,
+	// the tables and queries of the models stay genji's.
+	EngineSQLite   = "sqlite"
+	EnginePostgres = "postgres"
+
+	defaultSQLiteFile = "coredb.sqlite"
+)
+
+var nonIdentRe = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// EngineOptions selects the storage engine of the database.
+// Only the badger engine is encrypted and supports backups, restores, re-keying and the value log GC,
+// the other engines leave those to the tooling of the database they run on.
+type EngineOptions struct {
+	// Kind is badger, memory, sqlite or postgres, defaults to badger.
+	Kind string `json:"kind" yaml:"kind" mapstructure:"kind"`
+	// DSN locates the SQL database. It is the file of sqlite, coredb.sqlite in the database
+	// directory by default, and the connection string of postgres.
+	DSN string `json:"dsn" yaml:"dsn" mapstructure:"dsn"`
+	// Driver names the database/sql driver of the sql engines, sqlite3 or postgres by default.
+	// A driver registered under another name, such as a tracing wrapper, can stand in for them.
+	Driver string `json:"driver" yaml:"driver" mapstructure:"driver"`
+	// TablePrefix names the tables of the sql engines, so that several databases can share one.
+	// It defaults to the database name with anything but letters, digits and underscores replaced.
+	TablePrefix string `json:"tablePrefix" yaml:"tablePrefix" mapstructure:"tablePrefix"`
+}
+
+func (e EngineOptions) kind() string {
+	if e.Kind == "" {
+		return EngineBadger
+	}
+	return e.Kind
+}
+
+func (e EngineOptions) driver(defaultDriver string) string {
+	if e.Driver == "" {
+		return defaultDriver
+	}
+	return e.Driver
+}
+
+// openEngine opens the storage engine of the database, key is the badger master key.
+func (c *CoreDB) openEngine(key []byte) (genjiEngine.Engine, error) {
+	dbCfg := c.config.DbConfig
+	opts := c.opts.Engine
+	prefix := opts.TablePrefix
+	if prefix == "" {
+		prefix = "coredb_" + nonIdentRe.ReplaceAllString(dbCfg.Name, "_")
+	}
+	switch opts.kind() {
+	case EngineBadger:
+		ng, err := newBadgerEngine(c.dbPath(), key, dbCfg.RotationDuration)
+		if err != nil {
+			return nil, err
+		}
+		return ng, nil
+	case EngineMemory:
+		return memengine.NewEngine(), nil
+	case EngineSQLite:
+		dsn := opts.DSN
+		if dsn == "" {
+			if err := os.MkdirAll(c.dbPath(), 0755); err != nil {
+				return nil, err
+			}
+			dsn = filepath.Join(c.dbPath(), defaultSQLiteFile)
+		}
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		// WAL lets the readers run alongside the writer
+		return openSQLEngine(opts.driver("sqlite3"), dsn+sep+"_journal_mode=WAL&_busy_timeout=5000", sqlengine.SQLite, prefix)
+	case EnginePostgres:
+		if opts.DSN == "" {
+			return nil, Error{Reason: errUnknownEngine, Err: fmt.Errorf("postgres engine of %s has no dsn", dbCfg.Name)}
+		}
+		return openSQLEngine(opts.driver("postgres"), opts.DSN, sqlengine.Postgres, prefix)
+	default:
+		return nil, Error{Reason: errUnknownEngine, Err: fmt.Errorf("%q", opts.Kind)}
+	}
+}
+
+func openSQLEngine(driverName, dsn string, dialect sqlengine.Dialect, prefix string) (genjiEngine.Engine, error) {
+	ng, err := sqlengine.Open(context.Background(), driverName, dsn, dialect, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return ng, nil
+}
+
+// newBadgerEngine opens badger with encryption and encryption key rotation.
+func newBadgerEngine(path string, encKey []byte, keyRotationSchedule int) (*badgerengine.Engine, error) {
+	return badgerengine.NewEngine(createBadgerOpts(path, encKey, keyRotationSchedule))
+}
+
+// badgerDB returns the badger database under the store, the operations working on the files
+// of badger fail on the other engines.
+func (c *CoreDB) badgerDB() (*badger.DB, error) {
+	ng, ok := c.engine.(*badgerengine.Engine)
+	if !ok {
+		return nil, Error{Reason: errEngineUnsupported, Err: fmt.Errorf("%s runs on the %s engine", c.config.DbConfig.Name, c.opts.Engine.kind())}
+	}
+	return ng.DB, nil
+}
@@ -12,6 +12,37 @@ type ErrorReason int
 
 const (
 	errRegisterModelEmpty = iota
+	errMigrationInvalidVersion
+	errMigrationDuplicateVersion
+	errMigrationUnknownVersion
+	errDatabaseNotFound
+	errUnknownKdf
+	errRekeyEmptyKey
+	errBackupChainBroken
+	errBackupCorrupted
+	errBackupWrongDatabase
+	errRestoreInvalid
+	errBackupNotFound
+	errUnknownBackupTarget
+	errBackupCodec
+	errTableNotRegistered
+	errUnknownColumn
+	errUnknownExportFormat
+	errImportInvalidRow
+	errInvalidCursor
+	errInvalidFilter
+	errFieldNotAllowed
+	errWatchOverflow
+	errInvalidExpiry
+	errUnknownEngine
+	errEngineUnsupported
+	errInvalidFixture
+	errInvalidJob
+	errJobNotFound
+	errJobRunning
+	errInvalidCronLock
+	errInvalidIndex
+	errIndexNotFound
 )
 
 type Error struct {
@@ -34,6 +65,68 @@ func (err Error) desc() string {
 	switch err.Reason {
 	case errRegisterModelEmpty:
 		return "registering model to db invalid, empty map"
+	case errMigrationInvalidVersion:
+		return "migration version has to be greater than zero"
+	case errMigrationDuplicateVersion:
+		return "migration version registered more than once"
+	case errMigrationUnknownVersion:
+		return "migration target version is not registered"
+	case errDatabaseNotFound:
+		return "unable to find registered database"
+	case errUnknownKdf:
+		return "unknown key derivation function"
+	case errRekeyEmptyKey:
+		return "new encryption key is empty"
+	case errBackupChainBroken:
+		return "full backup of the incremental backup chain is missing"
+	case errBackupCorrupted:
+		return "backup does not match its manifest"
+	case errBackupWrongDatabase:
+		return "backup belongs to another database"
+	case errRestoreInvalid:
+		return "restored database failed validation"
+	case errBackupNotFound:
+		return "backup not found"
+	case errUnknownBackupTarget:
+		return "invalid backup target"
+	case errBackupCodec:
+		return "unable to encode or decode backup"
+	case errTableNotRegistered:
+		return "table is not registered"
+	case errUnknownColumn:
+		return "column is not part of the table model"
+	case errUnknownExportFormat:
+		return "unknown export format"
+	case errImportInvalidRow:
+		return "invalid row in import"
+	case errInvalidCursor:
+		return "invalid page cursor"
+	case errInvalidFilter:
+		return "invalid filter"
+	case errFieldNotAllowed:
+		return "field not allowed"
+	case errWatchOverflow:
+		return "watcher fell behind"
+	case errInvalidExpiry:
+		return "invalid expires tag"
+	case errUnknownEngine:
+		return "invalid storage engine"
+	case errEngineUnsupported:
+		return "not supported by the storage engine"
+	case errInvalidFixture:
+		return "invalid fixture"
+	case errInvalidJob:
+		return "invalid job"
+	case errJobNotFound:
+		return "job not registered"
+	case errJobRunning:
+		return "job is running already"
+	case errInvalidCronLock:
+		return "invalid cron lock"
+	case errInvalidIndex:
+		return "invalid index tag"
+	case errIndexNotFound:
+		return "index not found"
 	default:
 		return "unknown error occurred"
 	}
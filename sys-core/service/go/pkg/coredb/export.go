@@ -0,0 +1,517 @@
+package coredb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/genjidb/genji"
+	"github.com/genjidb/genji/document"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	ExportFormatJSONL = "jsonl"
+	ExportFormatCSV   = "csv"
+
+	exportChunkSize = 64 * 1024
+	importBatchSize = 500
+	// maxImportLine bounds a single JSON Lines document.
+	maxImportLine = 16 * 1024 * 1024
+)
+
+// ExportOptions selects the rows and columns of a table to export.
+type ExportOptions struct {
+	// Format is either jsonl (default) or csv.
+	Format string `json:"format"`
+	// Columns restricts the export to these columns, all model columns but the hidden ones by default.
+	// Hidden columns are only exported when named here.
+	Columns []string `json:"columns"`
+	// Filter and Matcher are handed to BaseQueryBuilder, Matcher defaults to eq.
+	Filter  map[string]interface{} `json:"filter"`
+	Matcher string                 `json:"matcher"`
+}
+
+type exportColumn struct {
+	name string
+	// typ is the column type given by GetStructTags, without constraints.
+	typ    string
+	hidden bool
+}
+
+// tableColumns lists the columns of a registered table in the field order of its model.
+func (c *CoreDB) tableColumns(table string) ([]exportColumn, error) {
+	for name, model := range c.models {
+		if ToSnakeCase(name) != table {
+			continue
+		}
+		types := GetStructTags(model)
+		access := NewFieldAccess(model)
+		modelType := reflect.Indirect(reflect.ValueOf(model)).Type()
+		var columns []exportColumn
+		for i := 0; i < modelType.NumField(); i++ {
+			tag := modelType.Field(i).Tag.Get("genji")
+			if tag == "" || tag == "-" {
+				continue
+			}
+			columns = append(columns, exportColumn{name: tag, typ: strings.Fields(types[tag])[0], hidden: access.Hidden(tag)})
+		}
+		return columns, nil
+	}
+	return nil, Error{Reason: errTableNotRegistered, Err: fmt.Errorf("%s", table)}
+}
+
+// Tables lists the registered tables of the database.
+func (c *CoreDB) Tables() []string {
+	var tables []string
+	for name := range c.models {
+		tables = append(tables, ToSnakeCase(name))
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// selectColumns picks the named columns, or the columns which are not hidden when none is named.
+func selectColumns(columns []exportColumn, names []string) ([]exportColumn, error) {
+	var selected []exportColumn
+	if len(names) == 0 {
+		for _, col := range columns {
+			if !col.hidden {
+				selected = append(selected, col)
+			}
+		}
+		return selected, nil
+	}
+	for _, name := range names {
+		found := false
+		for _, col := range columns {
+			if col.name == name {
+				selected = append(selected, col)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, Error{Reason: errUnknownColumn, Err: fmt.Errorf("%s", name)}
+		}
+	}
+	return selected, nil
+}
+
+// ExportTable writes the rows of table matching the options to w, one document per row.
+// Rows are streamed from a read transaction and never held in memory as a whole.
+func (c *CoreDB) ExportTable(ctx context.Context, w io.Writer, table string, opts ExportOptions) (int64, error) {
+	columns, err := c.tableColumns(table)
+	if err != nil {
+		return 0, err
+	}
+	if columns, err = selectColumns(columns, opts.Columns); err != nil {
+		return 0, err
+	}
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.name
+	}
+	matcher := opts.Matcher
+	if matcher == "" {
+		matcher = "eq"
+	}
+	stmt, args, err := BaseQueryBuilder(opts.Filter, table, strings.Join(names, ", "), matcher).ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	var write func(d document.Document) error
+	var flush func() error
+	switch opts.Format {
+	case "", ExportFormatJSONL:
+		write = func(d document.Document) error {
+			b, err := document.MarshalJSON(d)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(append(b, '\n'))
+			return err
+		}
+		flush = func() error { return nil }
+	case ExportFormatCSV:
+		cw := csv.NewWriter(w)
+		if err = cw.Write(names); err != nil {
+			return 0, err
+		}
+		record := make([]string, len(names))
+		write = func(d document.Document) error {
+			for i, name := range names {
+				v, err := d.GetByField(name)
+				if err != nil && err != document.ErrFieldNotFound {
+					return err
+				}
+				if record[i], err = csvValue(v); err != nil {
+					return err
+				}
+			}
+			return cw.Write(record)
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	default:
+		return 0, Error{Reason: errUnknownExportFormat, Err: fmt.Errorf("%q", opts.Format)}
+	}
+
+	var rows int64
+	err = c.view(ctx, func(tx *genji.Tx) error {
+		res, err := tx.Query(stmt, args...)
+		if err != nil {
+			return err
+		}
+		defer res.Close()
+		return res.Iterate(func(d document.Document) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			rows++
+			return write(d)
+		})
+	})
+	if err != nil {
+		return rows, err
+	}
+	return rows, flush()
+}
+
+// csvValue formats v for a CSV cell, blobs are base64 encoded and arrays or documents JSON encoded.
+func csvValue(v document.Value) (string, error) {
+	switch v.Type {
+	case 0, document.NullValue:
+		return "", nil
+	case document.TextValue:
+		return v.V.(string), nil
+	case document.BlobValue:
+		return base64.StdEncoding.EncodeToString(v.V.([]byte)), nil
+	case document.BoolValue:
+		return strconv.FormatBool(v.V.(bool)), nil
+	case document.IntegerValue:
+		return strconv.FormatInt(v.V.(int64), 10), nil
+	default:
+		b, err := v.MarshalJSON()
+		return string(b), err
+	}
+}
+
+// parseValue converts a CSV cell or a decoded JSON value to the column type, empty cells are null.
+func parseValue(typ string, v document.Value) (document.Value, error) {
+	if v.Type != document.TextValue {
+		if typ == "DOUBLE" && v.Type == document.IntegerValue {
+			return document.NewDoubleValue(float64(v.V.(int64))), nil
+		}
+		return v, nil
+	}
+	s := v.V.(string)
+	if s == "" && typ != "TEXT" {
+		return document.NewNullValue(), nil
+	}
+	switch typ {
+	case "INTEGER":
+		i, err := strconv.ParseInt(s, 10, 64)
+		return document.NewIntegerValue(i), err
+	case "DOUBLE":
+		f, err := strconv.ParseFloat(s, 64)
+		return document.NewDoubleValue(f), err
+	case "BOOL":
+		b, err := strconv.ParseBool(s)
+		return document.NewBoolValue(b), err
+	case "BLOB":
+		b, err := base64.StdEncoding.DecodeString(s)
+		return document.NewBlobValue(b), err
+	case "ARRAY", "DOCUMENT":
+		fb := document.NewFieldBuffer()
+		if err := fb.UnmarshalJSON([]byte(`{"v":` + s + `}`)); err != nil {
+			return v, err
+		}
+		return fb.GetByField("v")
+	default:
+		return v, nil
+	}
+}
+
+// ImportTable inserts the rows read from r into table, in transactions of a few hundred rows.
+// Columns unknown to the model are rejected, an error reports the offending row
+// and leaves the batches imported before it in place.
+func (c *CoreDB) ImportTable(ctx context.Context, r io.Reader, table string, format string) (int64, error) {
+	columns, err := c.tableColumns(table)
+	if err != nil {
+		return 0, err
+	}
+	types := map[string]string{}
+	for _, col := range columns {
+		types[col.name] = col.typ
+	}
+	toDoc := func(fields []string, values []document.Value) (*document.FieldBuffer, error) {
+		fb := document.NewFieldBuffer()
+		for i, field := range fields {
+			typ, ok := types[field]
+			if !ok {
+				return nil, fmt.Errorf("unknown column %s", field)
+			}
+			v, err := parseValue(typ, values[i])
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %v", field, err)
+			}
+			fb.Add(field, v)
+		}
+		return fb, nil
+	}
+
+	var next func() (*document.FieldBuffer, error)
+	switch format {
+	case "", ExportFormatJSONL:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, exportChunkSize), maxImportLine)
+		next = func() (*document.FieldBuffer, error) {
+			for scanner.Scan() {
+				line := bytes.TrimSpace(scanner.Bytes())
+				if len(line) == 0 {
+					continue
+				}
+				raw := document.NewFieldBuffer()
+				if err := raw.UnmarshalJSON(line); err != nil {
+					return nil, err
+				}
+				fields := raw.Fields()
+				values := make([]document.Value, len(fields))
+				for i, field := range fields {
+					values[i], _ = raw.GetByField(field)
+				}
+				return toDoc(fields, values)
+			}
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+	case ExportFormatCSV:
+		cr := csv.NewReader(r)
+		header, err := cr.Read()
+		if err == io.EOF {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, Error{Reason: errImportInvalidRow, Err: fmt.Errorf("header: %v", err)}
+		}
+		values := make([]document.Value, len(header))
+		next = func() (*document.FieldBuffer, error) {
+			record, err := cr.Read()
+			if err != nil {
+				return nil, err
+			}
+			for i, cell := range record {
+				values[i] = document.NewTextValue(cell)
+			}
+			return toDoc(header, values)
+		}
+	default:
+		return 0, Error{Reason: errUnknownExportFormat, Err: fmt.Errorf("%q", format)}
+	}
+
+	insert := fmt.Sprintf("INSERT INTO %s VALUES ?", table)
+	var rows int64
+	batch := make([]*document.FieldBuffer, 0, importBatchSize)
+	commit := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := c.update(ctx, func(tx *genji.Tx) error {
+			for i, doc := range batch {
+				if err := tx.Exec(insert, doc); err != nil {
+					return Error{Reason: errImportInvalidRow, Err: fmt.Errorf("row %d: %v", rows+int64(i)+1, err)}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		rows += int64(len(batch))
+		batch = batch[:0]
+		return nil
+	}
+	for {
+		if err = ctx.Err(); err != nil {
+			return rows, err
+		}
+		doc, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return rows, Error{Reason: errImportInvalidRow, Err: fmt.Errorf("row %d: %v", rows+int64(len(batch))+1, err)}
+		}
+		if batch = append(batch, doc); len(batch) == importBatchSize {
+			if err = commit(); err != nil {
+				return rows, err
+			}
+		}
+	}
+	return rows, commit()
+}
+
+// ExportRequest selects the database and tables to export, every registered table when Tables is empty.
+type ExportRequest struct {
+	DbName string   `json:"dbName"`
+	Tables []string `json:"tables"`
+	ExportOptions
+}
+
+// ExportChunk is a piece of the export of one table, the first chunk of a CSV export holds the header row.
+type ExportChunk struct {
+	DbName string `json:"dbName"`
+	Table  string `json:"table"`
+	Format string `json:"format"`
+	Data   []byte `json:"data"`
+}
+
+// ExportStream is the sending side of an export, shaped as a server streaming RPC.
+type ExportStream interface {
+	Context() context.Context
+	Send(*ExportChunk) error
+}
+
+// chunkWriter cuts the export of a table into chunks sent on the stream.
+type chunkWriter struct {
+	stream ExportStream
+	chunk  ExportChunk
+	buf    []byte
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= exportChunkSize {
+		return len(p), w.Flush()
+	}
+	return len(p), nil
+}
+
+func (w *chunkWriter) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	chunk := w.chunk
+	chunk.Data = w.buf
+	w.buf = nil
+	return w.stream.Send(&chunk)
+}
+
+// Export streams the selected tables of the database.
+func (a *AllDBService) Export(in *ExportRequest, stream ExportStream) error {
+	if in == nil || in.DbName == "" {
+		return status.Errorf(codes.InvalidArgument, "database name has to be specified")
+	}
+	cdb := a.FindCoreDB(in.DbName)
+	if cdb == nil {
+		return status.Errorf(codes.InvalidArgument, "unable to find database with name: %s", in.DbName)
+	}
+	tables := in.Tables
+	if len(tables) == 0 {
+		tables = cdb.Tables()
+	}
+	format := in.Format
+	if format == "" {
+		format = ExportFormatJSONL
+	}
+	for _, table := range tables {
+		w := &chunkWriter{stream: stream, chunk: ExportChunk{DbName: in.DbName, Table: table, Format: format}}
+		_, err := cdb.ExportTable(stream.Context(), w, table, in.ExportOptions)
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			return exportStatus(cdb, table, err)
+		}
+	}
+	return nil
+}
+
+// ImportRequest carries the rows to import into a table of a database.
+type ImportRequest struct {
+	DbName string `json:"dbName"`
+	Table  string `json:"table"`
+	Format string `json:"format"`
+	Data   []byte `json:"data"`
+}
+
+// ImportStream is the receiving side of an import, shaped as a client streaming RPC as ExportStream,
+// the database, table and format are taken from the first request.
+type ImportStream interface {
+	Context() context.Context
+	Recv() (*ImportRequest, error)
+	SendAndClose(*ImportResult) error
+}
+
+type ImportResult struct {
+	DbName string `json:"dbName"`
+	Table  string `json:"table"`
+	Rows   int64  `json:"rows"`
+}
+
+// importReader concatenates the data of the requests received on the stream.
+type importReader struct {
+	stream ImportStream
+	data   []byte
+}
+
+func (r *importReader) Read(p []byte) (int, error) {
+	for len(r.data) == 0 {
+		in, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		r.data = in.Data
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// Import reads the rows streamed by the client into a table.
+func (a *AllDBService) Import(stream ImportStream) error {
+	in, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if in.DbName == "" || in.Table == "" {
+		return status.Errorf(codes.InvalidArgument, "database and table names have to be specified")
+	}
+	cdb := a.FindCoreDB(in.DbName)
+	if cdb == nil {
+		return status.Errorf(codes.InvalidArgument, "unable to find database with name: %s", in.DbName)
+	}
+	rows, err := cdb.ImportTable(stream.Context(), &importReader{stream: stream, data: in.Data}, in.Table, in.Format)
+	if err != nil {
+		return exportStatus(cdb, in.Table, err)
+	}
+	return stream.SendAndClose(&ImportResult{DbName: in.DbName, Table: in.Table, Rows: rows})
+}
+
+func exportStatus(cdb *CoreDB, table string, err error) error {
+	if e, ok := err.(Error); ok {
+		switch e.Reason {
+		case errTableNotRegistered, errUnknownColumn, errUnknownExportFormat, errImportInvalidRow:
+			return status.Errorf(codes.InvalidArgument, "%s.%s: %v", cdb.config.DbConfig.Name, table, err)
+		}
+	}
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return status.FromContextError(err).Err()
+	}
+	return status.Errorf(codes.Internal, "%s.%s: %v", cdb.config.DbConfig.Name, table, err)
+}
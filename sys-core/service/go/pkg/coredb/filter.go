@@ -0,0 +1,368 @@
+package coredb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// Filter operators.
+const (
+	FilterEq      = "eq"
+	FilterNeq     = "neq"
+	FilterLike    = "like"
+	FilterNotLike = "not_like"
+	FilterIn      = "in"
+	FilterNotIn   = "not_in"
+	FilterGt      = "gt"
+	FilterGte     = "gte"
+	FilterLt      = "lt"
+	FilterLte     = "lte"
+	// FilterBetween matches the inclusive range given as a [low, high] slice or array of any type.
+	FilterBetween = "between"
+	FilterIsNull  = "is_null"
+	FilterNotNull = "not_null"
+)
+
+var filterFieldRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// Filter is a filter expression, either an And or Or group of filters or the comparison
+// of a field to a value. In JSON:
+//
+//	{"and": [
+//	  {"field": "email", "op": "like", "value": "example.com"},
+//	  {"or": [
+//	    {"field": "created_at", "op": "between", "value": [1600000000, 1700000000]},
+//	    {"field": "last_login", "op": "is_null"}
+//	  ]}
+//	]}
+//
+// like matches the value anywhere in the field.
+type Filter struct {
+	And   []*Filter   `json:"and,omitempty"`
+	Or    []*Filter   `json:"or,omitempty"`
+	Field string      `json:"field,omitempty"`
+	Op    string      `json:"op,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// FilterFromParams matches every param with the same matcher, as the Matcher of list requests does.
+// Values which are not strings are compared for equality by like, nil values match nulls. It returns nil when there is no param.
+func FilterFromParams(params map[string]interface{}, matcher string) *Filter {
+	if len(params) == 0 {
+		return nil
+	}
+	op := matcherOp(matcher)
+	f := &Filter{}
+	for _, k := range getSortedKeys(params) {
+		leaf := &Filter{Field: k, Op: op, Value: params[k]}
+		if _, ok := leaf.Value.(string); op == FilterLike && !ok {
+			leaf.Op = FilterEq
+		}
+		if leaf.Value == nil {
+			leaf.Op = FilterIsNull
+		}
+		f.And = append(f.And, leaf)
+	}
+	return f
+}
+
+func matcherOp(matcher string) string {
+	switch ToSnakeCase(matcher) {
+	case "eq":
+		return FilterEq
+	case "not_eq":
+		return FilterNeq
+	case "in":
+		return FilterIn
+	case "not_in":
+		return FilterNotIn
+	case "gt":
+		return FilterGt
+	case "gte":
+		return FilterGte
+	case "lt":
+		return FilterLt
+	case "lte":
+		return FilterLte
+	default:
+		return FilterLike
+	}
+}
+
+// AndFilters combines the non nil filters, it returns nil when there is none.
+func AndFilters(filters ...*Filter) *Filter {
+	var and []*Filter
+	for _, f := range filters {
+		if f != nil {
+			and = append(and, f)
+		}
+	}
+	switch len(and) {
+	case 0:
+		return nil
+	case 1:
+		return and[0]
+	}
+	return &Filter{And: and}
+}
+
+// ParseFilter decodes the filter of a list request. A JSON object without and, or or field
+// key is the older map of field to value, matched with matcher.
+func ParseFilter(b []byte, matcher string) (*Filter, error) {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 || bytes.Equal(b, []byte("null")) {
+		return nil, nil
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, Error{Reason: errInvalidFilter, Err: err}
+	}
+	_, isAnd := raw["and"]
+	_, isOr := raw["or"]
+	_, isField := raw["field"]
+	if !isAnd && !isOr && !isField {
+		params := map[string]interface{}{}
+		if err := decodeJSONNumbers(b, &params); err != nil {
+			return nil, Error{Reason: errInvalidFilter, Err: err}
+		}
+		f := FilterFromParams(normalizeValue(params).(map[string]interface{}), matcher)
+		if f == nil {
+			return nil, nil
+		}
+		if err := f.Validate(); err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+	var f Filter
+	if err := decodeJSONNumbers(b, &f); err != nil {
+		return nil, Error{Reason: errInvalidFilter, Err: err}
+	}
+	f.normalize()
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func decodeJSONNumbers(b []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func (f *Filter) children() []*Filter {
+	return append(append([]*Filter{}, f.And...), f.Or...)
+}
+
+// normalize turns the json.Number values into int64 or float64 the store understands.
+func (f *Filter) normalize() {
+	for _, c := range f.children() {
+		if c != nil {
+			c.normalize()
+		}
+	}
+	f.Value = normalizeValue(f.Value)
+}
+
+func normalizeValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+		fl, _ := val.Float64()
+		if fl == math.Trunc(fl) && math.Abs(fl) < 1<<63 {
+			return int64(fl)
+		}
+		return fl
+	case []interface{}:
+		for i := range val {
+			val[i] = normalizeValue(val[i])
+		}
+	case map[string]interface{}:
+		for k := range val {
+			val[k] = normalizeValue(val[k])
+		}
+	}
+	return v
+}
+
+// Fields returns the fields the filter compares, in order of appearance.
+func (f *Filter) Fields() []string {
+	if f == nil {
+		return nil
+	}
+	var fields []string
+	for _, c := range f.children() {
+		fields = append(fields, c.Fields()...)
+	}
+	if f.Field != "" {
+		fields = append(fields, f.Field)
+	}
+	return fields
+}
+
+func invalidFilter(format string, args ...interface{}) error {
+	return Error{Reason: errInvalidFilter, Err: fmt.Errorf(format, args...)}
+}
+
+// Validate checks the shape of the filter, the fields and the operators.
+func (f *Filter) Validate() error {
+	if f == nil {
+		return invalidFilter("empty filter")
+	}
+	kinds := 0
+	for _, set := range []bool{f.And != nil, f.Or != nil, f.Field != ""} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return invalidFilter("a filter needs exactly one of and, or and field")
+	}
+	for _, c := range f.children() {
+		if err := c.Validate(); err != nil {
+			return err
+		}
+	}
+	if f.Field == "" {
+		if len(f.And)+len(f.Or) == 0 {
+			return invalidFilter("empty filter group")
+		}
+		return nil
+	}
+	if !filterFieldRe.MatchString(f.Field) {
+		return invalidFilter("invalid field %q", f.Field)
+	}
+	switch f.Op {
+	case FilterEq, FilterNeq, FilterGt, FilterGte, FilterLt, FilterLte:
+		if f.Value == nil || isListType(f.Value) {
+			return invalidFilter("%s on %s needs a single value", f.Op, f.Field)
+		}
+	case FilterLike, FilterNotLike:
+		if _, ok := f.Value.(string); !ok {
+			return invalidFilter("%s on %s needs a string value", f.Op, f.Field)
+		}
+	case FilterIn, FilterNotIn:
+		if !isListType(f.Value) {
+			return invalidFilter("%s on %s needs a list value", f.Op, f.Field)
+		}
+	case FilterBetween:
+		if len(listValues(f.Value)) != 2 {
+			return invalidFilter("between on %s needs a [low, high] value", f.Field)
+		}
+	case FilterIsNull, FilterNotNull:
+	default:
+		return invalidFilter("unknown operator %q on %s", f.Op, f.Field)
+	}
+	return nil
+}
+
+// listValues returns the elements of a slice or array of any type, as IN handles them,
+// and nil for any other value.
+func listValues(v interface{}) []interface{} {
+	if !isListType(v) {
+		return nil
+	}
+	list := reflect.ValueOf(v)
+	values := make([]interface{}, list.Len())
+	for i := range values {
+		values[i] = list.Index(i).Interface()
+	}
+	return values
+}
+
+// ToSql makes Filter a squirrel Sqlizer.
+func (f *Filter) ToSql() (string, []interface{}, error) {
+	if err := f.Validate(); err != nil {
+		return "", nil, err
+	}
+	return f.sqlizer().ToSql()
+}
+
+// parens wraps a comparison, genji mixes up the precedence of IS NOT and NOT IN with AND.
+type parens struct {
+	sq.Sqlizer
+}
+
+func (p parens) ToSql() (string, []interface{}, error) {
+	stmt, args, err := p.Sqlizer.ToSql()
+	return "(" + stmt + ")", args, err
+}
+
+func (f *Filter) sqlizer() sq.Sqlizer {
+	switch {
+	case f.And != nil:
+		and := sq.And{}
+		for _, c := range f.And {
+			and = append(and, c.sqlizer())
+		}
+		return and
+	case f.Or != nil:
+		or := sq.Or{}
+		for _, c := range f.Or {
+			or = append(or, c.sqlizer())
+		}
+		return or
+	}
+	return parens{f.comparison()}
+}
+
+func (f *Filter) comparison() sq.Sqlizer {
+	switch f.Op {
+	case FilterEq:
+		return sq.Eq{f.Field: f.Value}
+	case FilterNeq:
+		return sq.NotEq{f.Field: f.Value}
+	case FilterLike:
+		return sq.Like{f.Field: buildSearchQuery(f.Value.(string))}
+	case FilterNotLike:
+		return sq.NotLike{f.Field: buildSearchQuery(f.Value.(string))}
+	case FilterIn:
+		return sqIn{f.Field: f.Value}
+	case FilterNotIn:
+		return sqNotIn{f.Field: f.Value}
+	case FilterGt:
+		return sq.Gt{f.Field: f.Value}
+	case FilterGte:
+		return sq.GtOrEq{f.Field: f.Value}
+	case FilterLt:
+		return sq.Lt{f.Field: f.Value}
+	case FilterLte:
+		return sq.LtOrEq{f.Field: f.Value}
+	case FilterBetween:
+		bounds := listValues(f.Value)
+		return sq.And{sq.GtOrEq{f.Field: bounds[0]}, sq.LtOrEq{f.Field: bounds[1]}}
+	case FilterIsNull:
+		return sq.Expr(f.Field + " IS NULL")
+	default:
+		return sq.Expr(f.Field + " IS NOT NULL")
+	}
+}
+
+// String renders the filter for logs.
+func (f *Filter) String() string {
+	if f == nil {
+		return "<nil>"
+	}
+	stmt, args, err := f.ToSql()
+	if err != nil {
+		return err.Error()
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s %v", stmt, args))
+}
+
+// IsInvalidFilter reports whether err comes from a malformed filter.
+func IsInvalidFilter(err error) bool {
+	var e Error
+	return errors.As(err, &e) && e.Reason == errInvalidFilter
+}
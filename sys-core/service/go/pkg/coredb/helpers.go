@@ -7,9 +7,9 @@ import (
 
 func getStructTags(model interface{}) map[string]string {
 	fieldMap := map[string]string{}
-	fieldsLength := reflect.ValueOf(model).NumField()
-	for i := 0; i < fieldsLength; i++ {
-		field := reflect.TypeOf(model).Field(i)
+	modelType := reflect.Indirect(reflect.ValueOf(model)).Type()
+	for i := 0; i < modelType.NumField(); i++ {
+		field := modelType.Field(i)
 		fieldStructType := field.Type.String()
 		genjiTag := field.Tag.Get("genji")
 		switch fieldStructType {
@@ -30,11 +30,11 @@ func getStructTags(model interface{}) map[string]string {
 		default:
 			fieldMap[genjiTag] = "DOCUMENT"
 		}
-		coredbTag := field.Tag.Get("coredb")
-		if coredbTag == "primary" {
+		coredbTag := tagOptions(field.Tag.Get("coredb"))
+		if coredbTag[tagPrimary] {
 			fieldMap[genjiTag] += " PRIMARY KEY"
 		}
-		if coredbTag == "not_null" {
+		if coredbTag[tagNotNull] {
 			fieldMap[genjiTag] += " NOT NULL"
 		}
 	}
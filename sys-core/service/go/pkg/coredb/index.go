@@ -0,0 +1,337 @@
+package coredb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/genjidb/genji"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Secondary indexes are declared through the coredb tags of the model fields:
+//
+//	coredb:"index"          indexes the column, as idx_<table>_<column>
+//	coredb:"unique"         indexes the column, rejecting duplicate values
+//	coredb:"index=by_org"   names the index of the column idx_<table>_by_org
+//	coredb:"unique=handle"  names the unique index of the column idx_<table>_handle
+//
+// A field gets several named indexes with index=a|b. Genji indexes a single path, so an index
+// covers exactly one column: giving the same name to the indexes of two fields is refused.
+
+// Index is a secondary index of a table.
+type Index struct {
+	Name   string `json:"name"`
+	Table  string `json:"table"`
+	Column string `json:"column"`
+	Unique bool   `json:"unique"`
+}
+
+// Statement returns the statement creating the index.
+func (i Index) Statement() string {
+	create := "CREATE INDEX"
+	if i.Unique {
+		create = "CREATE UNIQUE INDEX"
+	}
+	return fmt.Sprintf("%s IF NOT EXISTS %s ON %s(%s)", create, i.Name, i.Table, i.Column)
+}
+
+// GetStructIndexes returns the indexes declared by the coredb tags of a model, by name.
+// The invalid declarations are left out, RegisterModels reports them.
+func GetStructIndexes(table string, model interface{}) []Index {
+	idxs, _ := structIndexes(table, model)
+	return idxs
+}
+
+// structIndexes reads the index and unique tags of a model struct or pointer to it.
+func structIndexes(table string, model interface{}) ([]Index, error) {
+	table = ToSnakeCase(table)
+	byName := map[string]*Index{}
+	add := func(name, column string, unique bool) error {
+		idx, ok := byName[name]
+		if !ok {
+			byName[name] = &Index{Name: "idx_" + table + "_" + name, Table: table, Column: column, Unique: unique}
+			return nil
+		}
+		if idx.Column != column {
+			return Error{Reason: errInvalidIndex, Err: fmt.Errorf(
+				"%s is declared on both %s and %s, genji has no index on several columns", idx.Name, idx.Column, column)}
+		}
+		if idx.Unique != unique {
+			return Error{Reason: errInvalidIndex, Err: fmt.Errorf("%s is declared both unique and not", idx.Name)}
+		}
+		return nil
+	}
+	modelType := reflect.Indirect(reflect.ValueOf(model)).Type()
+	for i := 0; i < modelType.NumField(); i++ {
+		field := modelType.Field(i)
+		column := field.Tag.Get("genji")
+		if column == "" {
+			column = strings.ToLower(field.Name)
+		}
+		tag := field.Tag.Get("coredb")
+		opts := tagOptions(tag)
+		for _, unique := range []bool{false, true} {
+			opt := tagIndex
+			if unique {
+				opt = tagUnique
+			}
+			names := []string{}
+			if opts[opt] {
+				names = append(names, column)
+			}
+			if v, ok := tagValue(tag, opt); ok {
+				names = append(names, strings.Split(v, "|")...)
+			}
+			for _, name := range names {
+				if name == "" {
+					return nil, Error{Reason: errInvalidIndex, Err: fmt.Errorf("%s.%s has an index without name", table, field.Name)}
+				}
+				if err := add(name, column, unique); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	var idxs []Index
+	for _, idx := range byName {
+		idxs = append(idxs, *idx)
+	}
+	sort.Slice(idxs, func(i, k int) bool { return idxs[i].Name < idxs[k].Name })
+	return idxs, nil
+}
+
+// IndexInfo describes an index of the database, declared by a model or not.
+type IndexInfo struct {
+	Index
+	// Path is the column genji indexes in the database, it differs from Column
+	// when the declaration changed since the index was created.
+	Path string `json:"path,omitempty"`
+	// Declared tells whether the model of the table declares the index.
+	Declared bool `json:"declared"`
+	// Present tells whether the index exists in the database,
+	// a declared index dropped since is created again by RebuildIndexes or MakeSchema.
+	Present bool `json:"present"`
+}
+
+// Indexes lists the indexes of the database along with the ones declared by the registered models,
+// by table and name.
+func (c *CoreDB) Indexes(ctx context.Context) ([]*IndexInfo, error) {
+	infos := map[string]*IndexInfo{}
+	for name, model := range c.models {
+		idxs, err := structIndexes(name, model)
+		if err != nil {
+			return nil, err
+		}
+		for _, idx := range idxs {
+			infos[idx.Name] = &IndexInfo{Index: idx, Declared: true}
+		}
+	}
+	err := c.view(ctx, func(tx *genji.Tx) error {
+		cfgs, err := tx.ListIndexes()
+		if err != nil {
+			return err
+		}
+		for _, cfg := range cfgs {
+			info, ok := infos[cfg.IndexName]
+			if !ok {
+				info = &IndexInfo{Index: Index{
+					Name:   cfg.IndexName,
+					Table:  cfg.TableName,
+					Column: cfg.Path.String(),
+					Unique: cfg.Unique,
+				}}
+				infos[cfg.IndexName] = info
+			}
+			info.Path, info.Present = cfg.Path.String(), true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*IndexInfo, 0, len(infos))
+	for _, info := range infos {
+		res = append(res, info)
+	}
+	sort.Slice(res, func(i, k int) bool {
+		if res[i].Table != res[k].Table {
+			return res[i].Table < res[k].Table
+		}
+		return res[i].Name < res[k].Name
+	})
+	return res, nil
+}
+
+// DropIndex drops an index of the database. A declared index comes back with RebuildIndexes
+// or the next MakeSchema.
+func (c *CoreDB) DropIndex(ctx context.Context, name string) error {
+	return c.update(ctx, func(tx *genji.Tx) error {
+		if _, err := tx.GetIndex(name); err != nil {
+			return Error{Reason: errIndexNotFound, Err: fmt.Errorf("%s: %v", name, err)}
+		}
+		return tx.Exec("DROP INDEX " + name)
+	})
+}
+
+// RebuildIndexes creates the missing declared indexes of table and rebuilds its existing ones,
+// of every table when table is empty, or only the index name when it is set.
+func (c *CoreDB) RebuildIndexes(ctx context.Context, table, name string) ([]string, error) {
+	infos, err := c.Indexes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var rebuilt []string
+	err = c.update(ctx, func(tx *genji.Tx) error {
+		rebuilt = nil
+		for _, info := range infos {
+			if (table != "" && info.Table != ToSnakeCase(table)) || (name != "" && info.Name != name) {
+				continue
+			}
+			if !info.Present {
+				if err := tx.Exec(info.Statement()); err != nil {
+					return fmt.Errorf("%s: %w", info.Name, err)
+				}
+			}
+			if err := tx.Exec("REINDEX " + info.Name); err != nil {
+				return fmt.Errorf("%s: %w", info.Name, err)
+			}
+			rebuilt = append(rebuilt, info.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if name != "" && len(rebuilt) == 0 {
+		return nil, Error{Reason: errIndexNotFound, Err: fmt.Errorf("%s", name)}
+	}
+	return rebuilt, nil
+}
+
+// indexNames lists the names of the indexes of the database.
+func indexNames(tx *genji.Tx) (map[string]bool, error) {
+	cfgs, err := tx.ListIndexes()
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, cfg := range cfgs {
+		names[cfg.IndexName] = true
+	}
+	return names, nil
+}
+
+// reindexNew fills in the indexes created since before was listed,
+// genji creates an index empty whatever the rows of its table.
+func reindexNew(tx *genji.Tx, before map[string]bool) error {
+	after, err := indexNames(tx)
+	if err != nil {
+		return err
+	}
+	for name := range after {
+		if before[name] {
+			continue
+		}
+		if err = tx.Exec("REINDEX " + name); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// IndexRequest selects the indexes of a database, by table or name.
+type IndexRequest struct {
+	DbName string `json:"dbName"`
+	Table  string `json:"table"`
+	Index  string `json:"index"`
+}
+
+type IndexesResult struct {
+	DbName  string       `json:"dbName"`
+	Indexes []*IndexInfo `json:"indexes"`
+}
+
+type IndexesAllResult struct {
+	Results []*IndexesResult `json:"results"`
+}
+
+type RebuildIndexesResult struct {
+	DbName  string   `json:"dbName"`
+	Rebuilt []string `json:"rebuilt"`
+}
+
+// ListIndexes lists the indexes of one or every registered database, of a table when set.
+func (a *AllDBService) ListIndexes(ctx context.Context, in *IndexRequest) (*IndexesAllResult, error) {
+	if in == nil {
+		in = &IndexRequest{}
+	}
+	cdbs, err := a.selectCoreDBs(in.DbName)
+	if err != nil {
+		return nil, err
+	}
+	res := &IndexesAllResult{}
+	for _, cdb := range cdbs {
+		infos, err := cdb.Indexes(ctx)
+		if err != nil {
+			return nil, indexStatusError(err)
+		}
+		var idxs []*IndexInfo
+		for _, info := range infos {
+			if (in.Table == "" || info.Table == ToSnakeCase(in.Table)) && (in.Index == "" || info.Name == in.Index) {
+				idxs = append(idxs, info)
+			}
+		}
+		res.Results = append(res.Results, &IndexesResult{DbName: cdb.config.DbConfig.Name, Indexes: idxs})
+	}
+	return res, nil
+}
+
+// DropIndex drops an index of a database.
+func (a *AllDBService) DropIndex(ctx context.Context, in *IndexRequest) (*IndexesResult, error) {
+	if in == nil || in.DbName == "" || in.Index == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "database and index names have to be specified")
+	}
+	cdb := a.FindCoreDB(in.DbName)
+	if cdb == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "unable to find database with name: %s", in.DbName)
+	}
+	if err := cdb.DropIndex(ctx, in.Index); err != nil {
+		return nil, indexStatusError(err)
+	}
+	return a.listIndexes(ctx, cdb, in.Table)
+}
+
+// RebuildIndexes rebuilds the indexes of a database, see CoreDB.RebuildIndexes.
+func (a *AllDBService) RebuildIndexes(ctx context.Context, in *IndexRequest) (*RebuildIndexesResult, error) {
+	if in == nil || in.DbName == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "database name has to be specified")
+	}
+	cdb := a.FindCoreDB(in.DbName)
+	if cdb == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "unable to find database with name: %s", in.DbName)
+	}
+	rebuilt, err := cdb.RebuildIndexes(ctx, in.Table, in.Index)
+	if err != nil {
+		return nil, indexStatusError(err)
+	}
+	return &RebuildIndexesResult{DbName: in.DbName, Rebuilt: rebuilt}, nil
+}
+
+func (a *AllDBService) listIndexes(ctx context.Context, cdb *CoreDB, table string) (*IndexesResult, error) {
+	res, err := a.ListIndexes(ctx, &IndexRequest{DbName: cdb.config.DbConfig.Name, Table: table})
+	if err != nil {
+		return nil, err
+	}
+	return res.Results[0], nil
+}
+
+func indexStatusError(err error) error {
+	if e, ok := err.(Error); ok && e.Reason == errIndexNotFound {
+		return status.Errorf(codes.NotFound, "%v", err)
+	}
+	return status.Errorf(codes.Internal, "%v", err)
+}
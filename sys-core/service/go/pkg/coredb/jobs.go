@@ -0,0 +1,337 @@
+package coredb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	sharedConfig "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
+)
+
+// jobHistoryLen is the number of runs kept per job.
+const jobHistoryLen = 20
+
+// JobFunc is the function of a job, the error it returns is recorded as the outcome of the run.
+type JobFunc func(ctx context.Context) error
+
+// job is a named job of the registry. The registry lives in memory, a paused job runs again
+// on its schedule once the service restarts.
+type job struct {
+	name string
+	// spec is the cron spec of the job, a job without spec only runs on demand
+	spec    string
+	fn      JobFunc
+	entry   cron.EntryID
+	paused  bool
+	running bool
+	// history holds the last runs, the most recent first
+	history []*CronResult
+}
+
+// JobStatus describes a registered job and its last runs, the most recent first.
+type JobStatus struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+	Paused   bool   `json:"paused"`
+	Running  bool   `json:"running"`
+	// NextRun is the unix time of the next scheduled run, zero while the job is paused,
+	// has no schedule or the scheduler is not started.
+	NextRun int64         `json:"nextRun,omitempty"`
+	LastRun *CronResult   `json:"lastRun,omitempty"`
+	History []*CronResult `json:"history,omitempty"`
+}
+
+// RegisterJob schedules fn with a cron spec under a name unique to the database.
+// A job registered without spec only runs through RunJob.
+func (c *CoreDB) RegisterJob(name, spec string, fn JobFunc) error {
+	if name == "" || fn == nil {
+		return Error{Reason: errInvalidJob, Err: fmt.Errorf("job %q without name or function", name)}
+	}
+	c.cronMu.Lock()
+	defer c.cronMu.Unlock()
+	if _, ok := c.jobs[name]; ok {
+		return Error{Reason: errInvalidJob, Err: fmt.Errorf("job %s is already registered", name)}
+	}
+	return c.addJob(&job{name: name, spec: spec, fn: fn})
+}
+
+// RegisterCronFunction schedules a function under the name of its spec,
+// suffixed with a number when another job has the name already.
+//
+// Deprecated: the failures of function go unnoticed, use RegisterJob.
+func (c *CoreDB) RegisterCronFunction(funcSpec string, function func()) error {
+	c.cronMu.Lock()
+	defer c.cronMu.Unlock()
+	name := funcSpec
+	for i := 2; c.jobs[name] != nil; i++ {
+		name = fmt.Sprintf("%s #%d", funcSpec, i)
+	}
+	return c.addJob(&job{name: name, spec: funcSpec, fn: func(context.Context) error {
+		function()
+		return nil
+	}})
+}
+
+// addJob registers and schedules j, c.cronMu must be held.
+func (c *CoreDB) addJob(j *job) error {
+	if err := c.scheduleJob(j); err != nil {
+		return Error{Reason: errInvalidJob, Err: fmt.Errorf("job %s: %v", j.name, err)}
+	}
+	if c.jobs == nil {
+		c.jobs = map[string]*job{}
+	}
+	c.jobs[j.name] = j
+	return nil
+}
+
+// scheduleJob hands j to the scheduler, c.cronMu must be held.
+func (c *CoreDB) scheduleJob(j *job) error {
+	if j.spec == "" {
+		return nil
+	}
+	id, err := c.crony.AddFunc(j.spec, func() { c.runScheduled(j.name) })
+	if err != nil {
+		return err
+	}
+	j.entry = id
+	return nil
+}
+
+// runJob runs a registered job, or fn in its place when not nil, and records the result.
+// It fails when the job is running already.
+func (c *CoreDB) runJob(ctx context.Context, name string, manual bool, fn JobFunc) (*CronResult, error) {
+	c.cronMu.Lock()
+	j, ok := c.jobs[name]
+	switch {
+	case !ok:
+		c.cronMu.Unlock()
+		return nil, Error{Reason: errJobNotFound, Err: fmt.Errorf("%s", name)}
+	case j.running:
+		c.cronMu.Unlock()
+		return nil, Error{Reason: errJobRunning, Err: fmt.Errorf("%s", name)}
+	}
+	j.running = true
+	if fn == nil {
+		fn = j.fn
+	}
+	c.cronMu.Unlock()
+
+	start, startedAt := time.Now(), sharedConfig.CurrentTimestamp()
+	err := runRecovered(ctx, fn)
+	res := &CronResult{
+		Job:       name,
+		StartedAt: startedAt,
+		Duration:  time.Since(start).Milliseconds(),
+		Manual:    manual,
+	}
+	if err != nil {
+		res.Error = err.Error()
+		c.logger.Errorf("%s %s job of %s failed: %v", moduleName, name, c.config.DbConfig.Name, err)
+	}
+	c.cronMu.Lock()
+	defer c.cronMu.Unlock()
+	j.running = false
+	j.history = append([]*CronResult{res}, j.history...)
+	if len(j.history) > jobHistoryLen {
+		j.history = j.history[:jobHistoryLen]
+	}
+	r := *res
+	return &r, nil
+}
+
+// runRecovered turns a panic of fn into its error, a panicking job would bring the service down.
+func runRecovered(ctx context.Context, fn JobFunc) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx)
+}
+
+// RunJob runs a registered job now, paused or not, and returns the result of the run.
+// The error of the job itself is part of the result.
+func (c *CoreDB) RunJob(ctx context.Context, name string) (*CronResult, error) {
+	return c.runJob(ctx, name, true, nil)
+}
+
+// PauseJob takes a job off the schedule until ResumeJob, the run in progress goes on.
+func (c *CoreDB) PauseJob(name string) error {
+	c.cronMu.Lock()
+	defer c.cronMu.Unlock()
+	j, ok := c.jobs[name]
+	if !ok {
+		return Error{Reason: errJobNotFound, Err: fmt.Errorf("%s", name)}
+	}
+	if !j.paused {
+		c.crony.Remove(j.entry)
+		j.paused, j.entry = true, 0
+	}
+	return nil
+}
+
+// ResumeJob puts a paused job back on its schedule.
+func (c *CoreDB) ResumeJob(name string) error {
+	c.cronMu.Lock()
+	defer c.cronMu.Unlock()
+	j, ok := c.jobs[name]
+	if !ok {
+		return Error{Reason: errJobNotFound, Err: fmt.Errorf("%s", name)}
+	}
+	if !j.paused {
+		return nil
+	}
+	if err := c.scheduleJob(j); err != nil {
+		return err
+	}
+	j.paused = false
+	return nil
+}
+
+// Jobs returns the status of the registered jobs, by name.
+func (c *CoreDB) Jobs() []*JobStatus {
+	c.cronMu.Lock()
+	defer c.cronMu.Unlock()
+	jobs := make([]*JobStatus, 0, len(c.jobs))
+	for _, j := range c.jobs {
+		jobs = append(jobs, c.jobStatus(j))
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].Name < jobs[k].Name })
+	return jobs
+}
+
+// Job returns the status of a registered job.
+func (c *CoreDB) Job(name string) (*JobStatus, error) {
+	c.cronMu.Lock()
+	defer c.cronMu.Unlock()
+	j, ok := c.jobs[name]
+	if !ok {
+		return nil, Error{Reason: errJobNotFound, Err: fmt.Errorf("%s", name)}
+	}
+	return c.jobStatus(j), nil
+}
+
+// jobStatus copies the state of j, c.cronMu must be held.
+func (c *CoreDB) jobStatus(j *job) *JobStatus {
+	js := &JobStatus{Name: j.name, Schedule: j.spec, Paused: j.paused, Running: j.running}
+	if j.entry != 0 {
+		if next := c.crony.Entry(j.entry).Next; !next.IsZero() {
+			js.NextRun = next.Unix()
+		}
+	}
+	for _, res := range j.history {
+		r := *res
+		js.History = append(js.History, &r)
+	}
+	if len(js.History) > 0 {
+		js.LastRun = js.History[0]
+	}
+	return js
+}
+
+// JobRequest selects a job of a database.
+type JobRequest struct {
+	DbName string `json:"dbName"`
+	Job    string `json:"job"`
+}
+
+type JobsResult struct {
+	DbName string       `json:"dbName"`
+	Jobs   []*JobStatus `json:"jobs"`
+}
+
+type JobsAllResult struct {
+	Results []*JobsResult `json:"results"`
+}
+
+type JobRunResult struct {
+	DbName string      `json:"dbName"`
+	Result *CronResult `json:"result"`
+}
+
+type JobStatusResult struct {
+	DbName string     `json:"dbName"`
+	Job    *JobStatus `json:"job"`
+}
+
+// ListJobs lists the jobs of one or every registered database.
+func (a *AllDBService) ListJobs(_ context.Context, in *BackupRequest) (*JobsAllResult, error) {
+	if in == nil {
+		in = &BackupRequest{}
+	}
+	cdbs, err := a.selectCoreDBs(in.DbName)
+	if err != nil {
+		return nil, err
+	}
+	res := &JobsAllResult{}
+	for _, cdb := range cdbs {
+		res.Results = append(res.Results, &JobsResult{DbName: cdb.config.DbConfig.Name, Jobs: cdb.Jobs()})
+	}
+	return res, nil
+}
+
+// RunJob runs a job of a database now and waits for it to end.
+func (a *AllDBService) RunJob(ctx context.Context, in *JobRequest) (*JobRunResult, error) {
+	cdb, err := a.findJobDB(in)
+	if err != nil {
+		return nil, err
+	}
+	res, err := cdb.RunJob(ctx, in.Job)
+	if err != nil {
+		return nil, jobStatusError(err)
+	}
+	return &JobRunResult{DbName: in.DbName, Result: res}, nil
+}
+
+// PauseJob takes a job of a database off its schedule, in the process running the schedule.
+func (a *AllDBService) PauseJob(_ context.Context, in *JobRequest) (*JobStatusResult, error) {
+	return a.updateJob(in, (*CoreDB).PauseJob)
+}
+
+// ResumeJob puts a paused job of a database back on its schedule.
+func (a *AllDBService) ResumeJob(_ context.Context, in *JobRequest) (*JobStatusResult, error) {
+	return a.updateJob(in, (*CoreDB).ResumeJob)
+}
+
+func (a *AllDBService) updateJob(in *JobRequest, update func(c *CoreDB, name string) error) (*JobStatusResult, error) {
+	cdb, err := a.findJobDB(in)
+	if err != nil {
+		return nil, err
+	}
+	if err = update(cdb, in.Job); err != nil {
+		return nil, jobStatusError(err)
+	}
+	js, err := cdb.Job(in.Job)
+	if err != nil {
+		return nil, jobStatusError(err)
+	}
+	return &JobStatusResult{DbName: in.DbName, Job: js}, nil
+}
+
+func (a *AllDBService) findJobDB(in *JobRequest) (*CoreDB, error) {
+	if in == nil || in.DbName == "" || in.Job == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "database and job names have to be specified")
+	}
+	cdb := a.FindCoreDB(in.DbName)
+	if cdb == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "unable to find database with name: %s", in.DbName)
+	}
+	return cdb, nil
+}
+
+func jobStatusError(err error) error {
+	if e, ok := err.(Error); ok {
+		switch e.Reason {
+		case errJobNotFound:
+			return status.Errorf(codes.NotFound, "%v", err)
+		case errJobRunning:
+			return status.Errorf(codes.FailedPrecondition, "%v", err)
+		}
+	}
+	return status.Errorf(codes.Internal, "%v", err)
+}
@@ -0,0 +1,186 @@
+package coredb
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"golang.org/x/crypto/argon2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/internal/helper"
+)
+
+const (
+	// KdfArgon2id derives a 256 bit master key using argon2id (default).
+	KdfArgon2id = "argon2id"
+	// KdfMD5 is the legacy derivation, only kept to open and re-key older databases.
+	KdfMD5 = "md5"
+
+	defaultArgonTime    = 1
+	defaultArgonMemory  = 64 * 1024
+	defaultArgonThreads = 4
+	masterKeyLen        = 32
+)
+
+// KeyOptions configures how the badger master key is derived from DbConfig.EncryptKey.
+type KeyOptions struct {
+	Kdf string `json:"kdf" yaml:"kdf" mapstructure:"kdf"`
+	// Salt defaults to a value derived from the database name.
+	Salt string `json:"salt" yaml:"salt" mapstructure:"salt"`
+	// Argon2id cost parameters, memory is in KiB.
+	Time    uint32 `json:"time" yaml:"time" mapstructure:"time"`
+	Memory  uint32 `json:"memory" yaml:"memory" mapstructure:"memory"`
+	Threads uint8  `json:"threads" yaml:"threads" mapstructure:"threads"`
+}
+
+func (k KeyOptions) withDefaults() KeyOptions {
+	if k.Kdf == "" {
+		k.Kdf = KdfArgon2id
+	}
+	if k.Time == 0 {
+		k.Time = defaultArgonTime
+	}
+	if k.Memory == 0 {
+		k.Memory = defaultArgonMemory
+	}
+	if k.Threads == 0 {
+		k.Threads = defaultArgonThreads
+	}
+	return k
+}
+
+// DeriveKey derives the master key of the database dbName from the configured secret.
+func (k KeyOptions) DeriveKey(dbName, secret string) ([]byte, error) {
+	k = k.withDefaults()
+	switch k.Kdf {
+	case KdfArgon2id:
+		salt := []byte(k.Salt)
+		if len(salt) == 0 {
+			sum := sha256.Sum256([]byte("coredb:" + dbName))
+			salt = sum[:16]
+		}
+		return argon2.IDKey([]byte(secret), salt, k.Time, k.Memory, k.Threads, masterKeyLen), nil
+	case KdfMD5:
+		return helper.MD5(secret), nil
+	default:
+		return nil, Error{Reason: errUnknownKdf, Err: fmt.Errorf("kdf %q", k.Kdf)}
+	}
+}
+
+// rewriteKeyRegistry re-encrypts the data keys of the (closed) badger database in dir
+// from oldKey to newKey. The data itself is encrypted with the data keys and is left untouched.
+func rewriteKeyRegistry(dir string, oldKey, newKey []byte, rotation time.Duration) error {
+	reg, err := badger.OpenKeyRegistry(badger.KeyRegistryOptions{
+		Dir:                           dir,
+		ReadOnly:                      true,
+		EncryptionKey:                 oldKey,
+		EncryptionKeyRotationDuration: rotation,
+	})
+	if err != nil {
+		return err
+	}
+	defer reg.Close()
+	return badger.WriteKeyRegistry(reg, badger.KeyRegistryOptions{
+		Dir:                           dir,
+		EncryptionKey:                 newKey,
+		EncryptionKeyRotationDuration: rotation,
+	})
+}
+
+// openStore opens the genji store on its storage engine, with the derived master key for badger.
+// Databases still encrypted with the legacy md5 key are re-keyed to the configured kdf on the fly.
+func (c *CoreDB) openStore() error {
+	dbCfg := c.config.DbConfig
+	var key []byte
+	if c.opts.Engine.kind() == EngineBadger {
+		var err error
+		if key, err = c.opts.Key.DeriveKey(dbCfg.Name, dbCfg.EncryptKey); err != nil {
+			return err
+		}
+	}
+	engine, err := c.openEngine(key)
+	if err == badger.ErrEncryptionKeyMismatch && c.opts.Key.withDefaults().Kdf != KdfMD5 {
+		c.logger.Warnf("%s %s is encrypted with the legacy md5 key, re-keying", moduleName, dbCfg.Name)
+		legacyKey := helper.MD5(dbCfg.EncryptKey)
+		if err = rewriteKeyRegistry(c.dbPath(), legacyKey, key, rotationDuration(dbCfg.RotationDuration)); err != nil {
+			return err
+		}
+		engine, err = c.openEngine(key)
+	}
+	if err != nil {
+		return err
+	}
+	store, err := newGenjiStore(engine, c.watchers)
+	if err != nil {
+		return err
+	}
+	c.store, c.engine = store, engine
+	return nil
+}
+
+// Rekey re-encrypts the database with a master key derived from newEncryptKey.
+// Queries wait while the database is closed to rewrite the key registry.
+// The new secret has to replace encryptKey in the config afterwards.
+func (c *CoreDB) Rekey(newEncryptKey string) error {
+	if newEncryptKey == "" {
+		return Error{Reason: errRekeyEmptyKey}
+	}
+	if _, err := c.badgerDB(); err != nil {
+		return err
+	}
+	dbCfg := c.config.DbConfig
+	oldKey, err := c.opts.Key.DeriveKey(dbCfg.Name, dbCfg.EncryptKey)
+	if err != nil {
+		return err
+	}
+	newKey, err := c.opts.Key.DeriveKey(dbCfg.Name, newEncryptKey)
+	if err != nil {
+		return err
+	}
+	c.storeMu.Lock()
+	defer c.storeMu.Unlock()
+	if err = c.store.Close(); err != nil {
+		return err
+	}
+	err = rewriteKeyRegistry(c.dbPath(), oldKey, newKey, rotationDuration(dbCfg.RotationDuration))
+	if err == nil {
+		c.config.DbConfig.EncryptKey = newEncryptKey
+	}
+	// reopen with whichever key is current now
+	if openErr := c.openStore(); openErr != nil {
+		return openErr
+	}
+	return err
+}
+
+// RekeyRequest selects the database to re-key and its new encryption secret.
+type RekeyRequest struct {
+	DbName        string `json:"dbName"`
+	NewEncryptKey string `json:"newEncryptKey"`
+}
+
+type RekeyResult struct {
+	DbName string `json:"dbName"`
+}
+
+// Rekey re-encrypts a registered database with a new master key.
+func (a *AllDBService) Rekey(_ context.Context, in *RekeyRequest) (*RekeyResult, error) {
+	if in == nil || in.DbName == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "database name has to be specified")
+	}
+	if in.NewEncryptKey == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "new encryption key has to be specified")
+	}
+	cdb := a.FindCoreDB(in.DbName)
+	if cdb == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "unable to find database with name: %s", in.DbName)
+	}
+	if err := cdb.Rekey(in.NewEncryptKey); err != nil {
+		return nil, status.Errorf(codes.Internal, "unable to re-key database %s: %v", in.DbName, err)
+	}
+	return &RekeyResult{DbName: in.DbName}, nil
+}
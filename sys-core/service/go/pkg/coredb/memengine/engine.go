@@ -0,0 +1,201 @@
+// Package memengine is a genji engine keeping the stores in memory.
+// It replaces the memory engine shipped with genji, which loses the keys deleted and put again
+// within a transaction, as an update of an indexed document does.
+//
+// A writable transaction works on lazy copies of the stores it touches and swaps them in on commit,
+// so the read-only transactions run alongside it on the last committed state.
+package memengine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/genjidb/genji/engine"
+	"github.com/google/btree"
+)
+
+const btreeDegree = 12
+
+// Engine is an in memory genji engine, its content is lost on close.
+type Engine struct {
+	// writeMu is held by the writable transaction in progress
+	writeMu sync.Mutex
+	// mu guards the committed stores
+	mu     sync.RWMutex
+	stores map[string]*tree
+	closed bool
+}
+
+// NewEngine creates an empty engine.
+func NewEngine() *Engine {
+	return &Engine{stores: map[string]*tree{}}
+}
+
+// tree is a store, never modified once committed.
+type tree struct {
+	bt  *btree.BTree
+	seq uint64
+}
+
+type item struct {
+	k, v []byte
+}
+
+func (i *item) Less(than btree.Item) bool {
+	return bytes.Compare(i.k, than.(*item).k) < 0
+}
+
+func (i *item) Key() []byte {
+	return i.k
+}
+
+func (i *item) ValueCopy(buf []byte) ([]byte, error) {
+	return append(buf[:0], i.v...), nil
+}
+
+// Begin starts a transaction, a writable one waits for the previous one to end.
+func (ng *Engine) Begin(ctx context.Context, opts engine.TxOptions) (engine.Transaction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if opts.Writable {
+		ng.writeMu.Lock()
+	}
+	ng.mu.RLock()
+	defer ng.mu.RUnlock()
+	if ng.closed {
+		if opts.Writable {
+			ng.writeMu.Unlock()
+		}
+		return nil, errors.New("memengine: engine closed")
+	}
+	stores := make(map[string]*tree, len(ng.stores))
+	for name, t := range ng.stores {
+		stores[name] = t
+	}
+	return &transaction{ctx: ctx, ng: ng, writable: opts.Writable, stores: stores, copied: map[string]bool{}}, nil
+}
+
+// Close drops the stores.
+func (ng *Engine) Close() error {
+	ng.mu.Lock()
+	defer ng.mu.Unlock()
+	if ng.closed {
+		return errors.New("memengine: engine already closed")
+	}
+	ng.closed = true
+	ng.stores = nil
+	return nil
+}
+
+type transaction struct {
+	ctx        context.Context
+	ng         *Engine
+	writable   bool
+	terminated bool
+	// stores is the state seen by the transaction, the committed one plus its own writes
+	stores map[string]*tree
+	// copied lists the stores copied by the transaction, which it may then modify
+	copied map[string]bool
+}
+
+func (t *transaction) end() {
+	t.terminated = true
+	if t.writable {
+		t.ng.writeMu.Unlock()
+	}
+}
+
+// Rollback discards the writes of the transaction, it does nothing once the transaction has ended.
+func (t *transaction) Rollback() error {
+	if t.terminated {
+		return nil
+	}
+	t.end()
+	return t.ctx.Err()
+}
+
+// Commit makes the writes of the transaction visible to the next transactions.
+func (t *transaction) Commit() error {
+	if t.terminated {
+		return errors.New("memengine: transaction already terminated")
+	}
+	if !t.writable {
+		return engine.ErrTransactionReadOnly
+	}
+	if err := t.ctx.Err(); err != nil {
+		t.end()
+		return err
+	}
+	t.ng.mu.Lock()
+	t.ng.stores = t.stores
+	t.ng.mu.Unlock()
+	t.end()
+	return nil
+}
+
+// check fails once the transaction is over or its context is done.
+func (t *transaction) check(write bool) error {
+	if err := t.ctx.Err(); err != nil {
+		return err
+	}
+	if t.terminated {
+		return errors.New("memengine: transaction already terminated")
+	}
+	if write && !t.writable {
+		return engine.ErrTransactionReadOnly
+	}
+	return nil
+}
+
+// writableTree returns the copy of a store the transaction may modify.
+func (t *transaction) writableTree(name string) (*tree, error) {
+	tr, ok := t.stores[name]
+	if !ok {
+		return nil, engine.ErrStoreNotFound
+	}
+	if !t.copied[name] {
+		tr = &tree{bt: tr.bt.Clone(), seq: tr.seq}
+		t.stores[name], t.copied[name] = tr, true
+	}
+	return tr, nil
+}
+
+// GetStore returns a store by name.
+func (t *transaction) GetStore(name []byte) (engine.Store, error) {
+	if err := t.check(false); err != nil {
+		return nil, err
+	}
+	if _, ok := t.stores[string(name)]; !ok {
+		return nil, engine.ErrStoreNotFound
+	}
+	return &store{tx: t, name: string(name)}, nil
+}
+
+// CreateStore creates a store, it fails if the store exists.
+func (t *transaction) CreateStore(name []byte) error {
+	if err := t.check(true); err != nil {
+		return err
+	}
+	if _, ok := t.stores[string(name)]; ok {
+		return engine.ErrStoreAlreadyExists
+	}
+	t.stores[string(name)] = &tree{bt: btree.New(btreeDegree)}
+	t.copied[string(name)] = true
+	return nil
+}
+
+// DropStore deletes a store and its key values.
+func (t *transaction) DropStore(name []byte) error {
+	if err := t.check(true); err != nil {
+		return err
+	}
+	if _, ok := t.stores[string(name)]; !ok {
+		return engine.ErrStoreNotFound
+	}
+	delete(t.stores, string(name))
+	delete(t.copied, string(name))
+	return nil
+}
@@ -0,0 +1,174 @@
+package memengine
+
+import (
+	"errors"
+
+	"github.com/genjidb/genji/engine"
+	"github.com/google/btree"
+)
+
+// store looks its tree up on every call, a write or a truncate replaces it.
+type store struct {
+	tx   *transaction
+	name string
+}
+
+func (s *store) tree() (*tree, error) {
+	tr, ok := s.tx.stores[s.name]
+	if !ok {
+		return nil, engine.ErrStoreNotFound
+	}
+	return tr, nil
+}
+
+// Get returns the value of a key.
+func (s *store) Get(k []byte) ([]byte, error) {
+	if err := s.tx.check(false); err != nil {
+		return nil, err
+	}
+	tr, err := s.tree()
+	if err != nil {
+		return nil, err
+	}
+	i := tr.bt.Get(&item{k: k})
+	if i == nil {
+		return nil, engine.ErrKeyNotFound
+	}
+	return i.(*item).v, nil
+}
+
+// Put stores a copy of a key value, replacing the previous value of the key.
+func (s *store) Put(k, v []byte) error {
+	if err := s.tx.check(true); err != nil {
+		return err
+	}
+	if len(k) == 0 {
+		return errors.New("memengine: empty keys are forbidden")
+	}
+	if len(v) == 0 {
+		return errors.New("memengine: empty values are forbidden")
+	}
+	tr, err := s.tx.writableTree(s.name)
+	if err != nil {
+		return err
+	}
+	tr.bt.ReplaceOrInsert(&item{k: append([]byte{}, k...), v: append([]byte{}, v...)})
+	return nil
+}
+
+// Delete removes a key value.
+func (s *store) Delete(k []byte) error {
+	if err := s.tx.check(true); err != nil {
+		return err
+	}
+	tr, err := s.tx.writableTree(s.name)
+	if err != nil {
+		return err
+	}
+	if tr.bt.Delete(&item{k: k}) == nil {
+		return engine.ErrKeyNotFound
+	}
+	return nil
+}
+
+// Truncate removes every key value of the store.
+func (s *store) Truncate() error {
+	if err := s.tx.check(true); err != nil {
+		return err
+	}
+	tr, err := s.tree()
+	if err != nil {
+		return err
+	}
+	s.tx.stores[s.name] = &tree{bt: btree.New(btreeDegree), seq: tr.seq}
+	s.tx.copied[s.name] = true
+	return nil
+}
+
+// NextSequence increments the sequence of the store.
+func (s *store) NextSequence() (uint64, error) {
+	if err := s.tx.check(true); err != nil {
+		return 0, err
+	}
+	tr, err := s.tx.writableTree(s.name)
+	if err != nil {
+		return 0, err
+	}
+	tr.seq++
+	return tr.seq, nil
+}
+
+// Iterator returns an iterator on the keys of the store, it has to be positioned with Seek.
+func (s *store) Iterator(opts engine.IteratorOptions) engine.Iterator {
+	return &iterator{store: s, reverse: opts.Reverse}
+}
+
+// iterator looks the next key up in the tree on every move, rather than walking it,
+// so that the transaction can modify the store while iterating.
+type iterator struct {
+	store   *store
+	reverse bool
+	item    *item
+	err     error
+}
+
+// find moves to the first key from k on, or the last one up to k in reverse, k itself excluded
+// unless inclusive. An empty k stands for the first key, or the last one in reverse.
+func (it *iterator) find(k []byte, inclusive bool) {
+	it.item = nil
+	if it.err = it.store.tx.check(false); it.err != nil {
+		return
+	}
+	tr, err := it.store.tree()
+	if err != nil {
+		it.err = err
+		return
+	}
+	next := func(i btree.Item) bool {
+		if !inclusive && len(k) > 0 && string(i.(*item).k) == string(k) {
+			return true
+		}
+		it.item = i.(*item)
+		return false
+	}
+	switch {
+	case len(k) == 0 && it.reverse:
+		tr.bt.Descend(next)
+	case len(k) == 0:
+		tr.bt.Ascend(next)
+	case it.reverse:
+		tr.bt.DescendLessOrEqual(&item{k: k}, next)
+	default:
+		tr.bt.AscendGreaterOrEqual(&item{k: k}, next)
+	}
+}
+
+// Seek moves to k, or to the key right after it, or before it when iterating in reverse.
+func (it *iterator) Seek(k []byte) {
+	it.find(k, true)
+}
+
+// Next moves to the following key.
+func (it *iterator) Next() {
+	if !it.Valid() {
+		return
+	}
+	it.find(it.item.k, false)
+}
+
+func (it *iterator) Err() error {
+	return it.err
+}
+
+func (it *iterator) Valid() bool {
+	return it.err == nil && it.item != nil
+}
+
+func (it *iterator) Item() engine.Item {
+	return it.item
+}
+
+func (it *iterator) Close() error {
+	it.item = nil
+	return nil
+}
@@ -0,0 +1,340 @@
+package coredb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/genjidb/genji"
+	"github.com/genjidb/genji/database"
+	"github.com/genjidb/genji/document"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	sharedConfig "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
+)
+
+const (
+	migrationsTableName = "core_migrations"
+)
+
+// Migration is a single numbered schema change of a registered database.
+// Up statements are executed when migrating to Version,
+// Down statements when rolling it back again.
+type Migration struct {
+	Version     int
+	Description string
+	Up          []string
+	Down        []string
+}
+
+// MigrationStatus describes a registered migration and whether it is applied.
+type MigrationStatus struct {
+	Version     int    `json:"version"`
+	Description string `json:"description"`
+	Applied     bool   `json:"applied"`
+	AppliedAt   int64  `json:"appliedAt,omitempty"`
+}
+
+// appliedMigration is the bookkeeping row of the migrations table.
+type appliedMigration struct {
+	Version     int    `genji:"version" coredb:"primary"`
+	Description string `genji:"description"`
+	AppliedAt   int64  `genji:"applied_at"`
+}
+
+func (m appliedMigration) CreateSQL() []string {
+	fields := GetStructTags(m)
+	tbl := NewTable(migrationsTableName, fields, []string{})
+	return tbl.CreateTable()
+}
+
+// RegisterMigrations registers the numbered migrations of the database,
+// they will be applied in ascending order of their version.
+func (c *CoreDB) RegisterMigrations(migrations []Migration) error {
+	seen := map[int]bool{}
+	for _, m := range migrations {
+		if m.Version <= 0 {
+			return Error{Reason: errMigrationInvalidVersion, Err: fmt.Errorf("version %d", m.Version)}
+		}
+		if seen[m.Version] {
+			return Error{Reason: errMigrationDuplicateVersion, Err: fmt.Errorf("version %d", m.Version)}
+		}
+		seen[m.Version] = true
+	}
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+	c.migrations = sorted
+	return nil
+}
+
+// isFreshSchema reports whether none of the registered model tables exist yet,
+// in which case CreateSQL already yields the latest schema.
+func (c *CoreDB) isFreshSchema() (bool, error) {
+	fresh := true
+	err := c.view(context.Background(), func(tx *genji.Tx) error {
+		for tblName := range c.models {
+			_, err := tx.GetTable(ToSnakeCase(tblName))
+			if err == nil {
+				fresh = false
+				return nil
+			}
+			if !errors.Is(err, database.ErrTableNotFound) {
+				return err
+			}
+		}
+		return nil
+	})
+	return fresh, err
+}
+
+func (c *CoreDB) appliedMigrations() (map[int]appliedMigration, error) {
+	applied := map[int]appliedMigration{}
+	stmt, args, err := sq.Select("version", "description", "applied_at").
+		From(migrationsTableName).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	err = res.Iterate(func(d document.Document) error {
+		var am appliedMigration
+		if err := document.StructScan(d, &am); err != nil {
+			return err
+		}
+		applied[am.Version] = am
+		return nil
+	})
+	return applied, err
+}
+
+// stampMigrations marks every registered migration as applied without running it.
+func (c *CoreDB) stampMigrations(tx *genji.Tx) error {
+	now := sharedConfig.CurrentTimestamp()
+	for _, m := range c.migrations {
+		stmt, args, err := sq.Insert(migrationsTableName).
+			Columns("version", "description", "applied_at").
+			Values(m.Version, m.Description, now).ToSql()
+		if err != nil {
+			return err
+		}
+		if err = tx.Exec(stmt, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *CoreDB) runMigration(m Migration, up bool) error {
+	return c.update(context.Background(), func(tx *genji.Tx) error {
+		stmts := m.Up
+		if !up {
+			stmts = m.Down
+		}
+		for _, stmt := range stmts {
+			c.logger.Debugf("executing %s", stmt)
+			if err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		var bookStmt string
+		var bookArgs []interface{}
+		var err error
+		if up {
+			bookStmt, bookArgs, err = sq.Insert(migrationsTableName).
+				Columns("version", "description", "applied_at").
+				Values(m.Version, m.Description, sharedConfig.CurrentTimestamp()).ToSql()
+		} else {
+			bookStmt, bookArgs, err = sq.Delete(migrationsTableName).
+				Where(sq.Eq{"version": m.Version}).ToSql()
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Exec(bookStmt, bookArgs...)
+	})
+}
+
+func (c *CoreDB) isRegisteredVersion(version int) bool {
+	for _, m := range c.migrations {
+		if m.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// MigrateUp applies every pending migration up to and including target.
+// A zero target applies all registered migrations.
+func (c *CoreDB) MigrateUp(target int) ([]*MigrationStatus, error) {
+	if target != 0 && !c.isRegisteredVersion(target) {
+		return nil, Error{Reason: errMigrationUnknownVersion, Err: fmt.Errorf("version %d", target)}
+	}
+	applied, err := c.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range c.migrations {
+		if target != 0 && m.Version > target {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		c.logger.Infof("%s applying migration %d (%s) on %s", moduleName, m.Version, m.Description, c.config.DbConfig.Name)
+		if err = c.runMigration(m, true); err != nil {
+			return nil, fmt.Errorf("migration %d failed: %v", m.Version, err)
+		}
+	}
+	return c.ListMigrations()
+}
+
+// MigrateDown rolls back every applied migration newer than target.
+// A zero target rolls back all registered migrations.
+func (c *CoreDB) MigrateDown(target int) ([]*MigrationStatus, error) {
+	if target != 0 && !c.isRegisteredVersion(target) {
+		return nil, Error{Reason: errMigrationUnknownVersion, Err: fmt.Errorf("version %d", target)}
+	}
+	applied, err := c.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(c.migrations) - 1; i >= 0; i-- {
+		m := c.migrations[i]
+		if m.Version <= target {
+			break
+		}
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		c.logger.Infof("%s rolling back migration %d (%s) on %s", moduleName, m.Version, m.Description, c.config.DbConfig.Name)
+		if err = c.runMigration(m, false); err != nil {
+			return nil, fmt.Errorf("rollback of migration %d failed: %v", m.Version, err)
+		}
+	}
+	return c.ListMigrations()
+}
+
+// ListMigrations lists all registered migrations alongside their applied state.
+func (c *CoreDB) ListMigrations() ([]*MigrationStatus, error) {
+	applied, err := c.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	var statuses []*MigrationStatus
+	for _, m := range c.migrations {
+		ms := &MigrationStatus{Version: m.Version, Description: m.Description}
+		if am, ok := applied[m.Version]; ok {
+			ms.Applied = true
+			ms.AppliedAt = am.AppliedAt
+		}
+		statuses = append(statuses, ms)
+	}
+	return statuses, nil
+}
+
+// SchemaVersion returns the highest applied migration version, or zero if none is applied.
+func (c *CoreDB) SchemaVersion() (int, error) {
+	applied, err := c.appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+	version := 0
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	return version, nil
+}
+
+// MigrationRequest selects the database and the version to migrate to.
+// An empty DbName targets every registered database, in which case
+// TargetVersion has to be zero (latest for Migrate, nothing for Rollback).
+type MigrationRequest struct {
+	DbName        string `json:"dbName"`
+	TargetVersion int    `json:"targetVersion"`
+}
+
+type MigrationResult struct {
+	DbName         string             `json:"dbName"`
+	CurrentVersion int                `json:"currentVersion"`
+	Migrations     []*MigrationStatus `json:"migrations"`
+}
+
+type MigrationAllResult struct {
+	Results []*MigrationResult `json:"results"`
+}
+
+func (a *AllDBService) selectCoreDBs(name string) ([]*CoreDB, error) {
+	if name == "" {
+		return a.RegisteredDBs, nil
+	}
+	cdb := a.FindCoreDB(name)
+	if cdb == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "unable to find database with name: %s", name)
+	}
+	return []*CoreDB{cdb}, nil
+}
+
+func (a *AllDBService) migrationResults(in *MigrationRequest, fn func(cdb *CoreDB) ([]*MigrationStatus, error)) (*MigrationAllResult, error) {
+	if in == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "migration request has to be specified")
+	}
+	if in.DbName == "" && in.TargetVersion != 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "target version requires a database name")
+	}
+	cdbs, err := a.selectCoreDBs(in.DbName)
+	if err != nil {
+		return nil, err
+	}
+	var results []*MigrationResult
+	for _, cdb := range cdbs {
+		statuses, err := fn(cdb)
+		if err != nil {
+			if e, ok := err.(Error); ok && e.Reason == errMigrationUnknownVersion {
+				return nil, status.Errorf(codes.InvalidArgument, "%s: %v", cdb.config.DbConfig.Name, err)
+			}
+			return nil, status.Errorf(codes.Internal, "unable to migrate database %s: %v", cdb.config.DbConfig.Name, err)
+		}
+		version, err := cdb.SchemaVersion()
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "unable to get schema version of %s: %v", cdb.config.DbConfig.Name, err)
+		}
+		results = append(results, &MigrationResult{
+			DbName:         cdb.config.DbConfig.Name,
+			CurrentVersion: version,
+			Migrations:     statuses,
+		})
+	}
+	return &MigrationAllResult{Results: results}, nil
+}
+
+// ListMigrations lists migrations of one or every registered database.
+func (a *AllDBService) ListMigrations(_ context.Context, in *MigrationRequest) (*MigrationAllResult, error) {
+	return a.migrationResults(in, func(cdb *CoreDB) ([]*MigrationStatus, error) {
+		return cdb.ListMigrations()
+	})
+}
+
+// Migrate applies pending migrations of one or every registered database.
+func (a *AllDBService) Migrate(_ context.Context, in *MigrationRequest) (*MigrationAllResult, error) {
+	return a.migrationResults(in, func(cdb *CoreDB) ([]*MigrationStatus, error) {
+		return cdb.MigrateUp(in.TargetVersion)
+	})
+}
+
+// Rollback rolls back migrations of one or every registered database.
+func (a *AllDBService) Rollback(_ context.Context, in *MigrationRequest) (*MigrationAllResult, error) {
+	return a.migrationResults(in, func(cdb *CoreDB) ([]*MigrationStatus, error) {
+		return cdb.MigrateDown(in.TargetVersion)
+	})
+}
@@ -6,7 +6,7 @@ import (
 	"github.com/dgraph-io/badger/v2"
 	"github.com/genjidb/genji"
 	"github.com/genjidb/genji/document"
-	"github.com/genjidb/genji/engine/badgerengine"
+	genjiEngine "github.com/genjidb/genji/engine"
 	"github.com/genjidb/genji/sql/query"
 	sharedConfig "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
 	commonCfg "go.amplifyedge.org/sys-share-v2/sys-core/service/config/common"
@@ -15,6 +15,7 @@ import (
 	"github.com/robfig/cron/v3"
 	"github.com/segmentio/encoding/json"
 	stdlog "log"
+	"sync"
 	"text/template"
 	"time"
 
@@ -26,6 +27,11 @@ const (
 	week = 24 * time.Hour * 7
 )
 
+// AllDBService administers the registered databases. Backup, Restore and ListBackup implement the
+// DbAdminService of sys-core rpc; its proto is maintained in sys-share, which does not declare the
+// other administration methods. These take and return the plain Go types declared next to them and
+// are called in process, by the dbadmin command or by the service embedding the databases, not by
+// gRPC clients.
 type AllDBService struct {
 	RegisteredDBs []*CoreDB
 	*coreRpc.UnimplementedDbAdminServiceServer
@@ -50,62 +56,107 @@ func (a *AllDBService) FindCoreDB(name string) *CoreDB {
 
 // CoreDB is the exported struct
 type CoreDB struct {
-	logger    log.Logger
-	store     *genji.DB
-	engine    *badgerengine.Engine
-	models    map[string]DbModel
-	config    *commonCfg.Config
-	crony     *cron.Cron
-	cronFuncs map[string]func()
+	logger     log.Logger
+	store      *genji.DB
+	engine     genjiEngine.Engine
+	models     map[string]DbModel
+	access     map[string]*FieldAccess
+	expiries   map[string][]expiry
+	migrations []Migration
+	config     *commonCfg.Config
+	opts       Options
+	target     BackupTarget
+	crony      *cron.Cron
+	cronFuncs  map[string]func()
+	backupMu   sync.Mutex
+	// cronMu guards the job registry
+	cronMu   sync.Mutex
+	jobs     map[string]*job
+	cronLock cronLock
+	watchers *watchHub
+	// storeMu is held exclusively while the store is closed and reopened
+	storeMu sync.RWMutex
 }
 
-// NewCoreDB facilitates creation of (wrapped) genji database alongside badger DB engine
+// NewCoreDB facilitates creation of (wrapped) genji database alongside its storage engine,
+// badger unless Options.Engine says otherwise,
 // if one wants to use one or the other.
 // or if internally will use the underlying badger DB engine to create Stream for example
 // for backup, restore, or anything
 func NewCoreDB(l log.Logger, cfg *commonCfg.Config, cronFuncs map[string]func()) (*CoreDB, error) {
-	dbName := cfg.DbConfig.Name
-	dbPath := cfg.DbConfig.DbDir + "/" + dbName
-	store, engine, err := newGenjiStore(dbPath, cfg.DbConfig.EncryptKey, cfg.DbConfig.RotationDuration)
-	if err != nil {
-		return nil, err
-	}
+	return NewCoreDBWithOptions(l, cfg, cronFuncs, Options{})
+}
+
+// NewCoreDBWithOptions is NewCoreDB with the CoreDB specific Options.
+func NewCoreDBWithOptions(l log.Logger, cfg *commonCfg.Config, cronFuncs map[string]func(), opts Options) (*CoreDB, error) {
 	cdb := &CoreDB{
 		logger:    l,
-		store:     store,
-		engine:    engine,
 		models:    map[string]DbModel{},
 		config:    cfg,
+		opts:      opts,
 		cronFuncs: cronFuncs,
+		crony:     cron.New(),
+		watchers:  newWatchHub(),
+	}
+	target, err := newBackupTarget(opts.Target, cfg.CronConfig.BackupDir)
+	if err != nil {
+		return nil, err
+	}
+	cdb.target = target
+	if err = cdb.openStore(); err != nil {
+		return nil, err
+	}
+	if cdb.cronLock, err = cdb.newCronLock(); err != nil {
+		return nil, err
 	}
 	err = cdb.scheduleBackup()
 	if err != nil {
 		return nil, err
 	}
-	cdb.crony.Start()
+	if err = cdb.scheduleGC(); err != nil {
+		return nil, err
+	}
+	if err = cdb.scheduleTTL(); err != nil {
+		return nil, err
+	}
+	if !opts.Cron.Disabled {
+		cdb.crony.Start()
+	}
 	return cdb, nil
 }
 
-// helper function to create genji.DB
-func newGenjiStore(path, encKey string, keyRotationSchedule int) (*genji.DB, *badgerengine.Engine, error) {
-	// badgerengine options with encryption and encryption key rotation
-	options := createBadgerOpts(path, encKey, keyRotationSchedule)
-	// TODO: encryption key rotation is currently disabled, which is not great
-	// WithEncryptionKeyRotationDuration(time.Duration(keyRotationSchedule) * day)
-	engine, err := badgerengine.NewEngine(options)
-	if err != nil {
-		return nil, nil, err
+func (c *CoreDB) dbPath() string {
+	return c.config.DbConfig.DbDir + "/" + c.config.DbConfig.Name
+}
+
+// helper function to create genji.DB on a storage engine, the writes are published to hub unless it is nil
+func newGenjiStore(engine genjiEngine.Engine, hub *watchHub) (*genji.DB, error) {
+	ng := engine
+	if hub != nil {
+		ng = newWatchEngine(engine, hub)
 	}
-	store, err := genji.New(context.Background(), engine)
+	store, err := genji.New(context.Background(), ng)
 	if err != nil {
-		return nil, nil, err
+		_ = engine.Close()
+		return nil, err
 	}
-	return store, engine, nil
+	return store, nil
 }
 
-func createBadgerOpts(path, encKey string, keyRotationSchedule int) badger.Options {
+// rotationDuration converts the configured rotation in days, badger's own default is used when unset.
+func rotationDuration(keyRotationSchedule int) time.Duration {
+	if keyRotationSchedule <= 0 {
+		return 10 * day
+	}
+	return time.Duration(keyRotationSchedule) * day
+}
+
+// createBadgerOpts sets the master key, badger rotates the data keys it encrypts
+// every keyRotationSchedule days.
+func createBadgerOpts(path string, encKey []byte, keyRotationSchedule int) badger.Options {
 	return badger.DefaultOptions(path).
-		WithEncryptionKey(helper.MD5(encKey))
+		WithEncryptionKey(encKey).
+		WithEncryptionKeyRotationDuration(rotationDuration(keyRotationSchedule))
 }
 
 const (
@@ -119,10 +170,17 @@ type Table struct {
 	Name            string
 	Fields          map[string]string
 	IndexStatements []string
+	// Indexes are created after the IndexStatements.
+	Indexes []Index
 }
 
 func NewTable(name string, fields map[string]string, indexStatements []string) *Table {
-	return &Table{name, fields, indexStatements}
+	return &Table{Name: name, Fields: fields, IndexStatements: indexStatements}
+}
+
+// NewModelTable creates the table of a model, its columns and indexes read from the struct tags.
+func NewModelTable(name string, model interface{}) *Table {
+	return &Table{Name: name, Fields: GetStructTags(model), Indexes: GetStructIndexes(name, model)}
 }
 
 // Utility function for each consumer to create their own module
@@ -142,6 +200,9 @@ func (t *Table) CreateTable() []string {
 	}
 	tblInitStatements = append(tblInitStatements, bf.String())
 	tblInitStatements = append(tblInitStatements, t.IndexStatements...)
+	for _, idx := range t.Indexes {
+		tblInitStatements = append(tblInitStatements, idx.Statement())
+	}
 	return tblInitStatements
 }
 
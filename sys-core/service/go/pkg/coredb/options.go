@@ -0,0 +1,17 @@
+package coredb
+
+// Options holds the CoreDB settings which are not part of the shared DbConfig.
+// The zero value is valid and uses the defaults.
+type Options struct {
+	Key       KeyOptions       `json:"key" yaml:"key" mapstructure:"key"`
+	Backup    BackupOptions    `json:"backup" yaml:"backup" mapstructure:"backup"`
+	Retention RetentionOptions `json:"retention" yaml:"retention" mapstructure:"retention"`
+	Restore   RestoreOptions   `json:"restore" yaml:"restore" mapstructure:"restore"`
+	// Target is where backups are stored.
+	Target BackupTargetOptions `json:"target" yaml:"target" mapstructure:"target"`
+	GC     GCOptions           `json:"gc" yaml:"gc" mapstructure:"gc"`
+	Query  QueryOptions        `json:"query" yaml:"query" mapstructure:"query"`
+	TTL    TTLOptions          `json:"ttl" yaml:"ttl" mapstructure:"ttl"`
+	Engine EngineOptions       `json:"engine" yaml:"engine" mapstructure:"engine"`
+	Cron   CronOptions         `json:"cron" yaml:"cron" mapstructure:"cron"`
+}
@@ -0,0 +1,347 @@
+package coredb
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/genjidb/genji/document"
+)
+
+const (
+	defaultPageIDColumn = "id"
+	defaultPageLimit    = 50
+)
+
+// PageRequest asks for a page of a list, Cursor is the NextCursor of the previous page
+// and empty for the first one.
+type PageRequest struct {
+	OrderBy    string `json:"orderBy"`
+	Descending bool   `json:"descending"`
+	Limit      int64  `json:"limit"`
+	Cursor     string `json:"cursor"`
+}
+
+// PageQuery is a PageRequest on the rows of a table matching Filter.
+type PageQuery struct {
+	PageRequest
+	Table   string
+	Columns string
+	// Filter restricts the rows, nil matches them all. When it is a *Filter on a registered
+	// table its fields are checked against the FieldAccess of the model, as is OrderBy.
+	Filter sq.Sqlizer
+	// Scope restricts the rows like Filter, without the field checks.
+	// It is meant for the restrictions set by the server, not the client.
+	// Expired rows are always left out.
+	Scope sq.Sqlizer
+	// IDColumn breaks ties between rows with the same sort key, it must be unique
+	// and defaults to id. OrderBy defaults to it as well.
+	IDColumn string
+}
+
+// PageInfo describes where a page stands in the whole list.
+type PageInfo struct {
+	// NextCursor is empty on the last page.
+	NextCursor string `json:"nextCursor"`
+	HasMore    bool   `json:"hasMore"`
+	// Total counts the rows matching the filter across all pages. It is only counted
+	// for the first page and is -1 on the next ones.
+	Total int64 `json:"total"`
+}
+
+type Page struct {
+	PageInfo
+	Docs []document.Document
+}
+
+// Iterate calls fn on the documents of the page in order.
+func (p *Page) Iterate(fn func(d document.Document) error) error {
+	for _, d := range p.Docs {
+		if err := fn(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pageCursor is the sort key and id of the last row of a page.
+// It is handed out as base64 encoded JSON, which keeps the genji type of the values.
+type pageCursor struct {
+	key, id document.Value
+}
+
+func (pc pageCursor) encode() (string, error) {
+	fb := document.NewFieldBuffer().Add("k", pc.key).Add("i", pc.id)
+	b, err := document.MarshalJSON(fb)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// IsInvalidCursor reports whether err comes from a malformed page cursor.
+func IsInvalidCursor(err error) bool {
+	var e Error
+	return errors.As(err, &e) && e.Reason == errInvalidCursor
+}
+
+// IsInvalidQuery reports whether err comes from a page request the client got wrong:
+// a malformed cursor or filter, or a field it may not sort or filter on.
+func IsInvalidQuery(err error) bool {
+	var e Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	switch e.Reason {
+	case errInvalidCursor, errInvalidFilter, errFieldNotAllowed:
+		return true
+	}
+	return false
+}
+
+func decodeCursor(cursor string) (*pageCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, Error{Reason: errInvalidCursor, Err: err}
+	}
+	var fb document.FieldBuffer
+	if err = fb.UnmarshalJSON(b); err != nil {
+		return nil, Error{Reason: errInvalidCursor, Err: err}
+	}
+	var pc pageCursor
+	if pc.key, err = fb.GetByField("k"); err != nil {
+		return nil, Error{Reason: errInvalidCursor, Err: err}
+	}
+	if pc.id, err = fb.GetByField("i"); err != nil {
+		return nil, Error{Reason: errInvalidCursor, Err: err}
+	}
+	return &pc, nil
+}
+
+// QueryPage returns a page of documents ordered by (OrderBy, IDColumn).
+//
+// genji only orders by a single field and does not keep ties in a stable order, so the rows
+// sharing the sort key of the cursor, or of the end of the page, are fetched ordered by id.
+// The rows without a sort key come first in ascending order and last in descending order.
+func (t *Tx) QueryPage(pq PageQuery) (*Page, error) {
+	if pq.IDColumn == "" {
+		pq.IDColumn = defaultPageIDColumn
+	}
+	if pq.OrderBy == "" {
+		pq.OrderBy = pq.IDColumn
+	}
+	if pq.Limit <= 0 {
+		pq.Limit = defaultPageLimit
+	}
+	if !filterFieldRe.MatchString(pq.OrderBy) {
+		return nil, notAllowed("cannot sort on %q", pq.OrderBy)
+	}
+	if access := t.db.fieldAccess(pq.Table); access != nil {
+		if pq.OrderBy != pq.IDColumn {
+			if err := access.CheckSort(pq.OrderBy); err != nil {
+				return nil, err
+			}
+		}
+		if f, ok := pq.Filter.(*Filter); ok && f != nil {
+			if err := access.CheckFilter(f); err != nil {
+				return nil, err
+			}
+		}
+	}
+	var cursor *pageCursor
+	if pq.Cursor != "" {
+		var err error
+		if cursor, err = decodeCursor(pq.Cursor); err != nil {
+			return nil, err
+		}
+	}
+	dir, after := "ASC", sq.Sqlizer(nil)
+	gt := func(col string, v interface{}) sq.Sqlizer { return sq.Gt{col: v} }
+	if pq.Descending {
+		dir = "DESC"
+		gt = func(col string, v interface{}) sq.Sqlizer { return sq.Lt{col: v} }
+	}
+	// a comparison with null matches nothing, the null sort keys are looked up on their own
+	afterKey := func(key document.Value) sq.Sqlizer {
+		switch {
+		case key.Type == document.NullValue && pq.Descending:
+			return nil
+		case key.Type == document.NullValue:
+			return sq.NotEq{pq.OrderBy: nil}
+		case pq.Descending:
+			return sq.Or{gt(pq.OrderBy, key.V), sq.Eq{pq.OrderBy: nil}}
+		}
+		return gt(pq.OrderBy, key.V)
+	}
+	where := sq.And{}
+	for _, cond := range []sq.Sqlizer{t.db.NotExpired(pq.Table), pq.Scope, pq.Filter} {
+		if cond != nil {
+			where = append(where, cond)
+		}
+	}
+	base := sq.Select(pq.Columns).From(pq.Table)
+	if len(where) > 0 {
+		base = base.Where(where)
+	}
+	// one more row than asked tells whether there is a next page
+	want := uint64(pq.Limit) + 1
+
+	var docs []document.Document
+	more := true
+	// the rest of the ties of the cursor row
+	if cursor != nil {
+		ties, err := t.selectDocs(base.Where(sq.Eq{pq.OrderBy: cursor.key.V}).
+			Where(gt(pq.IDColumn, cursor.id.V)).OrderBy(pq.IDColumn + " " + dir).Limit(want))
+		if err != nil {
+			return nil, err
+		}
+		docs = ties
+		after = afterKey(cursor.key)
+		// nothing follows the null sort keys in descending order
+		more = after != nil
+	}
+	if n := uint64(len(docs)); more && n < want {
+		stmt := base.OrderBy(pq.OrderBy + " " + dir).Limit(want - n)
+		if after != nil {
+			stmt = stmt.Where(after)
+		}
+		next, err := t.selectDocs(stmt)
+		if err != nil {
+			return nil, err
+		}
+		if err = sortPageDocs(next, pq.OrderBy, pq.IDColumn, pq.Descending); err != nil {
+			return nil, err
+		}
+		if n+uint64(len(next)) == want && len(next) > 0 {
+			// the limit may have cut through the ties of the last sort key, refetch them by id
+			last := fieldValue(next[len(next)-1], pq.OrderBy)
+			for len(next) > 0 {
+				if eq, _ := fieldValue(next[len(next)-1], pq.OrderBy).IsEqual(last); !eq {
+					break
+				}
+				next = next[:len(next)-1]
+			}
+			ties, err := t.selectDocs(base.Where(sq.Eq{pq.OrderBy: last.V}).
+				OrderBy(pq.IDColumn + " " + dir).Limit(want - n - uint64(len(next))))
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, ties...)
+		}
+		docs = append(docs, next...)
+	}
+
+	page := &Page{}
+	if int64(len(docs)) > pq.Limit {
+		docs = docs[:pq.Limit]
+		page.HasMore = true
+		last := docs[len(docs)-1]
+		nc, err := pageCursor{key: fieldValue(last, pq.OrderBy), id: fieldValue(last, pq.IDColumn)}.encode()
+		if err != nil {
+			return nil, err
+		}
+		page.NextCursor = nc
+	}
+	page.Docs = docs
+	if cursor != nil {
+		page.Total = -1
+		return page, nil
+	}
+
+	countStmt := sq.Select("COUNT(*)").From(pq.Table)
+	if len(where) > 0 {
+		countStmt = countStmt.Where(where)
+	}
+	stmt, args, err := countStmt.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	doc, err := t.QueryOne(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	err = doc.Doc.Iterate(func(_ string, v document.Value) error {
+		page.Total, _ = v.V.(int64)
+		return nil
+	})
+	return page, err
+}
+
+// QueryPage returns a page of documents from a read-only transaction, see Tx.QueryPage.
+func (c *CoreDB) QueryPage(ctx context.Context, pq PageQuery) (*Page, error) {
+	var page *Page
+	err := c.View(ctx, func(tx *Tx) (err error) {
+		page, err = tx.QueryPage(pq)
+		return err
+	})
+	return page, err
+}
+
+// selectDocs runs the statement and copies the documents out of the result.
+func (t *Tx) selectDocs(builder sq.SelectBuilder) ([]document.Document, error) {
+	stmt, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	res, err := t.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	var docs []document.Document
+	err = res.Iterate(func(d document.Document) error {
+		fb := document.NewFieldBuffer()
+		if err := fb.Copy(d); err != nil {
+			return err
+		}
+		docs = append(docs, fb)
+		return nil
+	})
+	return docs, err
+}
+
+// fieldValue returns the value of a field, null when it is missing.
+func fieldValue(d document.Document, field string) document.Value {
+	v, err := d.GetByField(field)
+	if err != nil {
+		return document.NewNullValue()
+	}
+	return v
+}
+
+func sortPageDocs(docs []document.Document, orderBy, idColumn string, descending bool) error {
+	var cmpErr error
+	less := func(a, b document.Value) bool {
+		var (
+			ok  bool
+			err error
+		)
+		// null is lesser than any other value, as in the genji ordering
+		if an, bn := a.Type == document.NullValue, b.Type == document.NullValue; an || bn {
+			return an != bn && an != descending
+		}
+		if descending {
+			ok, err = a.IsGreaterThan(b)
+		} else {
+			ok, err = a.IsLesserThan(b)
+		}
+		if err != nil {
+			cmpErr = err
+		}
+		return ok
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		ki, kj := fieldValue(docs[i], orderBy), fieldValue(docs[j], orderBy)
+		if eq, _ := ki.IsEqual(kj); !eq {
+			return less(ki, kj)
+		}
+		return less(fieldValue(docs[i], idColumn), fieldValue(docs[j], idColumn))
+	})
+	if cmpErr != nil {
+		return fmt.Errorf("%s sorting page on %s: %v", moduleName, orderBy, cmpErr)
+	}
+	return nil
+}
@@ -1,27 +1,106 @@
 package coredb
 
 import (
+	"context"
 	"database/sql/driver"
 	"fmt"
 	sq "github.com/Masterminds/squirrel"
 	"github.com/genjidb/genji"
+	"github.com/genjidb/genji/document"
+	"github.com/genjidb/genji/sql/query"
+	"go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb/sqlengine"
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
+const (
+	defaultSlowQuery = 500 * time.Millisecond
+	// maxUpdateAttempts bounds the runs of a write transaction failing on a conflict with
+	// a concurrent one, see sqlengine.IsSerializationFailure.
+	maxUpdateAttempts = 5
+)
+
+// QueryOptions bounds the statements run by CoreDB.
+type QueryOptions struct {
+	// Timeout in milliseconds applied to statements whose context has no deadline, none when zero.
+	Timeout int `json:"timeout" yaml:"timeout" mapstructure:"timeout"`
+	// SlowThreshold in milliseconds above which statements are logged as slow, defaults to 500.
+	// A negative value disables the slow query log.
+	SlowThreshold int `json:"slowThreshold" yaml:"slowThreshold" mapstructure:"slowThreshold"`
+}
+
+// withQueryContext applies the configured timeout to ctx. The returned done func releases it
+// and logs the statement when it took longer than the slow query threshold.
+func (c *CoreDB) withQueryContext(ctx context.Context, stmt string) (context.Context, func()) {
+	opts := c.opts.Query
+	cancel := func() {}
+	if _, ok := ctx.Deadline(); !ok && opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(opts.Timeout)*time.Millisecond)
+	}
+	threshold := defaultSlowQuery
+	if opts.SlowThreshold != 0 {
+		threshold = time.Duration(opts.SlowThreshold) * time.Millisecond
+	}
+	start := time.Now()
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() {
+			cancel()
+			if elapsed := time.Since(start); threshold > 0 && elapsed > threshold {
+				c.logger.Warnf("%s slow query on %s took %v: %s", moduleName, c.config.DbConfig.Name, elapsed, stmt)
+			}
+		})
+	}
+}
+
 func (c *CoreDB) Query(stmt string, args ...interface{}) (*QueryResult, error) {
-	res, err := c.store.Query(stmt, args...)
+	return c.QueryContext(context.Background(), stmt, args...)
+}
+
+// QueryContext runs a query which is canceled along with ctx. The rows are read into memory
+// before it returns, so the result holds no lock on the store and other queries may run while it is iterated.
+func (c *CoreDB) QueryContext(ctx context.Context, stmt string, args ...interface{}) (*QueryResult, error) {
+	ctx, done := c.withQueryContext(ctx, stmt)
+	defer done()
+	c.storeMu.RLock()
+	defer c.storeMu.RUnlock()
+	res, err := c.store.WithContext(ctx).Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	var docs []document.Document
+	err = res.Iterate(func(d document.Document) error {
+		fb := document.NewFieldBuffer()
+		if err := fb.Copy(d); err != nil {
+			return err
+		}
+		docs = append(docs, fb)
+		return nil
+	})
+	if closeErr := res.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
 		return nil, err
 	}
 	return &QueryResult{
-		res,
+		Result: &query.Result{Stream: document.NewStream(document.NewIterator(docs...))},
 	}, nil
 }
 
 func (c *CoreDB) QueryOne(stmt string, args ...interface{}) (*DocumentResult, error) {
-	res, err := c.store.QueryDocument(stmt, args...)
+	return c.QueryOneContext(context.Background(), stmt, args...)
+}
+
+func (c *CoreDB) QueryOneContext(ctx context.Context, stmt string, args ...interface{}) (*DocumentResult, error) {
+	ctx, done := c.withQueryContext(ctx, stmt)
+	defer done()
+	c.storeMu.RLock()
+	defer c.storeMu.RUnlock()
+	res, err := c.store.WithContext(ctx).QueryDocument(stmt, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -30,34 +109,51 @@ func (c *CoreDB) QueryOne(stmt string, args ...interface{}) (*DocumentResult, er
 	}, nil
 }
 
-func (c *CoreDB) createTx() (*genji.Tx, error) {
-	return c.store.Begin(true)
+// update runs operation in a write transaction bound to ctx,
+// the store cannot be swapped out by a restore meanwhile.
+// A transaction failing on a conflict with a concurrent one, as Postgres serializable transactions do,
+// is run again from the start a few times: operation has to be safe to run more than once.
+func (c *CoreDB) update(ctx context.Context, operation func(tx *genji.Tx) error) error {
+	c.storeMu.RLock()
+	defer c.storeMu.RUnlock()
+	for attempt := 1; ; attempt++ {
+		err := c.store.WithContext(ctx).Update(operation)
+		if attempt == maxUpdateAttempts || !sqlengine.IsSerializationFailure(err) {
+			return err
+		}
+		c.logger.Debugf("%s retrying a transaction of %s after a conflict: %v", moduleName, c.config.DbConfig.Name, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * 10 * time.Millisecond):
+		}
+	}
 }
 
-func (c *CoreDB) txhelper(tx *genji.Tx, operation func() error) error {
-	defer tx.Rollback()
-	if err := operation(); err != nil {
-		return err
-	}
-	return tx.Commit()
+// view is the read only counterpart of update.
+func (c *CoreDB) view(ctx context.Context, operation func(tx *genji.Tx) error) error {
+	c.storeMu.RLock()
+	defer c.storeMu.RUnlock()
+	return c.store.WithContext(ctx).View(operation)
 }
 
 func (c *CoreDB) Exec(stmt string, args ...interface{}) error {
-	tx, err := c.createTx()
-	if err != nil {
-		return err
-	}
-	return c.txhelper(tx, func() error {
+	return c.ExecContext(context.Background(), stmt, args...)
+}
+
+func (c *CoreDB) ExecContext(ctx context.Context, stmt string, args ...interface{}) error {
+	ctx, done := c.withQueryContext(ctx, stmt)
+	defer done()
+	return c.update(ctx, func(tx *genji.Tx) error {
 		return tx.Exec(stmt, args...)
 	})
 }
 
+// BulkExec runs the statements in a single transaction.
+//
+// Deprecated: the statements run in random order and the same statement cannot run twice, use ExecAll.
 func (c *CoreDB) BulkExec(stmtMap map[string][]interface{}) error {
-	tx, err := c.createTx()
-	if err != nil {
-		return err
-	}
-	return c.txhelper(tx, func() error {
+	return c.update(context.Background(), func(tx *genji.Tx) error {
 		for k, v := range stmtMap {
 			if err := tx.Exec(k, v...); err != nil {
 				return err
@@ -201,7 +297,9 @@ func matchStmtBuilderFunc(want string) func(k string, v interface{}) StmtIFacer
 			return sq.Eq{k: v}
 		case "in":
 			return sqIn{k: v}
-		case "not_in", "not_eq":
+		case "not_in":
+			return sqNotIn{k: v}
+		case "not_eq":
 			return sq.NotEq{k: v}
 		case "gt":
 			return sq.Gt{k: v}
@@ -219,18 +317,28 @@ func matchStmtBuilderFunc(want string) func(k string, v interface{}) StmtIFacer
 
 func BaseQueryBuilder(filter map[string]interface{}, tableName, tableColumns string, sqlMatcher string) sq.SelectBuilder {
 	baseStmt := sq.Select(tableColumns).From(tableName)
-	if filter != nil {
-		for k, v := range filter {
-			baseStmt = baseStmt.Where(matchStmtBuilderFunc(sqlMatcher)(k, v))
-		}
+	if len(filter) > 0 {
+		baseStmt = baseStmt.Where(FilterBuilder(filter, sqlMatcher))
 	}
 	return baseStmt
 }
 
+// FilterBuilder matches every filter value with sqlMatcher, see BaseQueryBuilder.
+func FilterBuilder(filter map[string]interface{}, sqlMatcher string) sq.And {
+	and := sq.And{}
+	for _, k := range getSortedKeys(filter) {
+		and = append(and, matchStmtBuilderFunc(sqlMatcher)(k, filter[k]))
+	}
+	return and
+}
+
+// ListSelectStatement paginates on cursorName > cursor, rows sharing the cursor value are skipped.
+//
+// Deprecated: use QueryPage which pages through ties and descending orders.
 func ListSelectStatement(baseStmt sq.SelectBuilder, orderBy string, limit int64, cursor *int64, cursorName string) (string, []interface{}, error) {
-	csr := *cursor
-	if cursor == nil {
-		csr = 0
+	var csr int64
+	if cursor != nil {
+		csr = *cursor
 	}
 	baseStmt = baseStmt.Where(sq.Gt{cursorName: csr})
 	baseStmt = baseStmt.Limit(uint64(limit)).OrderBy(orderBy)
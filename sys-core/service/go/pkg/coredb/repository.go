@@ -0,0 +1,236 @@
+package coredb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/genjidb/genji/document"
+)
+
+const defaultRepositoryOrderBy = "created_at"
+
+// RepositoryOptions describes the table behind a Repository.
+type RepositoryOptions struct {
+	// PrimaryKey is the column updates and Get by key match on, defaults to the field tagged
+	// coredb:"primary" or to id.
+	PrimaryKey string
+	// OrderBy is the column List sorts on by default, defaults to created_at.
+	OrderBy string
+}
+
+// ListOptions filters and paginates Repository.List.
+type ListOptions struct {
+	PageRequest
+	// Filter restricts the models, nil lists them all.
+	Filter *Filter
+}
+
+// Repository provides CRUD for a model registered with RegisterModels.
+// T is the type the model's CreateSQL method is declared on, either a struct or a pointer to it,
+// the columns are taken from its genji tags.
+type Repository[T DbModel] struct {
+	db      *CoreDB
+	tx      *Tx
+	table   string
+	columns string
+	opts    RepositoryOptions
+}
+
+// NewRepository returns a Repository on the table of db, which must have been registered.
+func NewRepository[T DbModel](db *CoreDB, table string, opts RepositoryOptions) (*Repository[T], error) {
+	if _, ok := db.models[table]; !ok {
+		return nil, Error{Reason: errTableNotRegistered, Err: fmt.Errorf("table %s", table)}
+	}
+	var model T
+	modelType := reflect.TypeOf(&model).Elem()
+	if modelType.Kind() == reflect.Ptr {
+		modelType = modelType.Elem()
+	}
+	if modelType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s model of %s must be a struct, got %s", moduleName, table, modelType)
+	}
+	if opts.PrimaryKey == "" {
+		opts.PrimaryKey = primaryKeyColumn(modelType)
+	}
+	if opts.OrderBy == "" {
+		opts.OrderBy = defaultRepositoryOrderBy
+	}
+	return &Repository[T]{
+		db:      db,
+		table:   table,
+		columns: GetStructColumns(reflect.New(modelType).Interface()),
+		opts:    opts,
+	}, nil
+}
+
+// primaryKeyColumn returns the column of the field tagged coredb:"primary".
+func primaryKeyColumn(modelType reflect.Type) string {
+	for i := 0; i < modelType.NumField(); i++ {
+		field := modelType.Field(i)
+		if tagOptions(field.Tag.Get("coredb"))[tagPrimary] {
+			return field.Tag.Get("genji")
+		}
+	}
+	return "id"
+}
+
+// WithTx returns a copy of the repository running its statements in tx.
+func (r *Repository[T]) WithTx(tx *Tx) *Repository[T] {
+	rtx := *r
+	rtx.tx = tx
+	return &rtx
+}
+
+// Table returns the name of the table of the repository.
+func (r *Repository[T]) Table() string {
+	return r.table
+}
+
+// scan decodes a document into a new model.
+func (r *Repository[T]) scan(d document.Document) (T, error) {
+	var model T
+	if t := reflect.TypeOf(&model).Elem(); t.Kind() == reflect.Ptr {
+		model = reflect.New(t.Elem()).Interface().(T)
+		return model, document.StructScan(d, model)
+	}
+	err := document.StructScan(d, &model)
+	return model, err
+}
+
+func (r *Repository[T]) exec(ctx context.Context, builder StmtIFacer) error {
+	stmt, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+	if r.tx != nil {
+		return r.tx.Exec(stmt, args...)
+	}
+	return r.db.ExecContext(ctx, stmt, args...)
+}
+
+func (r *Repository[T]) queryOne(ctx context.Context, builder StmtIFacer) (*DocumentResult, error) {
+	stmt, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	if r.tx != nil {
+		return r.tx.QueryOne(stmt, args...)
+	}
+	return r.db.QueryOneContext(ctx, stmt, args...)
+}
+
+func (r *Repository[T]) queryPage(ctx context.Context, pq PageQuery) (*Page, error) {
+	if r.tx != nil {
+		return r.tx.QueryPage(pq)
+	}
+	return r.db.QueryPage(ctx, pq)
+}
+
+// Get returns the first unexpired model matching every filter value.
+func (r *Repository[T]) Get(ctx context.Context, filter map[string]interface{}) (T, error) {
+	doc, err := r.queryOne(ctx, BaseQueryBuilder(filter, r.table, r.columns, "eq").Where(r.db.NotExpired(r.table)).Limit(1))
+	if err != nil {
+		var model T
+		return model, err
+	}
+	return r.scan(doc.Doc)
+}
+
+// GetByKey returns the model with the given primary key.
+func (r *Repository[T]) GetByKey(ctx context.Context, key interface{}) (T, error) {
+	return r.Get(ctx, map[string]interface{}{r.opts.PrimaryKey: key})
+}
+
+// List returns a page of models.
+func (r *Repository[T]) List(ctx context.Context, opts ListOptions) ([]T, *PageInfo, error) {
+	if opts.OrderBy == "" {
+		opts.OrderBy = r.opts.OrderBy
+	}
+	pq := PageQuery{
+		PageRequest: opts.PageRequest,
+		Table:       r.table,
+		Columns:     r.columns,
+		IDColumn:    r.opts.PrimaryKey,
+	}
+	if opts.Filter != nil {
+		pq.Filter = opts.Filter
+	}
+	page, err := r.queryPage(ctx, pq)
+	if err != nil {
+		return nil, nil, err
+	}
+	models := make([]T, 0, len(page.Docs))
+	err = page.Iterate(func(d document.Document) error {
+		model, err := r.scan(d)
+		if err != nil {
+			return err
+		}
+		models = append(models, model)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return models, &page.PageInfo, nil
+}
+
+// Count returns the number of unexpired models matching every filter value.
+func (r *Repository[T]) Count(ctx context.Context, filter map[string]interface{}) (int64, error) {
+	doc, err := r.queryOne(ctx, BaseQueryBuilder(filter, r.table, "COUNT(*)", "eq").Where(r.db.NotExpired(r.table)))
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	err = doc.Doc.Iterate(func(_ string, v document.Value) error {
+		count, _ = v.V.(int64)
+		return nil
+	})
+	return count, err
+}
+
+// Insert stores a new model.
+func (r *Repository[T]) Insert(ctx context.Context, model T) error {
+	doc, err := document.NewFromStruct(model)
+	if err != nil {
+		return err
+	}
+	return r.exec(ctx, sq.Expr(fmt.Sprintf("INSERT INTO %s VALUES ?", r.table), doc))
+}
+
+// Update overwrites every column of the model with the same primary key.
+func (r *Repository[T]) Update(ctx context.Context, model T) error {
+	doc, err := document.NewFromStruct(model)
+	if err != nil {
+		return err
+	}
+	key, err := doc.GetByField(r.opts.PrimaryKey)
+	if err != nil {
+		return fmt.Errorf("%s primary key %s of %s: %v", moduleName, r.opts.PrimaryKey, r.table, err)
+	}
+	values := map[string]interface{}{}
+	err = doc.Iterate(func(field string, v document.Value) error {
+		if field != r.opts.PrimaryKey {
+			values[field] = v.V
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return r.exec(ctx, sq.Update(r.table).SetMap(values).Where(sq.Eq{r.opts.PrimaryKey: key.V}))
+}
+
+// Delete removes the models matching every filter value, an empty filter is refused.
+func (r *Repository[T]) Delete(ctx context.Context, filter map[string]interface{}) error {
+	if len(filter) == 0 {
+		return fmt.Errorf("%s refusing to delete every row of %s", moduleName, r.table)
+	}
+	return r.exec(ctx, sq.Delete(r.table).Where(sqIn(filter)))
+}
+
+// DeleteByKey removes the model with the given primary key.
+func (r *Repository[T]) DeleteByKey(ctx context.Context, key interface{}) error {
+	return r.Delete(ctx, map[string]interface{}{r.opts.PrimaryKey: key})
+}
@@ -0,0 +1,136 @@
+package coredb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/genjidb/genji"
+	"github.com/genjidb/genji/database"
+
+	sharedConfig "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
+)
+
+const (
+	restoreDirFormat  = "%s.restore-%d"
+	rollbackDirFormat = "%s.rollback-%d"
+)
+
+// RestoreOptions configures how backups are restored.
+type RestoreOptions struct {
+	// Merge loads the backups into the live database instead of swapping in a freshly restored one,
+	// rows created after the backup survive the restore.
+	Merge bool `json:"merge" yaml:"merge" mapstructure:"merge"`
+}
+
+// loadBackups loads the backup files in order into the badger database,
+// compressed and encrypted files are decoded on the fly.
+func (c *CoreDB) loadBackups(badgerDB *badger.DB, files []string) error {
+	for _, file := range files {
+		f, err := c.target.Open(file)
+		if err != nil {
+			return err
+		}
+		r, err := c.decodeBackup(f)
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("decoding %s: %v", file, err)
+		}
+		err = badgerDB.Load(r, 10)
+		r.Close()
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("loading %s: %v", file, err)
+		}
+	}
+	return nil
+}
+
+// missingTables lists the registered model tables absent from store.
+func (c *CoreDB) missingTables(store *genji.DB) ([]string, error) {
+	var missing []string
+	err := store.View(func(tx *genji.Tx) error {
+		for tblName := range c.models {
+			_, err := tx.GetTable(ToSnakeCase(tblName))
+			if errors.Is(err, database.ErrTableNotFound) {
+				missing = append(missing, ToSnakeCase(tblName))
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	sort.Strings(missing)
+	return missing, err
+}
+
+// restoreFresh restores the backup files into a new directory, validates the result
+// and swaps it in place of the live database. Queries wait for the swap to finish,
+// in flight ones are drained first. The replaced data is kept as a rollback point,
+// whose directory is returned.
+func (c *CoreDB) restoreFresh(files []string) (string, error) {
+	dbCfg := c.config.DbConfig
+	key, err := c.opts.Key.DeriveKey(dbCfg.Name, dbCfg.EncryptKey)
+	if err != nil {
+		return "", err
+	}
+	now := sharedConfig.CurrentTimestamp()
+	restoreDir := fmt.Sprintf(restoreDirFormat, c.dbPath(), now)
+	engine, err := newBadgerEngine(restoreDir, key, dbCfg.RotationDuration)
+	if err != nil {
+		return "", err
+	}
+	store, err := newGenjiStore(engine, nil)
+	if err != nil {
+		return "", err
+	}
+	err = c.loadBackups(engine.DB, files)
+	if err == nil {
+		var missing []string
+		missing, err = c.missingTables(store)
+		if err == nil && len(missing) > 0 {
+			err = Error{Reason: errRestoreInvalid, Err: fmt.Errorf("missing tables %v", missing)}
+		}
+	}
+	if closeErr := store.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.RemoveAll(restoreDir)
+		return "", err
+	}
+
+	c.storeMu.Lock()
+	defer c.storeMu.Unlock()
+	rollbackDir := fmt.Sprintf(rollbackDirFormat, c.dbPath(), now)
+	if err = c.store.Close(); err != nil {
+		return "", err
+	}
+	if err = os.Rename(c.dbPath(), rollbackDir); err != nil {
+		return "", c.reopenAfter(err)
+	}
+	if err = os.Rename(restoreDir, c.dbPath()); err != nil {
+		_ = os.Rename(rollbackDir, c.dbPath())
+		return "", c.reopenAfter(err)
+	}
+	if err = c.openStore(); err != nil {
+		c.logger.Errorf("%s unable to open restored %s, rolling back: %v", moduleName, dbCfg.Name, err)
+		_ = os.Rename(c.dbPath(), restoreDir)
+		_ = os.Rename(rollbackDir, c.dbPath())
+		return "", c.reopenAfter(err)
+	}
+	c.logger.Infof("%s restored %s, previous data kept in %s", moduleName, dbCfg.Name, rollbackDir)
+	return rollbackDir, nil
+}
+
+// reopenAfter reopens the live database after a failed swap and returns the original error.
+func (c *CoreDB) reopenAfter(err error) error {
+	if openErr := c.openStore(); openErr != nil {
+		return fmt.Errorf("%v, reopening failed as well: %v", err, openErr)
+	}
+	return err
+}
@@ -0,0 +1,334 @@
+package coredb
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// scheduledBackupVersion prefixes the version of the scheduled backups, followed by their unix time.
+const scheduledBackupVersion = "independent-"
+
+// RetentionOptions decides which backups survive pruning, a backup is kept if any rule keeps it.
+// Without any rule every backup is kept.
+type RetentionOptions struct {
+	// KeepLast keeps the newest n backups.
+	KeepLast int `json:"keepLast" yaml:"keepLast" mapstructure:"keepLast"`
+	// KeepDaily keeps the newest backup of each of the last n days.
+	KeepDaily int `json:"keepDaily" yaml:"keepDaily" mapstructure:"keepDaily"`
+	// KeepWeekly keeps the newest backup of each of the last n weeks.
+	KeepWeekly int `json:"keepWeekly" yaml:"keepWeekly" mapstructure:"keepWeekly"`
+	// MaxTotalSize drops the oldest backup chains until the backups fit, in bytes.
+	// The newest chain is never dropped.
+	MaxTotalSize int64 `json:"maxTotalSize" yaml:"maxTotalSize" mapstructure:"maxTotalSize"`
+	// PruneLegacy lets the rules above delete the legacy backups, taken before the backup chain.
+	// They are kept otherwise, and always when their creation time is unknown.
+	PruneLegacy bool `json:"pruneLegacy" yaml:"pruneLegacy" mapstructure:"pruneLegacy"`
+}
+
+func (r RetentionOptions) enabled() bool {
+	return r.KeepLast > 0 || r.KeepDaily > 0 || r.KeepWeekly > 0 || r.MaxTotalSize > 0
+}
+
+// chainBase returns the full backup an entry belongs to.
+func chainBase(e *BackupEntry) string {
+	if e.Incremental {
+		return e.Base
+	}
+	return e.File
+}
+
+// protected returns the entries kept by the count and age rules,
+// including the backups a kept incremental depends on.
+func (b *backupChain) protected(r RetentionOptions, now time.Time) map[int]bool {
+	keep := map[int]bool{}
+	if r.KeepLast <= 0 && r.KeepDaily <= 0 && r.KeepWeekly <= 0 {
+		for i := range b.Entries {
+			keep[i] = true
+		}
+		return keep
+	}
+	for i := len(b.Entries) - r.KeepLast; i < len(b.Entries); i++ {
+		if i >= 0 {
+			keep[i] = true
+		}
+	}
+	keepNewestPer := func(period time.Duration, n int) {
+		if n <= 0 {
+			return
+		}
+		seen := map[time.Time]bool{}
+		for i := len(b.Entries) - 1; i >= 0; i-- {
+			created := time.Unix(b.Entries[i].CreatedAt, 0).UTC()
+			if now.Sub(created) >= time.Duration(n)*period {
+				continue
+			}
+			slot := created.Truncate(period)
+			if !seen[slot] {
+				seen[slot] = true
+				keep[i] = true
+			}
+		}
+	}
+	keepNewestPer(day, r.KeepDaily)
+	keepNewestPer(week, r.KeepWeekly)
+	for i := range b.Entries {
+		if !keep[i] || !b.Entries[i].Incremental {
+			continue
+		}
+		plan, err := b.replayPlan(i)
+		if err != nil {
+			continue
+		}
+		for _, e := range plan {
+			keep[b.find(func(other *BackupEntry) bool { return other == e })] = true
+		}
+	}
+	return keep
+}
+
+func (c *CoreDB) backupSize(e *BackupEntry) int64 {
+	size, err := c.target.Stat(e.File)
+	if err != nil {
+		return 0
+	}
+	return size
+}
+
+// retained applies the retention policy, including the size cap, to the chain.
+func (c *CoreDB) retained(chain *backupChain, now time.Time) map[int]bool {
+	r := c.opts.Retention
+	keep := chain.protected(r, now)
+	if r.MaxTotalSize <= 0 {
+		return keep
+	}
+	var total int64
+	for i := range keep {
+		total += c.backupSize(chain.Entries[i])
+	}
+	newest := ""
+	if len(chain.Entries) > 0 {
+		newest = chainBase(chain.Entries[len(chain.Entries)-1])
+	}
+	for i, e := range chain.Entries {
+		if total <= r.MaxTotalSize {
+			break
+		}
+		if !keep[i] || chainBase(e) == newest {
+			continue
+		}
+		// dropping a full backup takes its incrementals with it
+		base := chainBase(e)
+		for j := i; j < len(chain.Entries); j++ {
+			if keep[j] && chainBase(chain.Entries[j]) == base {
+				total -= c.backupSize(chain.Entries[j])
+				delete(keep, j)
+			}
+		}
+	}
+	return keep
+}
+
+// legacyBackups returns the backup files of the database the chain does not list, left by the versions
+// without a chain, oldest first. Their creation time is read from the version of the scheduled backups
+// and is zero when unknown.
+func (c *CoreDB) legacyBackups(chain *backupChain) ([]*BackupEntry, error) {
+	files, err := c.listBackups()
+	if err != nil {
+		return nil, err
+	}
+	chained := map[string]bool{}
+	for _, e := range chain.Entries {
+		chained[e.File] = true
+	}
+	var legacy []*BackupEntry
+	for _, f := range files {
+		if chained[f] {
+			continue
+		}
+		e := &BackupEntry{File: f, Version: getVersion(f)}
+		if ts := strings.TrimPrefix(e.Version, scheduledBackupVersion); ts != e.Version {
+			e.CreatedAt, _ = strconv.ParseInt(ts, 10, 64)
+		}
+		legacy = append(legacy, e)
+	}
+	sort.SliceStable(legacy, func(i, j int) bool {
+		if legacy[i].CreatedAt != legacy[j].CreatedAt {
+			return legacy[i].CreatedAt < legacy[j].CreatedAt
+		}
+		return legacy[i].File < legacy[j].File
+	})
+	return legacy, nil
+}
+
+// retentionPlan returns the chain entries along with the legacy backups, the latter first, and the
+// ones the retention policy keeps. The legacy backups only take part when PruneLegacy is set.
+func (c *CoreDB) retentionPlan(now time.Time) (entries, legacy []*BackupEntry, keep map[*BackupEntry]bool, err error) {
+	chain, err := c.loadBackupChain()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if legacy, err = c.legacyBackups(chain); err != nil {
+		return nil, nil, nil, err
+	}
+	keep = map[*BackupEntry]bool{}
+	planned := &backupChain{}
+	for _, e := range legacy {
+		if c.opts.Retention.PruneLegacy && e.CreatedAt > 0 {
+			planned.Entries = append(planned.Entries, e)
+		} else {
+			keep[e] = true
+		}
+	}
+	planned.Entries = append(planned.Entries, chain.Entries...)
+	for i := range c.retained(planned, now) {
+		keep[planned.Entries[i]] = true
+	}
+	return append(legacy, chain.Entries...), legacy, keep, nil
+}
+
+// pruneBackups deletes the backups not retained by the policy and returns them,
+// the caller has to hold backupMu.
+func (c *CoreDB) pruneBackups() ([]*BackupEntry, error) {
+	if !c.opts.Retention.enabled() {
+		return nil, nil
+	}
+	entries, legacy, keep, err := c.retentionPlan(time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	chain := &backupChain{}
+	var deleted []*BackupEntry
+	for i, e := range entries {
+		inChain := i >= len(legacy)
+		if keep[e] {
+			if inChain {
+				chain.Entries = append(chain.Entries, e)
+			}
+			continue
+		}
+		err = c.target.Remove(e.File)
+		if err == nil {
+			err = c.target.Remove(backupManifestPath(e.File))
+		}
+		if err != nil {
+			// keep it listed, so the next run tries again
+			if inChain {
+				chain.Entries = append(chain.Entries, e)
+			}
+			c.logger.Warnf("%s unable to delete backup %s: %v", moduleName, e.File, err)
+			continue
+		}
+		deleted = append(deleted, e)
+	}
+	if err = c.saveBackupChain(chain); err != nil {
+		return nil, err
+	}
+	for _, e := range deleted {
+		c.logger.Infof("%s pruned backup %s of %s", moduleName, e.File, c.config.DbConfig.Name)
+	}
+	return deleted, nil
+}
+
+// PruneBackups applies the retention policy to the backups of the database.
+func (c *CoreDB) PruneBackups() ([]*BackupEntry, error) {
+	c.backupMu.Lock()
+	defer c.backupMu.Unlock()
+	return c.pruneBackups()
+}
+
+// BackupStatus is a backup alongside whether the retention policy protects it.
+type BackupStatus struct {
+	*BackupEntry
+	Size      int64 `json:"size"`
+	Protected bool  `json:"protected"`
+	// Legacy backups were taken before the backup chain, without a manifest.
+	Legacy bool `json:"legacy,omitempty"`
+}
+
+// ListBackupStatus lists the backups of the database in the order they were taken, the legacy ones first.
+func (c *CoreDB) ListBackupStatus() ([]*BackupStatus, error) {
+	c.backupMu.Lock()
+	defer c.backupMu.Unlock()
+	entries, legacy, keep, err := c.retentionPlan(time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	var statuses []*BackupStatus
+	for i, e := range entries {
+		statuses = append(statuses, &BackupStatus{
+			BackupEntry: e,
+			Size:        c.backupSize(e),
+			Protected:   keep[e],
+			Legacy:      i < len(legacy),
+		})
+	}
+	return statuses, nil
+}
+
+type BackupRequest struct {
+	DbName string `json:"dbName"`
+}
+
+type BackupStatusResult struct {
+	DbName  string          `json:"dbName"`
+	Backups []*BackupStatus `json:"backups"`
+}
+
+type BackupStatusAllResult struct {
+	Results []*BackupStatusResult `json:"results"`
+}
+
+type PruneResult struct {
+	DbName  string         `json:"dbName"`
+	Deleted []*BackupEntry `json:"deleted"`
+}
+
+type PruneAllResult struct {
+	Results []*PruneResult `json:"results"`
+}
+
+// ListBackupStatus lists the backups of one or every registered database and whether they are protected.
+func (a *AllDBService) ListBackupStatus(_ context.Context, in *BackupRequest) (*BackupStatusAllResult, error) {
+	if in == nil {
+		in = &BackupRequest{}
+	}
+	cdbs, err := a.selectCoreDBs(in.DbName)
+	if err != nil {
+		return nil, err
+	}
+	var results []*BackupStatusResult
+	for _, cdb := range cdbs {
+		statuses, err := cdb.ListBackupStatus()
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "unable to list backups of %s: %v", cdb.config.DbConfig.Name, err)
+		}
+		results = append(results, &BackupStatusResult{DbName: cdb.config.DbConfig.Name, Backups: statuses})
+	}
+	return &BackupStatusAllResult{Results: results}, nil
+}
+
+// PruneBackups applies the retention policy of one or every registered database.
+func (a *AllDBService) PruneBackups(_ context.Context, in *BackupRequest) (*PruneAllResult, error) {
+	if in == nil {
+		in = &BackupRequest{}
+	}
+	cdbs, err := a.selectCoreDBs(in.DbName)
+	if err != nil {
+		return nil, err
+	}
+	var results []*PruneResult
+	for _, cdb := range cdbs {
+		deleted, err := cdb.PruneBackups()
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "unable to prune backups of %s: %v", cdb.config.DbConfig.Name, err)
+		}
+		results = append(results, &PruneResult{DbName: cdb.config.DbConfig.Name, Deleted: deleted})
+	}
+	return &PruneAllResult{Results: results}, nil
+}
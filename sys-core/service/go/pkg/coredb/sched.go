@@ -3,16 +3,13 @@ package coredb
 import (
 	"context"
 	"fmt"
-	"go.amplifyedge.org/sys-share-v2/sys-core/service/fileutils"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
-	"io"
-	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/robfig/cron/v3"
 	"google.golang.org/protobuf/types/known/emptypb"
 
 	sharedConfig "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
@@ -23,52 +20,25 @@ const (
 	backupFormat = "ver-%s_%s_%s.bak"
 )
 
-func (c *CoreDB) RegisterCronFunction(funcSpec string, function func()) error {
-	_, err := c.crony.AddFunc(funcSpec, function)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
 func (c *CoreDB) scheduleBackup() error {
-	crony := cron.New()
-
-	// default backup schedule
-	errChan := make(chan error, 1)
-	_, err := crony.AddFunc(c.config.CronConfig.BackupSchedule, func() {
-		// cron backups are unversioned from each other for now.
-		_, err := c.backup(fmt.Sprintf("independent-%d", sharedConfig.CurrentTimestamp()))
+	// default backup schedule, the other engines are backed up with the tools of their database.
+	if _, err := c.badgerDB(); err == nil {
+		err = c.RegisterJob(backupJobName, c.config.CronConfig.BackupSchedule, func(context.Context) error {
+			// cron backups are unversioned from each other for now.
+			_, err := c.backup(fmt.Sprintf("%s%d", scheduledBackupVersion, sharedConfig.CurrentTimestamp()))
+			return err
+		})
 		if err != nil {
-			errChan <- err
-			return
+			return err
 		}
-	})
-	close(errChan)
-	if errFromChan := <-errChan; errFromChan != nil {
-		return errFromChan
-	}
-	if err != nil {
-		return err
 	}
 
 	// custom cron functions from each module
-	if c.cronFuncs != nil && len(c.cronFuncs) > 0 {
-		for funcSpec, fun := range c.cronFuncs {
-			errChan := make(chan error, 1)
-			_, err := crony.AddFunc(funcSpec, fun)
-			close(errChan)
-			if errFromChan := <-errChan; errFromChan != nil {
-				return errFromChan
-			}
-			if err != nil {
-				return err
-			}
+	for funcSpec, fun := range c.cronFuncs {
+		if err := c.RegisterCronFunction(funcSpec, fun); err != nil {
+			return err
 		}
 	}
-	// TODO: rotate encryption key
-	// Find a way to do streaming backup while re-encrypting the key perhaps?
-	c.crony = crony
 	return nil
 }
 
@@ -98,35 +68,166 @@ func (a *AllDBService) Backup(ctx context.Context, in *emptypb.Empty) (*coreRpc.
 }
 
 func (c *CoreDB) backup(versionPrefix string) (string, error) {
+	if _, err := c.badgerDB(); err != nil {
+		return "", err
+	}
+	c.backupMu.Lock()
+	defer c.backupMu.Unlock()
 	c.logger.Debug("creating backup schedule")
-	fileWriter, filename, err := c.createBackupFile(versionPrefix)
-	defer fileWriter.Close()
+	chain, err := c.loadBackupChain()
+	if err != nil {
+		c.logger.Debugf("%s error while reading backup chain: %v", moduleName, err)
+		return "", err
+	}
+	since, base := chain.next(c.opts.Backup)
+	filename := c.backupFileName(versionPrefix)
+	fileWriter, err := c.target.Create(filename)
 	if err != nil {
 		c.logger.Debugf("%s error while creating backup file: %v", moduleName, err)
 		return "", err
 	}
-	badgerDb := c.engine.DB
-	// full backup, no matter what
-	// TODO: provide incremental backup as well perhaps?
-	_, err = badgerDb.Backup(fileWriter, 0)
+	hw, sum := newHashingWriter(fileWriter)
+	ew, err := c.encodeBackup(hw)
+	if err != nil {
+		fileWriter.Close()
+		_ = c.target.Remove(filename)
+		return "", err
+	}
+	c.storeMu.RLock()
+	var until uint64
+	db, err := c.badgerDB()
+	if err == nil {
+		until, err = db.Backup(ew, since)
+	}
+	c.storeMu.RUnlock()
+	if closeErr := ew.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := fileWriter.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
 		c.logger.Debugf("%s error while doing streaming backup: %v", moduleName, err)
+		_ = c.target.Remove(filename)
 		return "", err
 	}
-	return filename, nil
+	if until < since {
+		// nothing changed since the previous backup
+		until = since - 1
+	}
+	entry := &BackupEntry{
+		File:        filename,
+		Version:     versionPrefix,
+		Incremental: base != "",
+		Base:        base,
+		Since:       since,
+		Until:       until,
+		CreatedAt:   sharedConfig.CurrentTimestamp(),
+	}
+	schemaVersion, err := c.SchemaVersion()
+	if err != nil {
+		// the schema has not been made yet
+		schemaVersion = 0
+	}
+	size, checksum := sum()
+	err = c.writeBackupManifest(filename, &BackupManifest{
+		DbName:        c.config.DbConfig.Name,
+		BackupEntry:   entry,
+		Size:          size,
+		Sha256:        checksum,
+		SchemaVersion: schemaVersion,
+		Compression:   c.opts.Backup.Compression,
+		Encrypted:     c.opts.Backup.EncryptKey != "",
+	})
+	if err != nil {
+		_ = c.target.Remove(filename)
+		return "", err
+	}
+	chain.Entries = append(chain.Entries, entry)
+	if err = c.saveBackupChain(chain); err != nil {
+		return "", err
+	}
+	if _, err = c.pruneBackups(); err != nil {
+		c.logger.Warnf("%s error while pruning backups: %v", moduleName, err)
+	}
+	return c.target.Location(filename), nil
 }
 
 func (c *CoreDB) singleRestore(_ context.Context, in *coreRpc.SingleRestoreRequest) (*coreRpc.SingleRestoreResult, error) {
-	badgerDB := c.engine.DB
-	f, err := c.openFile(in.BackupFile)
+	files, err := c.restoreFiles(in.BackupFile)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.verifyRestoreFiles(files); err != nil {
+		return nil, err
+	}
+	db, err := c.badgerDB()
 	if err != nil {
 		return nil, err
 	}
-	err = badgerDB.Load(f, 10)
+	if c.opts.Restore.Merge {
+		c.storeMu.RLock()
+		defer c.storeMu.RUnlock()
+		if err = c.loadBackups(db, files); err != nil {
+			return nil, err
+		}
+		return &coreRpc.SingleRestoreResult{Result: fmt.Sprintf("successfully restore db: %s", in.BackupFile)}, nil
+	}
+	rollbackDir, err := c.restoreFresh(files)
 	if err != nil {
 		return nil, err
 	}
-	return &coreRpc.SingleRestoreResult{Result: fmt.Sprintf("successfully restore db: %s", in.BackupFile)}, nil
+	return &coreRpc.SingleRestoreResult{
+		Result: fmt.Sprintf("successfully restore db: %s, previous data kept in %s", in.BackupFile, rollbackDir),
+	}, nil
+}
+
+// restoreFiles resolves a backup file to the backups to load in order,
+// a full backup for itself, an incremental for its chain.
+// Backups missing from the chain are restored on their own.
+// The backup file may be given as name or as location within the backup target.
+func (c *CoreDB) restoreFiles(backupFile string) ([]string, error) {
+	name := path.Base(filepath.ToSlash(backupFile))
+	chain, err := c.loadBackupChain()
+	if err != nil {
+		return nil, err
+	}
+	idx := chain.find(func(e *BackupEntry) bool {
+		return e.File == name
+	})
+	if idx < 0 {
+		return []string{name}, nil
+	}
+	plan, err := chain.replayPlan(idx)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range plan {
+		files = append(files, e.File)
+	}
+	return files, nil
+}
+
+// lookupBackup finds the backup file of the given version.
+func (c *CoreDB) lookupBackup(version string) (string, error) {
+	chain, err := c.loadBackupChain()
+	if err != nil {
+		return "", err
+	}
+	if idx := chain.find(func(e *BackupEntry) bool { return e.Version == version }); idx >= 0 {
+		return chain.Entries[idx].File, nil
+	}
+	names, err := c.listBackups()
+	if err != nil {
+		return "", err
+	}
+	for _, name := range names {
+		if getVersion(name) == version {
+			return name, nil
+		}
+	}
+	return "", Error{Reason: errBackupNotFound, Err: fmt.Errorf("version %s", version)}
 }
 
 func (a *AllDBService) Restore(ctx context.Context, in *coreRpc.RestoreAllRequest) (*coreRpc.RestoreAllResult, error) {
@@ -136,8 +237,7 @@ func (a *AllDBService) Restore(ctx context.Context, in *coreRpc.RestoreAllReques
 	var singleRestoreResults []*coreRpc.SingleRestoreResult
 	if in.RestoreVersion != "" {
 		for _, cdb := range a.RegisteredDBs {
-			backupDir := cdb.config.CronConfig.BackupDir
-			backupFilename, err := fileutils.LookupFile(backupDir, in.RestoreVersion)
+			backupFilename, err := cdb.lookupBackup(in.RestoreVersion)
 			if err != nil {
 				return nil, status.Errorf(codes.InvalidArgument, "restore version %s for database %s not found", in.RestoreVersion, cdb.config.DbConfig.Name)
 			}
@@ -178,6 +278,8 @@ func (c *CoreDB) SingleListBackup(ctx context.Context, in *emptypb.Empty) ([]*co
 	return bfiles, nil
 }
 
+// ListBackup lists the backup files of the registered databases by version, see ListBackupStatus
+// for whether the retention policy protects them.
 func (a *AllDBService) ListBackup(ctx context.Context, in *coreRpc.ListBackupRequest) (*coreRpc.ListBackupResult, error) {
 	var err error
 	backupMaps := map[string][]*coreRpc.SingleBackupResult{}
@@ -232,53 +334,47 @@ func (a *AllDBService) listAndFilterBackups(callbackFunc func(backupFile string,
 	return backupMaps, nil
 }
 
+// listBackups lists the backup files of this database in the backup target.
 func (c *CoreDB) listBackups() ([]string, error) {
-	backupDir := c.config.CronConfig.BackupDir
-	c.logger.Info("backup dir: " + backupDir)
-	fileInfos, err := fileutils.ListFiles(backupDir)
+	c.logger.Info("backup target: " + c.target.Location(""))
+	names, err := c.target.List()
 	if err != nil {
 		return nil, err
 	}
 	var filenames []string
-	for _, f := range fileInfos {
-		filenames = append(filenames, f.Name())
+	for _, name := range names {
+		if _, dbName := parseBackupName(name); dbName != c.config.DbConfig.Name {
+			continue
+		}
+		filenames = append(filenames, name)
 	}
 	return filenames, nil
 }
 
-func (c *CoreDB) createBackupFile(versionPrefix string) (io.WriteCloser, string, error) {
+func (c *CoreDB) backupFileName(versionPrefix string) string {
 	currentTime := time.Now().Format("200601021859")
-	backupFileName := filepath.Join(
-		c.config.CronConfig.BackupDir,
-		fmt.Sprintf(backupFormat, versionPrefix, c.config.DbConfig.Name, currentTime),
-	)
-	f, err := createFile(backupFileName)
-	if err != nil {
-		return nil, "", err
-	}
-	return f, backupFileName, nil
-}
-
-func createFile(fileName string) (io.WriteCloser, error) {
-	f, err := os.Create(fileName)
-	return f, err
+	return fmt.Sprintf(backupFormat, versionPrefix, c.config.DbConfig.Name, currentTime)
 }
 
-func (c *CoreDB) openFile(filepath string) (io.ReadCloser, error) {
-	exists := fileutils.FileExists(filepath)
-	if !exists {
-		return nil, fmt.Errorf("cannot find %s", filepath)
+// parseBackupName splits a backup file named after backupFormat into version and database name,
+// the database name may contain underscores itself.
+func parseBackupName(filename string) (version, dbName string) {
+	if path.Ext(filename) != ".bak" {
+		return "", ""
 	}
-	return os.Open(filepath)
+	name := strings.TrimSuffix(path.Base(filepath.ToSlash(filename)), ".bak")
+	if !strings.HasPrefix(name, "ver-") {
+		return "", ""
+	}
+	name = strings.TrimPrefix(name, "ver-")
+	first, last := strings.Index(name, "_"), strings.LastIndex(name, "_")
+	if first <= 0 || first == last {
+		return "", ""
+	}
+	return name[:first], name[first+1 : last]
 }
 
 func getVersion(filename string) string {
-	fslice := strings.Split(filename, "_")
-	if len(fslice) == 3 {
-		versionSlice := strings.Split(fslice[0], "-")
-		if len(versionSlice) == 2 {
-			return versionSlice[1]
-		}
-	}
-	return ""
+	version, _ := parseBackupName(filename)
+	return version
 }
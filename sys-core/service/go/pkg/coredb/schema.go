@@ -1,5 +1,11 @@
 package coredb
 
+import (
+	"context"
+
+	"github.com/genjidb/genji"
+)
+
 // Register dao models for db
 func (c *CoreDB) RegisterModels(modelsMap map[string]DbModel) error {
 	if len(modelsMap) == 0 {
@@ -7,16 +13,41 @@ func (c *CoreDB) RegisterModels(modelsMap map[string]DbModel) error {
 			Reason: errRegisterModelEmpty,
 		}
 	}
+	expiriesMap := map[string][]expiry{}
+	for tblName, model := range modelsMap {
+		exps, err := expiries(tblName, model)
+		if err != nil {
+			return err
+		}
+		if len(exps) > 0 {
+			expiriesMap[tblName] = exps
+		}
+		if _, err = structIndexes(tblName, model); err != nil {
+			return err
+		}
+	}
 	c.models = modelsMap
+	c.expiries = expiriesMap
+	c.access = map[string]*FieldAccess{}
+	for tblName, model := range modelsMap {
+		c.access[tblName] = NewFieldAccess(model)
+	}
 	return nil
 }
 
+// MakeSchema creates the registered tables and brings the schema up to date.
+// On a fresh database the registered migrations are only recorded as applied,
+// since CreateSQL of each model already describes the latest schema.
 func (c *CoreDB) MakeSchema() error {
-	tx, err := c.createTx()
+	fresh, err := c.isFreshSchema()
 	if err != nil {
 		return err
 	}
-	return c.txhelper(tx, func() error {
+	err = c.update(context.Background(), func(tx *genji.Tx) error {
+		indexes, err := indexNames(tx)
+		if err != nil {
+			return err
+		}
 		for tblName, tbl := range c.models {
 			sqlStatements := tbl.CreateSQL()
 			c.logger.Debugf("create table for: %s", tblName)
@@ -27,8 +58,22 @@ func (c *CoreDB) MakeSchema() error {
 				}
 			}
 		}
+		for _, stmt := range (appliedMigration{}).CreateSQL() {
+			if err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		if err = reindexNew(tx, indexes); err != nil {
+			return err
+		}
+		if fresh {
+			return c.stampMigrations(tx)
+		}
 		return nil
 	})
+	if err != nil || fresh {
+		return err
+	}
+	_, err = c.MigrateUp(0)
+	return err
 }
-
-
@@ -0,0 +1,338 @@
+// Package sqlengine is a genji engine storing the key values in a SQL database, SQLite or Postgres.
+// Genji keeps running the queries, the SQL database only holds its stores, one row per key,
+// so the genji schema and statements work unchanged on top of it.
+package sqlengine
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/genjidb/genji/engine"
+)
+
+// Dialect is the flavour of SQL spoken by the database.
+type Dialect int
+
+const (
+	SQLite Dialect = iota
+	Postgres
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case SQLite:
+		return "sqlite"
+	case Postgres:
+		return "postgres"
+	default:
+		return "unknown"
+	}
+}
+
+var tablePrefixRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Engine keeps the genji stores in two tables of the database: <prefix>_stores lists the stores
+// and their sequence, <prefix>_kv holds the key values ordered by store and key.
+// Several engines share a database as long as their prefixes differ.
+// A third table, <prefix>_leases, holds the leases taken by AcquireLease.
+//
+// Writes are serialized within the process. Across processes SQLite relies on its own locking
+// and Postgres runs the writable transactions serializable: a transaction conflicting with
+// another one fails with a serialization failure, see IsSerializationFailure, and has to be
+// run again from the start. CoreDB does so for its write transactions.
+type Engine struct {
+	db      *sql.DB
+	dialect Dialect
+	stores  string
+	kv      string
+	leases  string
+	// writeMu is held by the writable transaction in progress
+	writeMu sync.Mutex
+	closeMu sync.RWMutex
+	closed  bool
+}
+
+// NewEngine creates the tables of the engine if needed. The engine owns db and closes it on Close.
+func NewEngine(ctx context.Context, db *sql.DB, dialect Dialect, prefix string) (*Engine, error) {
+	if !tablePrefixRe.MatchString(prefix) {
+		return nil, fmt.Errorf("sqlengine: invalid table prefix %q", prefix)
+	}
+	ng := &Engine{
+		db:      db,
+		dialect: dialect,
+		stores:  prefix + "_stores",
+		kv:      prefix + "_kv",
+		leases:  prefix + "_leases",
+	}
+	blob := "BLOB"
+	if dialect == Postgres {
+		blob = "BYTEA"
+	}
+	stmts := []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (name %s PRIMARY KEY, seq BIGINT NOT NULL)", ng.stores, blob),
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (store %s NOT NULL, k %s NOT NULL, v %s NOT NULL, PRIMARY KEY (store, k))", ng.kv, blob, blob, blob),
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (name TEXT PRIMARY KEY, holder TEXT NOT NULL, expires BIGINT NOT NULL)", ng.leases),
+	}
+	for _, stmt := range stmts {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, err
+		}
+	}
+	return ng, nil
+}
+
+// Open opens the database with a registered database/sql driver and creates an engine on it.
+func Open(ctx context.Context, driverName, dsn string, dialect Dialect, prefix string) (*Engine, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	ng, err := NewEngine(ctx, db, dialect, prefix)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return ng, nil
+}
+
+// IsSerializationFailure reports whether err is a serialization failure, SQLSTATE 40001, raised by
+// Postgres when a serializable transaction conflicts with a concurrent one.
+func IsSerializationFailure(err error) bool {
+	var sqlErr interface{ SQLState() string }
+	return errors.As(err, &sqlErr) && sqlErr.SQLState() == "40001"
+}
+
+// DB returns the database the engine runs on.
+func (ng *Engine) DB() *sql.DB {
+	return ng.db
+}
+
+// Begin starts a database transaction, a writable one waits for the previous one to end.
+// The transaction is started by hand on a connection of its own: database/sql has no way to
+// ask SQLite for the write lock upfront, a deferred transaction upgrading to a write can fail
+// right away instead of waiting.
+func (ng *Engine) Begin(ctx context.Context, opts engine.TxOptions) (engine.Transaction, error) {
+	ng.closeMu.RLock()
+	defer ng.closeMu.RUnlock()
+	if ng.closed {
+		return nil, errors.New("sqlengine: engine closed")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	begin := "BEGIN"
+	switch {
+	case ng.dialect == SQLite && opts.Writable:
+		begin = "BEGIN IMMEDIATE"
+	case ng.dialect == Postgres && opts.Writable:
+		begin = "BEGIN ISOLATION LEVEL SERIALIZABLE"
+	case ng.dialect == Postgres:
+		begin = "BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY"
+	}
+	if opts.Writable {
+		ng.writeMu.Lock()
+	}
+	conn, err := ng.db.Conn(ctx)
+	if err == nil {
+		if _, err = conn.ExecContext(ctx, begin); err != nil {
+			_ = conn.Close()
+		}
+	}
+	if err != nil {
+		if opts.Writable {
+			ng.writeMu.Unlock()
+		}
+		return nil, err
+	}
+	return &transaction{ctx: ctx, ng: ng, conn: conn, writable: opts.Writable}, nil
+}
+
+// AcquireLease takes or renews the lease name for holder until ttl from now. It fails to,
+// without error, while another holder has the lease. The expiries are the clocks of the holders,
+// they have to agree within a fraction of ttl.
+func (ng *Engine) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	// the upsert leaves the row alone, and affects none, while another holder has the lease
+	stmt := fmt.Sprintf("INSERT INTO %[1]s (name, holder, expires) VALUES (?, ?, ?) "+
+		"ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, expires = excluded.expires "+
+		"WHERE %[1]s.holder = excluded.holder OR %[1]s.expires <= ?", ng.leases)
+	res, err := ng.db.ExecContext(ctx, ng.bind(stmt), name, holder, now.Add(ttl).UnixNano(), now.UnixNano())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// ReleaseLeases gives up the leases of holder.
+func (ng *Engine) ReleaseLeases(ctx context.Context, holder string) error {
+	_, err := ng.db.ExecContext(ctx, ng.bind(fmt.Sprintf("DELETE FROM %s WHERE holder = ?", ng.leases)), holder)
+	return err
+}
+
+// Close closes the database.
+func (ng *Engine) Close() error {
+	ng.closeMu.Lock()
+	defer ng.closeMu.Unlock()
+	if ng.closed {
+		return errors.New("sqlengine: engine already closed")
+	}
+	ng.closed = true
+	return ng.db.Close()
+}
+
+// bind rewrites the ? placeholders of a statement for the dialect, the statements of the engine
+// have no question mark anywhere else.
+func (ng *Engine) bind(stmt string) string {
+	if ng.dialect != Postgres {
+		return stmt
+	}
+	var sb strings.Builder
+	n := 0
+	for _, r := range stmt {
+		if r == '?' {
+			n++
+			sb.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+type transaction struct {
+	ctx        context.Context
+	ng         *Engine
+	conn       *sql.Conn
+	writable   bool
+	terminated bool
+}
+
+// end runs COMMIT or ROLLBACK and hands the connection back to the pool.
+// It does not use the context of the transaction, which may be canceled already.
+func (t *transaction) end(stmt string) error {
+	t.terminated = true
+	_, err := t.conn.ExecContext(context.Background(), stmt)
+	if closeErr := t.conn.Close(); err == nil {
+		err = closeErr
+	}
+	if t.writable {
+		t.ng.writeMu.Unlock()
+	}
+	return err
+}
+
+// Rollback cancels the transaction, it does nothing once the transaction has ended.
+func (t *transaction) Rollback() error {
+	if t.terminated {
+		return nil
+	}
+	err := t.end("ROLLBACK")
+	if ctxErr := t.ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+// Commit commits a writable transaction.
+func (t *transaction) Commit() error {
+	if t.terminated {
+		return errors.New("sqlengine: transaction already terminated")
+	}
+	if !t.writable {
+		return engine.ErrTransactionReadOnly
+	}
+	if err := t.ctx.Err(); err != nil {
+		_ = t.end("ROLLBACK")
+		return err
+	}
+	return t.end("COMMIT")
+}
+
+// exec, query and queryRow fail once the context of the transaction is done, the drivers
+// may not notice before running a short statement.
+func (t *transaction) exec(stmt string, args ...interface{}) (sql.Result, error) {
+	if err := t.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return t.conn.ExecContext(t.ctx, t.ng.bind(stmt), args...)
+}
+
+func (t *transaction) query(stmt string, args ...interface{}) (*sql.Rows, error) {
+	if err := t.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return t.conn.QueryContext(t.ctx, t.ng.bind(stmt), args...)
+}
+
+func (t *transaction) queryRow(dest []interface{}, stmt string, args ...interface{}) error {
+	if err := t.ctx.Err(); err != nil {
+		return err
+	}
+	return t.conn.QueryRowContext(t.ctx, t.ng.bind(stmt), args...).Scan(dest...)
+}
+
+func (t *transaction) storeExists(name []byte) (bool, error) {
+	var one int
+	err := t.queryRow([]interface{}{&one}, fmt.Sprintf("SELECT 1 FROM %s WHERE name = ?", t.ng.stores), name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetStore returns a store by name.
+func (t *transaction) GetStore(name []byte) (engine.Store, error) {
+	ok, err := t.storeExists(name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, engine.ErrStoreNotFound
+	}
+	return &store{tx: t, name: append([]byte{}, name...)}, nil
+}
+
+// CreateStore creates a store, it fails if the store exists.
+func (t *transaction) CreateStore(name []byte) error {
+	if !t.writable {
+		return engine.ErrTransactionReadOnly
+	}
+	ok, err := t.storeExists(name)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return engine.ErrStoreAlreadyExists
+	}
+	_, err = t.exec(fmt.Sprintf("INSERT INTO %s (name, seq) VALUES (?, 0)", t.ng.stores), name)
+	return err
+}
+
+// DropStore deletes a store and its key values.
+func (t *transaction) DropStore(name []byte) error {
+	if !t.writable {
+		return engine.ErrTransactionReadOnly
+	}
+	res, err := t.exec(fmt.Sprintf("DELETE FROM %s WHERE name = ?", t.ng.stores), name)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return engine.ErrStoreNotFound
+	}
+	_, err = t.exec(fmt.Sprintf("DELETE FROM %s WHERE store = ?", t.ng.kv), name)
+	return err
+}
@@ -0,0 +1,185 @@
+package sqlengine
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/genjidb/genji/engine"
+)
+
+// iteratorBatch is the number of rows an iterator reads at once.
+const iteratorBatch = 128
+
+type store struct {
+	tx   *transaction
+	name []byte
+}
+
+// Get returns the value of a key.
+func (s *store) Get(k []byte) ([]byte, error) {
+	var v []byte
+	err := s.tx.queryRow([]interface{}{&v}, fmt.Sprintf("SELECT v FROM %s WHERE store = ? AND k = ?", s.tx.ng.kv), s.name, k)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, engine.ErrKeyNotFound
+	}
+	return v, err
+}
+
+// Put stores a key value, replacing the previous value of the key.
+func (s *store) Put(k, v []byte) error {
+	if !s.tx.writable {
+		return engine.ErrTransactionReadOnly
+	}
+	if len(k) == 0 {
+		return errors.New("sqlengine: empty keys are forbidden")
+	}
+	if len(v) == 0 {
+		return errors.New("sqlengine: empty values are forbidden")
+	}
+	_, err := s.tx.exec(fmt.Sprintf(
+		"INSERT INTO %s (store, k, v) VALUES (?, ?, ?) ON CONFLICT (store, k) DO UPDATE SET v = excluded.v", s.tx.ng.kv,
+	), s.name, k, v)
+	return err
+}
+
+// Delete removes a key value.
+func (s *store) Delete(k []byte) error {
+	if !s.tx.writable {
+		return engine.ErrTransactionReadOnly
+	}
+	res, err := s.tx.exec(fmt.Sprintf("DELETE FROM %s WHERE store = ? AND k = ?", s.tx.ng.kv), s.name, k)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return engine.ErrKeyNotFound
+	}
+	return nil
+}
+
+// Truncate removes every key value of the store.
+func (s *store) Truncate() error {
+	if !s.tx.writable {
+		return engine.ErrTransactionReadOnly
+	}
+	_, err := s.tx.exec(fmt.Sprintf("DELETE FROM %s WHERE store = ?", s.tx.ng.kv), s.name)
+	return err
+}
+
+// NextSequence increments the sequence of the store.
+func (s *store) NextSequence() (uint64, error) {
+	if !s.tx.writable {
+		return 0, engine.ErrTransactionReadOnly
+	}
+	if _, err := s.tx.exec(fmt.Sprintf("UPDATE %s SET seq = seq + 1 WHERE name = ?", s.tx.ng.stores), s.name); err != nil {
+		return 0, err
+	}
+	var seq int64
+	err := s.tx.queryRow([]interface{}{&seq}, fmt.Sprintf("SELECT seq FROM %s WHERE name = ?", s.tx.ng.stores), s.name)
+	return uint64(seq), err
+}
+
+// Iterator returns an iterator on the keys of the store, it has to be positioned with Seek.
+func (s *store) Iterator(opts engine.IteratorOptions) engine.Iterator {
+	return &iterator{store: s, reverse: opts.Reverse}
+}
+
+type item struct {
+	k, v []byte
+}
+
+func (i *item) Key() []byte {
+	return i.k
+}
+
+func (i *item) ValueCopy(buf []byte) ([]byte, error) {
+	return append(buf[:0], i.v...), nil
+}
+
+// iterator reads the keys in batches, each one starting after the last key of the previous one,
+// so that the rows are never left open while the transaction runs other statements.
+type iterator struct {
+	store   *store
+	reverse bool
+	batch   []*item
+	pos     int
+	// last is set once the store has no more keys after the batch
+	last bool
+	err  error
+}
+
+func (it *iterator) fetch(from []byte, inclusive bool) {
+	cmp, order := ">", "ASC"
+	if it.reverse {
+		cmp, order = "<", "DESC"
+	}
+	if inclusive {
+		cmp += "="
+	}
+	it.batch, it.pos, it.last = it.batch[:0], 0, true
+	args := []interface{}{it.store.name}
+	where := "store = ?"
+	if len(from) > 0 {
+		where += fmt.Sprintf(" AND k %s ?", cmp)
+		args = append(args, from)
+	}
+	stmt := fmt.Sprintf("SELECT k, v FROM %s WHERE %s ORDER BY k %s LIMIT %d", it.store.tx.ng.kv, where, order, iteratorBatch)
+	rows, err := it.store.tx.query(stmt, args...)
+	if err != nil {
+		it.err = err
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		i := &item{}
+		if err = rows.Scan(&i.k, &i.v); err != nil {
+			it.err = err
+			return
+		}
+		it.batch = append(it.batch, i)
+	}
+	if it.err = rows.Err(); it.err == nil {
+		it.last = len(it.batch) < iteratorBatch
+	}
+}
+
+// Seek moves to k, or to the key right after it, or before it when iterating in reverse.
+func (it *iterator) Seek(k []byte) {
+	it.err = nil
+	it.fetch(k, true)
+}
+
+// Next moves to the following key.
+func (it *iterator) Next() {
+	if !it.Valid() {
+		return
+	}
+	it.pos++
+	if it.pos < len(it.batch) || it.last {
+		return
+	}
+	from := it.batch[len(it.batch)-1].k
+	it.fetch(append([]byte{}, from...), false)
+}
+
+func (it *iterator) Err() error {
+	return it.err
+}
+
+func (it *iterator) Valid() bool {
+	return it.err == nil && it.pos < len(it.batch)
+}
+
+func (it *iterator) Item() engine.Item {
+	return it.batch[it.pos]
+}
+
+func (it *iterator) Close() error {
+	it.batch = nil
+	return nil
+}
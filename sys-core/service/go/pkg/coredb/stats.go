@@ -0,0 +1,287 @@
+package coredb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/genjidb/genji"
+	"github.com/genjidb/genji/document"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	backupJobName       = "backup"
+	gcJobName           = "gc"
+	defaultDiscardRatio = 0.5
+)
+
+// GCOptions schedules the badger value log garbage collection.
+type GCOptions struct {
+	// Schedule is a cron spec, the scheduled GC is disabled when empty.
+	Schedule string `json:"schedule" yaml:"schedule" mapstructure:"schedule"`
+	// DiscardRatio is the share of stale data a value log file needs to be rewritten, defaults to 0.5.
+	DiscardRatio float64 `json:"discardRatio" yaml:"discardRatio" mapstructure:"discardRatio"`
+}
+
+// CronResult is the outcome of the last run of a scheduled job.
+type CronResult struct {
+	Job       string `json:"job"`
+	StartedAt int64  `json:"startedAt"`
+	// Duration in milliseconds.
+	Duration int64  `json:"duration"`
+	Error    string `json:"error,omitempty"`
+	// Manual is set on the runs asked for, rather than scheduled.
+	Manual bool `json:"manual,omitempty"`
+}
+
+// CronResults returns the last result of every job which ran at least once.
+func (c *CoreDB) CronResults() []*CronResult {
+	var results []*CronResult
+	for _, js := range c.Jobs() {
+		if js.LastRun != nil {
+			results = append(results, js.LastRun)
+		}
+	}
+	return results
+}
+
+func (c *CoreDB) scheduleGC() error {
+	if _, err := c.badgerDB(); err != nil {
+		return nil
+	}
+	// without schedule the gc only runs on demand
+	return c.RegisterJob(gcJobName, c.opts.GC.Schedule, func(context.Context) error {
+		_, err := c.GC(c.opts.GC.DiscardRatio, false)
+		return err
+	})
+}
+
+// TableStats counts the documents of a table.
+type TableStats struct {
+	Table string `json:"table"`
+	Keys  int64  `json:"keys"`
+}
+
+// DbStats describes the size and content of a database.
+type DbStats struct {
+	DbName string `json:"dbName"`
+	// DiskSize is the size of the database directory, LsmSize and VlogSize the part taken by
+	// the badger tables and value logs.
+	DiskSize      int64         `json:"diskSize"`
+	LsmSize       int64         `json:"lsmSize"`
+	VlogSize      int64         `json:"vlogSize"`
+	Tables        []*TableStats `json:"tables"`
+	SchemaVersion int           `json:"schemaVersion"`
+	LastBackup    *BackupEntry  `json:"lastBackup,omitempty"`
+	LastCron      []*CronResult `json:"lastCron"`
+}
+
+// dirSizes sums the file sizes of the database directory.
+func (c *CoreDB) dirSizes() (total, lsm, vlog int64, err error) {
+	err = filepath.Walk(c.dbPath(), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		total += info.Size()
+		switch filepath.Ext(path) {
+		case ".sst":
+			lsm += info.Size()
+		case ".vlog":
+			vlog += info.Size()
+		}
+		return nil
+	})
+	return total, lsm, vlog, err
+}
+
+// Stats reports the disk usage, table sizes, last backup and last cron results of the database.
+func (c *CoreDB) Stats() (*DbStats, error) {
+	stats := &DbStats{DbName: c.config.DbConfig.Name, LastCron: c.CronResults()}
+	// the sizes are those of the badger files, the other engines leave them at zero
+	if _, err := c.badgerDB(); err == nil {
+		c.storeMu.RLock()
+		total, lsm, vlog, err := c.dirSizes()
+		c.storeMu.RUnlock()
+		if err != nil {
+			return nil, err
+		}
+		stats.DiskSize, stats.LsmSize, stats.VlogSize = total, lsm, vlog
+	}
+	var err error
+	for _, table := range c.Tables() {
+		doc, err := c.QueryOne(fmt.Sprintf("SELECT COUNT(*) FROM %s", table))
+		if err != nil {
+			return nil, fmt.Errorf("counting %s: %v", table, err)
+		}
+		var count int64
+		if err = doc.Doc.Iterate(func(_ string, v document.Value) error {
+			count, _ = v.V.(int64)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		stats.Tables = append(stats.Tables, &TableStats{Table: table, Keys: count})
+	}
+	if stats.SchemaVersion, err = c.SchemaVersion(); err != nil {
+		// the schema has not been made yet
+		stats.SchemaVersion = 0
+	}
+	chain, err := c.BackupChain()
+	if err != nil {
+		return nil, err
+	}
+	if len(chain) > 0 {
+		stats.LastBackup = chain[len(chain)-1]
+	}
+	return stats, nil
+}
+
+// Health checks that the database answers a read transaction.
+func (c *CoreDB) Health(ctx context.Context) error {
+	return c.view(ctx, func(tx *genji.Tx) error {
+		_, err := tx.QueryDocument("SELECT COUNT(*) FROM " + migrationsTableName)
+		return err
+	})
+}
+
+// GC rewrites the value log files with at least discardRatio stale data, until none is left.
+// Flatten compacts the LSM tree into its last level first, which drops overwritten keys
+// and lets the value log GC reclaim more.
+func (c *CoreDB) GC(discardRatio float64, flatten bool) (int, error) {
+	if discardRatio <= 0 || discardRatio >= 1 {
+		discardRatio = defaultDiscardRatio
+	}
+	c.storeMu.RLock()
+	defer c.storeMu.RUnlock()
+	db, err := c.badgerDB()
+	if err != nil {
+		return 0, err
+	}
+	if flatten {
+		if err := db.Flatten(2); err != nil {
+			return 0, err
+		}
+	}
+	rewrites := 0
+	for {
+		err := db.RunValueLogGC(discardRatio)
+		if err == badger.ErrNoRewrite || err == badger.ErrRejected {
+			return rewrites, nil
+		}
+		if err != nil {
+			return rewrites, err
+		}
+		rewrites++
+	}
+}
+
+type DbStatsResult struct {
+	Results []*DbStats `json:"results"`
+}
+
+// Stats reports the statistics of one or all registered databases.
+func (a *AllDBService) Stats(_ context.Context, in *BackupRequest) (*DbStatsResult, error) {
+	if in == nil {
+		in = &BackupRequest{}
+	}
+	cdbs, err := a.selectCoreDBs(in.DbName)
+	if err != nil {
+		return nil, err
+	}
+	res := &DbStatsResult{}
+	for _, cdb := range cdbs {
+		stats, err := cdb.Stats()
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "unable to get stats of %s: %v", cdb.config.DbConfig.Name, err)
+		}
+		res.Results = append(res.Results, stats)
+	}
+	return res, nil
+}
+
+type HealthResult struct {
+	DbName  string `json:"dbName"`
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+type HealthAllResult struct {
+	Healthy bool            `json:"healthy"`
+	Results []*HealthResult `json:"results"`
+}
+
+// Health checks one or all registered databases, unhealthy ones are reported in the result.
+func (a *AllDBService) Health(ctx context.Context, in *BackupRequest) (*HealthAllResult, error) {
+	if in == nil {
+		in = &BackupRequest{}
+	}
+	cdbs, err := a.selectCoreDBs(in.DbName)
+	if err != nil {
+		return nil, err
+	}
+	res := &HealthAllResult{Healthy: true}
+	for _, cdb := range cdbs {
+		hr := &HealthResult{DbName: cdb.config.DbConfig.Name, Healthy: true}
+		if err := cdb.Health(ctx); err != nil {
+			hr.Healthy, hr.Error = false, err.Error()
+			res.Healthy = false
+		}
+		res.Results = append(res.Results, hr)
+	}
+	return res, nil
+}
+
+// GCRequest triggers the value log GC of one or all registered databases.
+type GCRequest struct {
+	DbName       string  `json:"dbName"`
+	DiscardRatio float64 `json:"discardRatio"`
+	Flatten      bool    `json:"flatten"`
+}
+
+type GCResult struct {
+	DbName     string `json:"dbName"`
+	Rewrites   int    `json:"rewrites"`
+	SizeBefore int64  `json:"sizeBefore"`
+	SizeAfter  int64  `json:"sizeAfter"`
+}
+
+type GCAllResult struct {
+	Results []*GCResult `json:"results"`
+}
+
+// GC runs the value log GC on demand.
+func (a *AllDBService) GC(ctx context.Context, in *GCRequest) (*GCAllResult, error) {
+	if in == nil {
+		in = &GCRequest{}
+	}
+	cdbs, err := a.selectCoreDBs(in.DbName)
+	if err != nil {
+		return nil, err
+	}
+	res := &GCAllResult{}
+	for _, cdb := range cdbs {
+		gr := &GCResult{DbName: cdb.config.DbConfig.Name}
+		gr.SizeBefore, _, _, _ = cdb.dirSizes()
+		run, err := cdb.runJob(ctx, gcJobName, true, func(context.Context) error {
+			var err error
+			gr.Rewrites, err = cdb.GC(in.DiscardRatio, in.Flatten)
+			return err
+		})
+		if err == nil && run.Error != "" {
+			err = fmt.Errorf("%s", run.Error)
+		}
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "unable to run gc on %s: %v", cdb.config.DbConfig.Name, err)
+		}
+		gr.SizeAfter, _, _, _ = cdb.dirSizes()
+		res.Results = append(res.Results, gr)
+	}
+	return res, nil
+}
@@ -0,0 +1,224 @@
+package coredb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/genjidb/genji"
+	"github.com/genjidb/genji/document"
+	"github.com/robfig/cron/v3"
+	"github.com/segmentio/encoding/json"
+	"gopkg.in/yaml.v2"
+
+	sharedConfig "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
+	commonCfg "go.amplifyedge.org/sys-share-v2/sys-core/service/config/common"
+	log "go.amplifyedge.org/sys-share-v2/sys-core/service/logging"
+)
+
+// NewTestDB creates a database for tests, genji runs on the memory engine and nothing is scheduled:
+// cron functions can be registered, they never run on their own. Every call returns a database
+// of its own, without any directory, so tests can run in parallel.
+func NewTestDB(l log.Logger) (*CoreDB, error) {
+	cfg := &commonCfg.Config{
+		DbConfig: commonCfg.DbConfig{Name: "test-" + sharedConfig.NewID()},
+	}
+	cdb := &CoreDB{
+		logger:   l,
+		models:   map[string]DbModel{},
+		config:   cfg,
+		opts:     Options{Engine: EngineOptions{Kind: EngineMemory}},
+		crony:    cron.New(),
+		watchers: newWatchHub(),
+	}
+	target, err := newBackupTarget(cdb.opts.Target, cfg.CronConfig.BackupDir)
+	if err != nil {
+		return nil, err
+	}
+	cdb.target = target
+	if err = cdb.openStore(); err != nil {
+		return nil, err
+	}
+	return cdb, nil
+}
+
+// Close stops the scheduler, waiting for the running jobs, hands the jobs over to the other
+// replicas and closes the database.
+func (c *CoreDB) Close() error {
+	<-c.crony.Stop().Done()
+	if c.cronLock != nil {
+		if err := c.cronLock.release(context.Background()); err != nil {
+			c.logger.Warnf("%s unable to release the cron lock of %s: %v", moduleName, c.config.DbConfig.Name, err)
+		}
+	}
+	c.storeMu.Lock()
+	defer c.storeMu.Unlock()
+	return c.store.Close()
+}
+
+// LoadFixtures inserts the rows of fixture files into the registered tables.
+// A fixture file is named after its table, as in accounts.yml, accounts.yaml or accounts.json,
+// and holds the list of the rows of the table, each one mapping columns to values.
+// The values are read as ImportTable reads them, blobs are base64 encoded.
+// A directory stands for the fixture files in it, loaded in name order.
+func (c *CoreDB) LoadFixtures(ctx context.Context, paths ...string) error {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && fixtureTable(entry.Name()) != "" {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+	for _, file := range files {
+		table := fixtureTable(filepath.Base(file))
+		if table == "" {
+			return Error{Reason: errInvalidFixture, Err: fmt.Errorf("%s is not a yaml or json file", file)}
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		// json is read as yaml as well
+		var rows []interface{}
+		if err = yaml.Unmarshal(content, &rows); err != nil {
+			return Error{Reason: errInvalidFixture, Err: fmt.Errorf("%s: %v", file, err)}
+		}
+		if err = c.InsertFixture(ctx, table, rows...); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+func fixtureTable(name string) string {
+	for _, ext := range []string{".yml", ".yaml", ".json"} {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return ""
+}
+
+// InsertFixture inserts rows into table, each row is a map of columns to values.
+func (c *CoreDB) InsertFixture(ctx context.Context, table string, rows ...interface{}) error {
+	var lines bytes.Buffer
+	for i, row := range rows {
+		row = jsonValue(row)
+		if _, ok := row.(map[string]interface{}); !ok {
+			return Error{Reason: errInvalidFixture, Err: fmt.Errorf("row %d of %s is not a map of columns", i+1, table)}
+		}
+		line, err := json.Marshal(row)
+		if err != nil {
+			return Error{Reason: errInvalidFixture, Err: fmt.Errorf("row %d of %s: %v", i+1, table, err)}
+		}
+		lines.Write(line)
+		lines.WriteByte('\n')
+	}
+	_, err := c.ImportTable(ctx, &lines, table, ExportFormatJSONL)
+	return err
+}
+
+// jsonValue turns the maps decoded from yaml, keyed by interface{}, into maps json can encode.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = jsonValue(val)
+		}
+		return m
+	case map[string]interface{}:
+		for k, val := range v {
+			v[k] = jsonValue(val)
+		}
+		return v
+	case []interface{}:
+		for i, val := range v {
+			v[i] = jsonValue(val)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// Snapshot is a copy of the rows of the registered tables, taken by CoreDB.Snapshot.
+type Snapshot struct {
+	tables map[string][]*document.FieldBuffer
+}
+
+// Rows returns the number of rows of the snapshot of table.
+func (s *Snapshot) Rows(table string) int {
+	return len(s.tables[table])
+}
+
+// Snapshot copies the rows of every registered table in memory, for Reset to put them back,
+// typically between subtests sharing a database.
+func (c *CoreDB) Snapshot(ctx context.Context) (*Snapshot, error) {
+	snap := &Snapshot{tables: map[string][]*document.FieldBuffer{}}
+	err := c.view(ctx, func(tx *genji.Tx) error {
+		for _, table := range c.Tables() {
+			res, err := tx.Query("SELECT * FROM " + table)
+			if err != nil {
+				return err
+			}
+			err = res.Iterate(func(d document.Document) error {
+				fb := document.NewFieldBuffer()
+				if err := fb.Copy(d); err != nil {
+					return err
+				}
+				snap.tables[table] = append(snap.tables[table], fb)
+				return nil
+			})
+			if closeErr := res.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// Reset replaces the rows of the registered tables with the ones of snap in a single transaction,
+// a nil snap empties them. The tables registered after the snapshot are emptied as well.
+func (c *CoreDB) Reset(ctx context.Context, snap *Snapshot) error {
+	return c.update(ctx, func(tx *genji.Tx) error {
+		for _, table := range c.Tables() {
+			if err := tx.Exec("DELETE FROM " + table); err != nil {
+				return err
+			}
+			if snap == nil {
+				continue
+			}
+			insert := fmt.Sprintf("INSERT INTO %s VALUES ?", table)
+			for _, doc := range snap.tables[table] {
+				if err := tx.Exec(insert, doc); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,141 @@
+package coredb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+
+	sharedConfig "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
+)
+
+// Rows expire through the coredb tags of their model: a field tagged coredb:"expires" holds the
+// unix time in seconds the row expires at, zero or null never expires. The sweeper deletes the
+// expired rows, unless the field also lists columns with clears, as in
+// coredb:"expires,clears=token|token_hint", in which case only those columns and the expiry itself
+// are unset, which suits a value with a shorter life than the row it is stored in.
+
+const (
+	ttlJobName         = "ttl"
+	defaultTTLSchedule = "@every 1h"
+)
+
+// TTLOptions schedules the sweeper of the expired rows.
+type TTLOptions struct {
+	// Schedule is a cron spec, defaults to every hour.
+	Schedule string `json:"schedule" yaml:"schedule" mapstructure:"schedule"`
+	// Disabled turns the sweeper off, expired rows are then only left out of reads.
+	Disabled bool `json:"disabled" yaml:"disabled" mapstructure:"disabled"`
+}
+
+// expiry is a field tagged expires.
+type expiry struct {
+	column string
+	clears []string
+}
+
+// expiries reads the expires tags of a model struct or pointer to it.
+func expiries(table string, model interface{}) ([]expiry, error) {
+	modelType := reflect.Indirect(reflect.ValueOf(model)).Type()
+	columns := map[string]bool{}
+	for i := 0; i < modelType.NumField(); i++ {
+		columns[modelType.Field(i).Tag.Get("genji")] = true
+	}
+	var exps []expiry
+	for i := 0; i < modelType.NumField(); i++ {
+		field := modelType.Field(i)
+		tag := field.Tag.Get("coredb")
+		if !tagOptions(tag)[tagExpires] {
+			continue
+		}
+		switch field.Type.Kind() {
+		case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		default:
+			return nil, Error{Reason: errInvalidExpiry, Err: fmt.Errorf("%s.%s is a %s, not a unix time", table, field.Name, field.Type)}
+		}
+		exp := expiry{column: field.Tag.Get("genji")}
+		if clears, ok := tagValue(tag, tagClears); ok {
+			for _, column := range strings.Split(clears, "|") {
+				if !columns[column] || column == exp.column {
+					return nil, Error{Reason: errInvalidExpiry, Err: fmt.Errorf("%s.%s cannot clear %q", table, field.Name, column)}
+				}
+				exp.clears = append(exp.clears, column)
+			}
+		}
+		exps = append(exps, exp)
+	}
+	return exps, nil
+}
+
+// expiredAt matches the rows expired at the unix time now.
+func (e expiry) expiredAt(now int64) sq.Sqlizer {
+	return sq.And{sq.Gt{e.column: 0}, sq.LtOrEq{e.column: now}}
+}
+
+// sweepStatement removes or clears the rows expired at now.
+func (e expiry) sweepStatement(table string, now int64) (Statement, error) {
+	if len(e.clears) == 0 {
+		return NewStatement(sq.Delete(table).Where(e.expiredAt(now)))
+	}
+	// squirrel has no UNSET
+	cond, args, err := e.expiredAt(now).ToSql()
+	if err != nil {
+		return Statement{}, err
+	}
+	return Statement{
+		Query: fmt.Sprintf("UPDATE %s UNSET %s, %s WHERE %s", table, strings.Join(e.clears, ", "), e.column, cond),
+		Args:  args,
+	}, nil
+}
+
+// NotExpired matches the rows of table which have not expired yet, or nil when the rows of the table
+// do not expire. The sweeper only runs from time to time, reads which must not see an expired row
+// add it to their conditions.
+func (c *CoreDB) NotExpired(table string) sq.Sqlizer {
+	now := sharedConfig.CurrentTimestamp()
+	var live sq.And
+	for _, e := range c.expiries[table] {
+		if len(e.clears) == 0 {
+			live = append(live, sq.Or{sq.Eq{e.column: nil}, sq.LtOrEq{e.column: 0}, sq.Gt{e.column: now}})
+		}
+	}
+	if len(live) == 0 {
+		return nil
+	}
+	return live
+}
+
+// SweepExpired deletes the expired rows of every registered table and unsets the expired columns,
+// in a single transaction.
+func (c *CoreDB) SweepExpired(ctx context.Context) error {
+	now := sharedConfig.CurrentTimestamp()
+	var stmts []Statement
+	for table, exps := range c.expiries {
+		for _, e := range exps {
+			stmt, err := e.sweepStatement(table, now)
+			if err != nil {
+				return err
+			}
+			stmts = append(stmts, stmt)
+		}
+	}
+	if len(stmts) == 0 {
+		return nil
+	}
+	return c.Update(ctx, func(tx *Tx) error {
+		return tx.ExecAll(stmts...)
+	})
+}
+
+func (c *CoreDB) scheduleTTL() error {
+	if c.opts.TTL.Disabled {
+		return nil
+	}
+	schedule := c.opts.TTL.Schedule
+	if schedule == "" {
+		schedule = defaultTTLSchedule
+	}
+	return c.RegisterJob(ttlJobName, schedule, c.SweepExpired)
+}
@@ -0,0 +1,117 @@
+package coredb
+
+import (
+	"context"
+
+	"github.com/genjidb/genji"
+)
+
+// Statement is a query and its arguments, run in order by ExecAll.
+type Statement struct {
+	Query string
+	Args  []interface{}
+}
+
+// NewStatement builds a Statement from a squirrel builder.
+func NewStatement(builder StmtIFacer) (Statement, error) {
+	query, args, err := builder.ToSql()
+	return Statement{Query: query, Args: args}, err
+}
+
+// Querier runs statements, it is implemented by CoreDB and Tx so that data access code
+// can be shared between standalone calls and transactions.
+type Querier interface {
+	Exec(stmt string, args ...interface{}) error
+	Query(stmt string, args ...interface{}) (*QueryResult, error)
+	QueryOne(stmt string, args ...interface{}) (*DocumentResult, error)
+}
+
+var (
+	_ Querier = (*CoreDB)(nil)
+	_ Querier = (*Tx)(nil)
+)
+
+// Tx is the transaction handed to the Update and View callbacks, it is only valid during the callback.
+// Statements must go through the Tx, calling the CoreDB from within Update blocks on the transaction itself.
+type Tx struct {
+	ctx context.Context
+	tx  *genji.Tx
+	db  *CoreDB
+}
+
+// Context returns the context the transaction was started with.
+func (t *Tx) Context() context.Context {
+	return t.ctx
+}
+
+func (t *Tx) Exec(stmt string, args ...interface{}) error {
+	if err := t.ctx.Err(); err != nil {
+		return err
+	}
+	return t.tx.Exec(stmt, args...)
+}
+
+// ExecAll runs the statements in order, stopping at the first error.
+func (t *Tx) ExecAll(stmts ...Statement) error {
+	for _, stmt := range stmts {
+		if err := t.Exec(stmt.Query, stmt.Args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Tx) Query(stmt string, args ...interface{}) (*QueryResult, error) {
+	if err := t.ctx.Err(); err != nil {
+		return nil, err
+	}
+	res, err := t.tx.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &QueryResult{Result: res}, nil
+}
+
+func (t *Tx) QueryOne(stmt string, args ...interface{}) (*DocumentResult, error) {
+	if err := t.ctx.Err(); err != nil {
+		return nil, err
+	}
+	doc, err := t.tx.QueryDocument(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &DocumentResult{doc}, nil
+}
+
+// Update runs fn in a read-write transaction, committed when fn returns nil and rolled back otherwise.
+// fn runs again in a new transaction when the commit conflicts with a concurrent transaction,
+// it should have no effect outside of tx.
+func (c *CoreDB) Update(ctx context.Context, fn func(tx *Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.update(ctx, func(tx *genji.Tx) error {
+		if err := fn(&Tx{ctx: ctx, tx: tx, db: c}); err != nil {
+			return err
+		}
+		// do not commit work the caller gave up on
+		return ctx.Err()
+	})
+}
+
+// View runs fn in a read-only transaction.
+func (c *CoreDB) View(ctx context.Context, fn func(tx *Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.view(ctx, func(tx *genji.Tx) error {
+		return fn(&Tx{ctx: ctx, tx: tx, db: c})
+	})
+}
+
+// ExecAll runs the statements in order in a single transaction.
+func (c *CoreDB) ExecAll(ctx context.Context, stmts ...Statement) error {
+	return c.Update(ctx, func(tx *Tx) error {
+		return tx.ExecAll(stmts...)
+	})
+}
@@ -0,0 +1,478 @@
+package coredb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/genjidb/genji/document"
+	"github.com/genjidb/genji/document/encoding/msgpack"
+	"github.com/genjidb/genji/engine"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	sharedConfig "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
+)
+
+const (
+	defaultWatchBuffer = 256
+	// genji keeps its catalog in stores prefixed with __genji_, the table infos
+	// map each table to the store holding its documents.
+	genjiInternalPrefix = "__genji_"
+	genjiTablesStore    = genjiInternalPrefix + "tables"
+)
+
+// ChangeOp is the kind of write a ChangeEvent reports.
+type ChangeOp string
+
+const (
+	ChangeInsert ChangeOp = "insert"
+	ChangeUpdate ChangeOp = "update"
+	ChangeDelete ChangeOp = "delete"
+)
+
+// ChangeEvent is a committed write to a row.
+type ChangeEvent struct {
+	Table string
+	Op    ChangeOp
+	// Doc is the row after an insert or update, nil after a delete.
+	Doc document.Document
+	// Old is the row before an update or delete, nil before an insert.
+	Old document.Document
+	// CommittedAt is the unix timestamp of the commit.
+	CommittedAt int64
+}
+
+// WatchOptions selects the events of a Watcher.
+type WatchOptions struct {
+	// Tables to watch, all tables if empty.
+	Tables []string
+	// Buffer is the number of events the Watcher holds for its reader, defaults to 256.
+	// A Watcher whose buffer is full is closed with an overflow error rather than
+	// holding back the writers.
+	Buffer int
+}
+
+// Watcher receives the changes committed to the tables it watches, in commit order.
+type Watcher struct {
+	hub    *watchHub
+	tables map[string]bool
+	events chan ChangeEvent
+	done   chan struct{}
+	closed bool
+	err    error
+}
+
+// Events returns the channel of changes, closed when the watcher is.
+func (w *Watcher) Events() <-chan ChangeEvent {
+	return w.events
+}
+
+// Err returns why the events channel was closed, nil when the watcher was closed
+// by its owner. After an overflow the reader missed events and has to resync.
+func (w *Watcher) Err() error {
+	w.hub.mu.Lock()
+	defer w.hub.mu.Unlock()
+	return w.err
+}
+
+// Close stops the watcher and closes its events channel.
+func (w *Watcher) Close() {
+	w.hub.mu.Lock()
+	defer w.hub.mu.Unlock()
+	w.hub.remove(w, nil)
+}
+
+// IsWatchOverflow reports whether err closed a Watcher whose reader fell behind.
+func IsWatchOverflow(err error) bool {
+	var e Error
+	return errors.As(err, &e) && e.Reason == errWatchOverflow
+}
+
+// Watch subscribes to the inserts, updates and deletes committed to the registered tables.
+// The watcher is closed when ctx is done.
+func (c *CoreDB) Watch(ctx context.Context, opts WatchOptions) (*Watcher, error) {
+	w := &Watcher{hub: c.watchers, tables: map[string]bool{}}
+	for _, table := range opts.Tables {
+		if _, ok := c.models[table]; !ok {
+			return nil, Error{Reason: errTableNotRegistered, Err: fmt.Errorf("table %s", table)}
+		}
+		w.tables[table] = true
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = defaultWatchBuffer
+	}
+	w.events, w.done = make(chan ChangeEvent, opts.Buffer), make(chan struct{})
+	c.watchers.add(w)
+	go func() {
+		select {
+		case <-ctx.Done():
+			w.Close()
+		case <-w.done:
+		}
+	}()
+	return w, nil
+}
+
+// watchHub hands the committed changes of a database to its watchers.
+type watchHub struct {
+	mu       sync.Mutex
+	watchers map[*Watcher]bool
+	// commitMu keeps the events in commit order while there are watchers.
+	commitMu sync.Mutex
+}
+
+func newWatchHub() *watchHub {
+	return &watchHub{watchers: map[*Watcher]bool{}}
+}
+
+func (h *watchHub) add(w *Watcher) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.watchers[w] = true
+}
+
+// remove closes the events of a watcher, h.mu must be held.
+func (h *watchHub) remove(w *Watcher, err error) {
+	if w.closed {
+		return
+	}
+	delete(h.watchers, w)
+	w.closed, w.err = true, err
+	close(w.events)
+	close(w.done)
+}
+
+func (h *watchHub) active() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.watchers) > 0
+}
+
+func (h *watchHub) publish(events []ChangeEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for w := range h.watchers {
+		for _, ev := range events {
+			if len(w.tables) > 0 && !w.tables[ev.Table] {
+				continue
+			}
+			select {
+			case w.events <- ev:
+			default:
+				h.remove(w, Error{Reason: errWatchOverflow, Err: fmt.Errorf("buffer of %d events is full", cap(w.events))})
+			}
+			if w.closed {
+				break
+			}
+		}
+	}
+}
+
+// watchEngine wraps the storage engine of genji to record the writes of its transactions
+// and publish them once committed. Nothing is recorded while there is no watcher.
+type watchEngine struct {
+	engine.Engine
+	hub *watchHub
+	mu  sync.Mutex
+	// tables maps store names to table names, empty for the stores of genji itself and of indexes
+	tables map[string]string
+}
+
+func newWatchEngine(ng engine.Engine, hub *watchHub) *watchEngine {
+	return &watchEngine{Engine: ng, hub: hub, tables: map[string]string{}}
+}
+
+func (ng *watchEngine) Begin(ctx context.Context, opts engine.TxOptions) (engine.Transaction, error) {
+	tx, err := ng.Engine.Begin(ctx, opts)
+	if err != nil || !opts.Writable {
+		return tx, err
+	}
+	return &watchTx{Transaction: tx, ng: ng}, nil
+}
+
+// tableOf returns the table stored in the store, loading the table infos of genji when
+// the store is new.
+func (ng *watchEngine) tableOf(tx engine.Transaction, storeName []byte) (string, error) {
+	ng.mu.Lock()
+	defer ng.mu.Unlock()
+	if table, ok := ng.tables[string(storeName)]; ok {
+		return table, nil
+	}
+	st, err := tx.GetStore([]byte(genjiTablesStore))
+	if err != nil {
+		return "", err
+	}
+	it := st.Iterator(engine.IteratorOptions{})
+	defer it.Close()
+	codec := msgpack.NewCodec()
+	for it.Seek(nil); it.Valid(); it.Next() {
+		v, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return "", err
+		}
+		name, err := codec.NewDocument(v).GetByField("store_name")
+		if err != nil {
+			return "", err
+		}
+		ng.tables[string(name.V.([]byte))] = string(it.Item().Key())
+	}
+	if err = it.Err(); err != nil {
+		return "", err
+	}
+	if _, ok := ng.tables[string(storeName)]; !ok {
+		ng.tables[string(storeName)] = ""
+	}
+	return ng.tables[string(storeName)], nil
+}
+
+type watchTx struct {
+	engine.Transaction
+	ng      *watchEngine
+	changes []ChangeEvent
+}
+
+func (tx *watchTx) GetStore(name []byte) (engine.Store, error) {
+	st, err := tx.Transaction.GetStore(name)
+	if err != nil || strings.HasPrefix(string(name), genjiInternalPrefix) || !tx.ng.hub.active() {
+		return st, err
+	}
+	table, err := tx.ng.tableOf(tx.Transaction, name)
+	if err != nil || table == "" {
+		return st, err
+	}
+	return &watchStore{Store: st, tx: tx, table: table}, nil
+}
+
+func (tx *watchTx) Commit() error {
+	if len(tx.changes) == 0 {
+		return tx.Transaction.Commit()
+	}
+	tx.ng.hub.commitMu.Lock()
+	defer tx.ng.hub.commitMu.Unlock()
+	if err := tx.Transaction.Commit(); err != nil {
+		return err
+	}
+	committedAt := sharedConfig.CurrentTimestamp()
+	for i := range tx.changes {
+		tx.changes[i].CommittedAt = committedAt
+	}
+	tx.ng.hub.publish(tx.changes)
+	return nil
+}
+
+// watchStore records the writes to the store of a table.
+type watchStore struct {
+	engine.Store
+	tx    *watchTx
+	table string
+}
+
+// previous returns the document stored under k, nil when there is none.
+func (st *watchStore) previous(k []byte) (document.Document, error) {
+	v, err := st.Store.Get(k)
+	if err == engine.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeWatched(v)
+}
+
+// decodeWatched copies an encoded document out of the transaction.
+func decodeWatched(v []byte) (document.Document, error) {
+	fb := document.NewFieldBuffer()
+	if err := fb.Copy(msgpack.NewCodec().NewDocument(v)); err != nil {
+		return nil, err
+	}
+	return fb, nil
+}
+
+func (st *watchStore) Put(k, v []byte) error {
+	old, err := st.previous(k)
+	if err != nil {
+		return err
+	}
+	if err = st.Store.Put(k, v); err != nil {
+		return err
+	}
+	doc, err := decodeWatched(v)
+	if err != nil {
+		return err
+	}
+	ev := ChangeEvent{Table: st.table, Op: ChangeInsert, Doc: doc, Old: old}
+	if old != nil {
+		ev.Op = ChangeUpdate
+	}
+	st.tx.changes = append(st.tx.changes, ev)
+	return nil
+}
+
+func (st *watchStore) Delete(k []byte) error {
+	old, err := st.previous(k)
+	if err != nil {
+		return err
+	}
+	if err = st.Store.Delete(k); err != nil {
+		return err
+	}
+	if old != nil {
+		st.tx.changes = append(st.tx.changes, ChangeEvent{Table: st.table, Op: ChangeDelete, Old: old})
+	}
+	return nil
+}
+
+func (st *watchStore) Truncate() error {
+	var deleted []ChangeEvent
+	it := st.Store.Iterator(engine.IteratorOptions{})
+	for it.Seek(nil); it.Valid(); it.Next() {
+		v, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			_ = it.Close()
+			return err
+		}
+		old, err := decodeWatched(v)
+		if err != nil {
+			_ = it.Close()
+			return err
+		}
+		deleted = append(deleted, ChangeEvent{Table: st.table, Op: ChangeDelete, Old: old})
+	}
+	if err := it.Err(); err != nil {
+		_ = it.Close()
+		return err
+	}
+	if err := it.Close(); err != nil {
+		return err
+	}
+	if err := st.Store.Truncate(); err != nil {
+		return err
+	}
+	st.tx.changes = append(st.tx.changes, deleted...)
+	return nil
+}
+
+// WatchRequest subscribes to the changes of one or all registered databases.
+type WatchRequest struct {
+	DbName string `json:"dbName"`
+	// Tables to watch, all tables if empty.
+	Tables []string `json:"tables"`
+}
+
+// WatchEvent is a ChangeEvent with its documents encoded as JSON, without their hidden fields.
+type WatchEvent struct {
+	DbName      string `json:"dbName"`
+	Table       string `json:"table"`
+	Op          string `json:"op"`
+	Doc         string `json:"doc,omitempty"`
+	Old         string `json:"old,omitempty"`
+	CommittedAt int64  `json:"committedAt"`
+}
+
+// WatchServer is the stream Watch sends to, it has the methods of a generated gRPC server stream.
+type WatchServer interface {
+	Send(*WatchEvent) error
+	Context() context.Context
+}
+
+// Watch streams the changes of the selected databases until the client goes away.
+// A client which falls behind gets ResourceExhausted and has to resync.
+func (a *AllDBService) Watch(in *WatchRequest, stream WatchServer) error {
+	if in == nil {
+		in = &WatchRequest{}
+	}
+	cdbs, err := a.selectCoreDBs(in.DbName)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	type dbEvent struct {
+		cdb *CoreDB
+		ev  ChangeEvent
+	}
+	events, done := make(chan dbEvent), make(chan error, len(cdbs))
+	watching := 0
+	for _, cdb := range cdbs {
+		var tables []string
+		for _, table := range in.Tables {
+			// across all databases, each one only watches the tables it has
+			if _, ok := cdb.models[table]; ok || in.DbName != "" {
+				tables = append(tables, table)
+			}
+		}
+		if len(in.Tables) > 0 && len(tables) == 0 {
+			continue
+		}
+		watching++
+		w, err := cdb.Watch(ctx, WatchOptions{Tables: tables})
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "unable to watch %s: %v", cdb.config.DbConfig.Name, err)
+		}
+		go func(cdb *CoreDB) {
+			for ev := range w.Events() {
+				select {
+				case events <- dbEvent{cdb: cdb, ev: ev}:
+				case <-ctx.Done():
+				}
+			}
+			done <- w.Err()
+		}(cdb)
+	}
+	if watching == 0 {
+		return status.Errorf(codes.InvalidArgument, "no database has the tables %v", in.Tables)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-done:
+			if IsWatchOverflow(err) {
+				return status.Errorf(codes.ResourceExhausted, "watch fell behind: %v", err)
+			}
+			if err != nil {
+				return status.Errorf(codes.Internal, "watch stopped: %v", err)
+			}
+		case e := <-events:
+			we, err := e.ev.toWatchEvent(e.cdb.config.DbConfig.Name, e.cdb.fieldAccess(e.ev.Table))
+			if err != nil {
+				return status.Errorf(codes.Internal, "unable to encode change of %s: %v", e.ev.Table, err)
+			}
+			if err = stream.Send(we); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// toWatchEvent encodes the event, leaving out the fields access hides.
+func (ev ChangeEvent) toWatchEvent(dbName string, access *FieldAccess) (*WatchEvent, error) {
+	we := &WatchEvent{DbName: dbName, Table: ev.Table, Op: string(ev.Op), CommittedAt: ev.CommittedAt}
+	for _, d := range []struct {
+		doc document.Document
+		out *string
+	}{{ev.Doc, &we.Doc}, {ev.Old, &we.Old}} {
+		if d.doc == nil {
+			continue
+		}
+		visible := document.NewFieldBuffer()
+		err := d.doc.Iterate(func(field string, v document.Value) error {
+			if access == nil || !access.Hidden(field) {
+				visible.Add(field, v)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		b, err := document.MarshalJSON(visible)
+		if err != nil {
+			return nil, err
+		}
+		*d.out = string(b)
+	}
+	return we, nil
+}
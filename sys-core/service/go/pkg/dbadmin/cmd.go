@@ -0,0 +1,441 @@
+// Package dbadmin provides offline administration commands for the coredb databases
+// registered by a service, to be mounted on the service's own cobra root command.
+// The service must be stopped: badger locks its directories, and the loader should open
+// the databases with their cron disabled so that no scheduled job fires meanwhile.
+package dbadmin
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+)
+
+// DBLoader opens the databases to administer, with Options.Cron.Disabled set.
+type DBLoader func() (*coredb.AllDBService, error)
+
+type dbAdminCmd struct {
+	loader     DBLoader
+	dbName     string
+	target     int
+	newKeyFile string
+	version    string
+	file       string
+	tables     []string
+	format     string
+	columns    []string
+	where      map[string]string
+	outDir     string
+	ratio      float64
+	flatten    bool
+	job        string
+	table      string
+	index      string
+}
+
+// NewDbAdminCommand creates the `db` command and its subcommands.
+func NewDbAdminCommand(loader DBLoader) *cobra.Command {
+	d := &dbAdminCmd{loader: loader}
+	rootCmd := &cobra.Command{
+		Use:   "db",
+		Short: "administer the service databases",
+		Long: "administer the service databases offline.\n" +
+			"Stop the server first, the databases cannot be opened while it holds them.",
+	}
+	rootCmd.PersistentFlags().StringVar(&d.dbName, "db", "", "database name, all registered databases if empty")
+	rootCmd.AddCommand(d.migrationsCommand(), d.rekeyCommand(), d.backupsCommand(), d.exportCommand(), d.importCommand(),
+		d.statsCommand(), d.healthCommand(), d.gcCommand(), d.jobsCommand(), d.indexesCommand())
+	return rootCmd
+}
+
+func (d *dbAdminCmd) migrationsCommand() *cobra.Command {
+	migrationsCmd := &cobra.Command{
+		Use:   "migrations",
+		Short: "list, apply and roll back schema migrations",
+	}
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "list registered migrations and their state",
+		RunE: d.runMigration(func(a *coredb.AllDBService, in *coredb.MigrationRequest) (interface{}, error) {
+			return a.ListMigrations(context.Background(), in)
+		}),
+	}
+	upCmd := &cobra.Command{
+		Use:   "up",
+		Short: "apply pending migrations",
+		RunE: d.runMigration(func(a *coredb.AllDBService, in *coredb.MigrationRequest) (interface{}, error) {
+			return a.Migrate(context.Background(), in)
+		}),
+	}
+	upCmd.Flags().IntVar(&d.target, "to", 0, "version to migrate to, latest if zero")
+	downCmd := &cobra.Command{
+		Use:   "down",
+		Short: "roll back applied migrations",
+		RunE: d.runMigration(func(a *coredb.AllDBService, in *coredb.MigrationRequest) (interface{}, error) {
+			return a.Rollback(context.Background(), in)
+		}),
+	}
+	downCmd.Flags().IntVar(&d.target, "to", 0, "version to roll back to, every migration if zero")
+	migrationsCmd.AddCommand(listCmd, upCmd, downCmd)
+	return migrationsCmd
+}
+
+func (d *dbAdminCmd) runMigration(fn func(a *coredb.AllDBService, in *coredb.MigrationRequest) (interface{}, error)) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		a, err := d.loader()
+		if err != nil {
+			return err
+		}
+		res, err := fn(a, &coredb.MigrationRequest{DbName: d.dbName, TargetVersion: d.target})
+		if err != nil {
+			return err
+		}
+		return printResult(cmd, res)
+	}
+}
+
+func (d *dbAdminCmd) rekeyCommand() *cobra.Command {
+	rekeyCmd := &cobra.Command{
+		Use:   "rekey",
+		Short: "re-encrypt a database with a new master key",
+		Long: "re-encrypt a database with a master key derived from the secret in --new-key-file.\n" +
+			"The service must be stopped, and encryptKey in its config replaced by the new secret afterwards.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if d.dbName == "" {
+				return fmt.Errorf("--db has to be specified")
+			}
+			b, err := ioutil.ReadFile(d.newKeyFile)
+			if err != nil {
+				return err
+			}
+			a, err := d.loader()
+			if err != nil {
+				return err
+			}
+			res, err := a.Rekey(context.Background(), &coredb.RekeyRequest{
+				DbName:        d.dbName,
+				NewEncryptKey: strings.TrimSpace(string(b)),
+			})
+			if err != nil {
+				return err
+			}
+			return printResult(cmd, res)
+		},
+	}
+	rekeyCmd.Flags().StringVar(&d.newKeyFile, "new-key-file", "", "file containing the new encryption secret")
+	_ = rekeyCmd.MarkFlagRequired("new-key-file")
+	return rekeyCmd
+}
+
+func (d *dbAdminCmd) backupsCommand() *cobra.Command {
+	backupsCmd := &cobra.Command{
+		Use:   "backups",
+		Short: "list, prune and verify backups",
+	}
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "list backups and whether the retention policy protects them",
+		RunE: d.runBackup(func(a *coredb.AllDBService, in *coredb.BackupRequest) (interface{}, error) {
+			return a.ListBackupStatus(context.Background(), in)
+		}),
+	}
+	pruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "delete the backups not retained by the retention policy",
+		RunE: d.runBackup(func(a *coredb.AllDBService, in *coredb.BackupRequest) (interface{}, error) {
+			return a.PruneBackups(context.Background(), in)
+		}),
+	}
+	verifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "verify backup integrity against the manifests",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			a, err := d.loader()
+			if err != nil {
+				return err
+			}
+			res, err := a.VerifyBackup(context.Background(), &coredb.VerifyBackupRequest{
+				DbName:        d.dbName,
+				BackupVersion: d.version,
+				BackupFile:    d.file,
+			})
+			if err != nil {
+				return err
+			}
+			return printResult(cmd, res)
+		},
+	}
+	verifyCmd.Flags().StringVar(&d.version, "version", "", "backup version to verify")
+	verifyCmd.Flags().StringVar(&d.file, "file", "", "backup file to verify, requires --db")
+	backupsCmd.AddCommand(listCmd, pruneCmd, verifyCmd)
+	return backupsCmd
+}
+
+func (d *dbAdminCmd) runBackup(fn func(a *coredb.AllDBService, in *coredb.BackupRequest) (interface{}, error)) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		a, err := d.loader()
+		if err != nil {
+			return err
+		}
+		res, err := fn(a, &coredb.BackupRequest{DbName: d.dbName})
+		if err != nil {
+			return err
+		}
+		return printResult(cmd, res)
+	}
+}
+
+func (d *dbAdminCmd) statsCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "stats",
+		Short: "show disk usage, table sizes, last backup and last cron results",
+		RunE: d.runBackup(func(a *coredb.AllDBService, in *coredb.BackupRequest) (interface{}, error) {
+			return a.Stats(context.Background(), in)
+		}),
+	}
+}
+
+func (d *dbAdminCmd) healthCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "health",
+		Short: "check that the databases answer queries",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			a, err := d.loader()
+			if err != nil {
+				return err
+			}
+			res, err := a.Health(context.Background(), &coredb.BackupRequest{DbName: d.dbName})
+			if err != nil {
+				return err
+			}
+			if err = printResult(cmd, res); err != nil {
+				return err
+			}
+			if !res.Healthy {
+				return fmt.Errorf("unhealthy database")
+			}
+			return nil
+		},
+	}
+}
+
+func (d *dbAdminCmd) gcCommand() *cobra.Command {
+	gcCmd := &cobra.Command{
+		Use:   "gc",
+		Short: "reclaim value log space",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			a, err := d.loader()
+			if err != nil {
+				return err
+			}
+			res, err := a.GC(context.Background(), &coredb.GCRequest{
+				DbName:       d.dbName,
+				DiscardRatio: d.ratio,
+				Flatten:      d.flatten,
+			})
+			if err != nil {
+				return err
+			}
+			return printResult(cmd, res)
+		},
+	}
+	gcCmd.Flags().Float64Var(&d.ratio, "discard-ratio", 0.5, "share of stale data for a value log file to be rewritten")
+	gcCmd.Flags().BoolVar(&d.flatten, "flatten", false, "compact the LSM tree first")
+	return gcCmd
+}
+
+func (d *dbAdminCmd) jobsCommand() *cobra.Command {
+	jobsCmd := &cobra.Command{
+		Use:   "jobs",
+		Short: "list and run the scheduled jobs",
+		Long: "list and run the scheduled jobs of the databases.\n" +
+			"The runs of a running service are only known to it, and its jobs can only be paused and resumed\n" +
+			"by the service itself, through AllDBService.PauseJob and ResumeJob.",
+	}
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "list the jobs and their schedule",
+		RunE: d.runBackup(func(a *coredb.AllDBService, in *coredb.BackupRequest) (interface{}, error) {
+			return a.ListJobs(context.Background(), in)
+		}),
+	}
+	runCmd := &cobra.Command{
+		Use:   "run",
+		Short: "run a job now",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			a, err := d.loader()
+			if err != nil {
+				return err
+			}
+			res, err := a.RunJob(context.Background(), &coredb.JobRequest{DbName: d.dbName, Job: d.job})
+			if err != nil {
+				return err
+			}
+			if err = printResult(cmd, res); err != nil {
+				return err
+			}
+			if res.Result.Error != "" {
+				return fmt.Errorf("job %s failed", d.job)
+			}
+			return nil
+		},
+	}
+	runCmd.Flags().StringVar(&d.job, "job", "", "job to run, requires --db")
+	_ = runCmd.MarkFlagRequired("job")
+	jobsCmd.AddCommand(listCmd, runCmd)
+	return jobsCmd
+}
+
+func (d *dbAdminCmd) indexesCommand() *cobra.Command {
+	indexesCmd := &cobra.Command{
+		Use:   "indexes",
+		Short: "list, drop and rebuild the secondary indexes",
+	}
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "list the indexes of the databases and the ones their models declare",
+		RunE: d.runIndex(func(a *coredb.AllDBService, in *coredb.IndexRequest) (interface{}, error) {
+			return a.ListIndexes(context.Background(), in)
+		}),
+	}
+	listCmd.Flags().StringVar(&d.table, "table", "", "table of the indexes, all tables if empty")
+	dropCmd := &cobra.Command{
+		Use:   "drop",
+		Short: "drop an index, a declared one comes back on rebuild or schema update",
+		RunE: d.runIndex(func(a *coredb.AllDBService, in *coredb.IndexRequest) (interface{}, error) {
+			return a.DropIndex(context.Background(), in)
+		}),
+	}
+	dropCmd.Flags().StringVar(&d.index, "index", "", "index to drop, requires --db")
+	_ = dropCmd.MarkFlagRequired("index")
+	rebuildCmd := &cobra.Command{
+		Use:   "rebuild",
+		Short: "create the missing declared indexes and rebuild the existing ones",
+		RunE: d.runIndex(func(a *coredb.AllDBService, in *coredb.IndexRequest) (interface{}, error) {
+			return a.RebuildIndexes(context.Background(), in)
+		}),
+	}
+	rebuildCmd.Flags().StringVar(&d.table, "table", "", "table of the indexes, all tables if empty, requires --db")
+	rebuildCmd.Flags().StringVar(&d.index, "index", "", "index to rebuild, all indexes if empty")
+	indexesCmd.AddCommand(listCmd, dropCmd, rebuildCmd)
+	return indexesCmd
+}
+
+func (d *dbAdminCmd) runIndex(fn func(a *coredb.AllDBService, in *coredb.IndexRequest) (interface{}, error)) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		a, err := d.loader()
+		if err != nil {
+			return err
+		}
+		res, err := fn(a, &coredb.IndexRequest{DbName: d.dbName, Table: d.table, Index: d.index})
+		if err != nil {
+			return err
+		}
+		return printResult(cmd, res)
+	}
+}
+
+// findCoreDB opens the databases and returns the one selected with --db.
+func (d *dbAdminCmd) findCoreDB() (*coredb.CoreDB, error) {
+	if d.dbName == "" {
+		return nil, fmt.Errorf("--db has to be specified")
+	}
+	a, err := d.loader()
+	if err != nil {
+		return nil, err
+	}
+	cdb := a.FindCoreDB(d.dbName)
+	if cdb == nil {
+		return nil, fmt.Errorf("unable to find database with name: %s", d.dbName)
+	}
+	return cdb, nil
+}
+
+func (d *dbAdminCmd) exportCommand() *cobra.Command {
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "export tables as JSON Lines or CSV",
+		Long:  "export tables of a database, each into <table>.<format> in --out-dir.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cdb, err := d.findCoreDB()
+			if err != nil {
+				return err
+			}
+			tables := d.tables
+			if len(tables) == 0 {
+				tables = cdb.Tables()
+			}
+			opts := coredb.ExportOptions{Format: d.format, Columns: d.columns, Filter: map[string]interface{}{}}
+			for k, v := range d.where {
+				opts.Filter[k] = v
+			}
+			for _, table := range tables {
+				path := filepath.Join(d.outDir, table+"."+d.format)
+				f, err := os.Create(path)
+				if err != nil {
+					return err
+				}
+				rows, err := cdb.ExportTable(context.Background(), f, table, opts)
+				if closeErr := f.Close(); err == nil {
+					err = closeErr
+				}
+				if err != nil {
+					_ = os.Remove(path)
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "exported %d rows of %s to %s\n", rows, table, path)
+			}
+			return nil
+		},
+	}
+	exportCmd.Flags().StringSliceVar(&d.tables, "table", nil, "tables to export, all registered tables if empty")
+	exportCmd.Flags().StringVar(&d.format, "format", coredb.ExportFormatJSONL, "jsonl or csv")
+	exportCmd.Flags().StringSliceVar(&d.columns, "columns", nil, "columns to export, all model columns but the hidden ones if empty")
+	exportCmd.Flags().StringToStringVar(&d.where, "where", nil, "only export rows whose column equals the value, e.g. --where org_id=123")
+	exportCmd.Flags().StringVar(&d.outDir, "out-dir", ".", "directory to write the exports to")
+	return exportCmd
+}
+
+func (d *dbAdminCmd) importCommand() *cobra.Command {
+	importCmd := &cobra.Command{
+		Use:   "import",
+		Short: "import a JSON Lines or CSV file into a table",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(d.tables) != 1 {
+				return fmt.Errorf("a single --table has to be specified")
+			}
+			cdb, err := d.findCoreDB()
+			if err != nil {
+				return err
+			}
+			f, err := os.Open(d.file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			rows, err := cdb.ImportTable(context.Background(), f, d.tables[0], d.format)
+			fmt.Fprintf(cmd.OutOrStdout(), "imported %d rows into %s\n", rows, d.tables[0])
+			return err
+		},
+	}
+	importCmd.Flags().StringSliceVar(&d.tables, "table", nil, "table to import into")
+	importCmd.Flags().StringVar(&d.format, "format", coredb.ExportFormatJSONL, "jsonl or csv")
+	importCmd.Flags().StringVar(&d.file, "file", "", "file to import")
+	_ = importCmd.MarkFlagRequired("file")
+	return importCmd
+}
+
+func printResult(cmd *cobra.Command, res interface{}) error {
+	b, err := coredb.MarshalPretty(res)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+	return err
+}
@@ -5,6 +5,8 @@ import (
 	commonCfg "go.amplifyedge.org/sys-share-v2/sys-core/service/config/common"
 	"go.amplifyedge.org/sys-share-v2/sys-core/service/fileutils"
 	"gopkg.in/yaml.v2"
+
+	"go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
 )
 
 const (
@@ -12,7 +14,8 @@ const (
 )
 
 type FileServiceConfig struct {
-	DBConfig commonCfg.Config `json:"dbConfig" yaml:"dbConfig"`
+	DBConfig  commonCfg.Config `json:"dbConfig" yaml:"dbConfig"`
+	DbOptions coredb.Options   `json:"dbOptions" yaml:"dbOptions,omitempty"`
 }
 
 func (f *FileServiceConfig) Validate() error {
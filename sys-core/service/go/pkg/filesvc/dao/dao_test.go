@@ -11,7 +11,6 @@ import (
 
 	utilities "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
 	"go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
-	corecfg "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/filesvc"
 	"go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/filesvc/dao"
 )
 
@@ -27,12 +26,7 @@ var (
 func init() {
 	logger := zaplog.NewZapLogger(zaplog.DEBUG, "test", true, "")
 	logger.InitLogger(nil)
-	var csc *corecfg.FileServiceConfig
-	csc, err = corecfg.NewConfig("./testdata/db.yml")
-	if err != nil {
-		logger.Fatalf("error initializing db: %v", err)
-	}
-	testDb, err := coredb.NewCoreDB(logger, &csc.DBConfig, nil)
+	testDb, err := coredb.NewTestDB(logger)
 	if err != nil {
 		logger.Fatalf("error creating CoreDB: %v", err)
 	}
@@ -71,5 +65,5 @@ func testUpsertFile(t *testing.T) {
 	require.NoError(t, err)
 	t.Logf("Binary size: %d", binary.Size(avatarUpdated.Binary))
 	require.Equal(t, avatarUpdated.Id, avatarFile.Id)
-	ioutil.WriteFile("./testdata/updatedAvatar.jpg", avatarUpdated.Binary, 0644)
+	require.Equal(t, f, avatarUpdated.Binary)
 }
@@ -14,7 +14,7 @@ type SysFileService struct {
 }
 
 func NewSysFileService(cfg *FileServiceConfig, l logging.Logger) (*SysFileService, error) {
-	db, err := coredb.NewCoreDB(l, &cfg.DBConfig, nil)
+	db, err := coredb.NewCoreDBWithOptions(l, &cfg.DBConfig, nil, cfg.DbOptions)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,315 @@
+// Package search is the full-text index of sys-core: an embedded inverted index, kept in memory
+// and in sync with coredb tables by a Syncer, ranking its hits with BM25.
+//
+// A query matches the documents holding every one of its terms, a term matching the words
+// it is the prefix of when it is the last one of the query, as typed in a search box,
+// and the words a typo or two away from it.
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/btree"
+)
+
+const (
+	// BM25 parameters, the usual ones.
+	bm25K1 = 1.2
+	bm25B  = 0.75
+
+	defaultLimit = 20
+	// maxExpansions bounds the words a prefix or a typo expands to.
+	maxExpansions = 64
+	// the weight of the words matched by prefix and by typo, relative to an exact match
+	prefixWeight = 0.8
+	typoWeight   = 0.5
+	btreeDegree  = 16
+)
+
+// Field is a text field of a document, Boost weighs its matches, one when zero.
+type Field struct {
+	Name  string
+	Text  string
+	Boost float64
+}
+
+// Document is a row of a table as the index sees it. Meta is kept along and returned with
+// the hits, for the callers to filter them without a lookup.
+type Document struct {
+	Type   string
+	ID     string
+	Fields []Field
+	Meta   map[string]string
+}
+
+// Hit is a document matching a query.
+type Hit struct {
+	Type  string            `json:"type"`
+	ID    string            `json:"id"`
+	Score float64           `json:"score"`
+	Meta  map[string]string `json:"meta,omitempty"`
+}
+
+// Query searches the index.
+type Query struct {
+	Text string
+	// Types restricts the hits to these document types, all types if empty.
+	Types []string
+	// Filter drops the hits it returns false for, before the limit applies.
+	Filter func(h *Hit) bool
+	// Limit is the number of hits returned, 20 by default.
+	Limit int
+}
+
+type docKey struct {
+	typ, id string
+}
+
+type indexedDoc struct {
+	doc Document
+	// lens holds the number of words of each field
+	lens map[string]int
+	// freqs holds the occurrences of each word, by field
+	freqs map[string]map[string]int
+}
+
+type word string
+
+func (w word) Less(than btree.Item) bool {
+	return w < than.(word)
+}
+
+// Index is an in memory inverted index, safe for concurrent use.
+type Index struct {
+	mu   sync.RWMutex
+	docs map[docKey]*indexedDoc
+	// postings maps each word to the documents holding it
+	postings map[string]map[docKey]bool
+	// words orders the words of postings, for the prefix lookups
+	words *btree.BTree
+	// fieldWords sums the lengths of each field, over every document
+	fieldWords map[string]int
+}
+
+// NewIndex creates an empty index.
+func NewIndex() *Index {
+	return &Index{
+		docs:       map[docKey]*indexedDoc{},
+		postings:   map[string]map[docKey]bool{},
+		words:      btree.New(btreeDegree),
+		fieldWords: map[string]int{},
+	}
+}
+
+// Put adds a document to the index, replacing the one of the same type and id.
+func (ix *Index) Put(doc Document) {
+	d := &indexedDoc{doc: doc, lens: map[string]int{}, freqs: map[string]map[string]int{}}
+	for _, f := range doc.Fields {
+		for _, w := range tokenize(f.Text) {
+			if d.freqs[w] == nil {
+				d.freqs[w] = map[string]int{}
+			}
+			d.freqs[w][f.Name]++
+			d.lens[f.Name]++
+		}
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	key := docKey{doc.Type, doc.ID}
+	ix.remove(key)
+	ix.docs[key] = d
+	for w := range d.freqs {
+		if ix.postings[w] == nil {
+			ix.postings[w] = map[docKey]bool{}
+			ix.words.ReplaceOrInsert(word(w))
+		}
+		ix.postings[w][key] = true
+	}
+	for name, n := range d.lens {
+		ix.fieldWords[name] += n
+	}
+}
+
+// Delete removes a document from the index, if there.
+func (ix *Index) Delete(typ, id string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.remove(docKey{typ, id})
+}
+
+// Reset removes the documents of the types, or every document without types.
+func (ix *Index) Reset(types ...string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if len(types) == 0 {
+		ix.docs, ix.postings, ix.fieldWords = map[docKey]*indexedDoc{}, map[string]map[docKey]bool{}, map[string]int{}
+		ix.words = btree.New(btreeDegree)
+		return
+	}
+	for key := range ix.docs {
+		for _, typ := range types {
+			if key.typ == typ {
+				ix.remove(key)
+			}
+		}
+	}
+}
+
+// remove drops a document, ix.mu must be held.
+func (ix *Index) remove(key docKey) {
+	d, ok := ix.docs[key]
+	if !ok {
+		return
+	}
+	delete(ix.docs, key)
+	for w := range d.freqs {
+		delete(ix.postings[w], key)
+		if len(ix.postings[w]) == 0 {
+			delete(ix.postings, w)
+			ix.words.Delete(word(w))
+		}
+	}
+	for name, n := range d.lens {
+		ix.fieldWords[name] -= n
+	}
+}
+
+// Len returns the number of documents of the index.
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.docs)
+}
+
+// Search returns the documents matching every term of the query, best first.
+func (ix *Index) Search(q Query) []*Hit {
+	terms := tokenize(q.Text)
+	if len(terms) == 0 {
+		return nil
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	types := map[string]bool{}
+	for _, typ := range q.Types {
+		types[typ] = true
+	}
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	// each term adds the score of its best matching word to the documents, a document
+	// missing a term is out
+	scores := map[docKey]float64{}
+	for i, term := range terms {
+		termScores := map[docKey]float64{}
+		for w, weight := range ix.expand(term, i == len(terms)-1) {
+			for key := range ix.postings[w] {
+				if len(types) > 0 && !types[key.typ] {
+					continue
+				}
+				if i > 0 {
+					if _, ok := scores[key]; !ok {
+						continue
+					}
+				}
+				if s := weight * ix.bm25(w, key); s > termScores[key] {
+					termScores[key] = s
+				}
+			}
+		}
+		for key, s := range termScores {
+			termScores[key] = scores[key] + s
+		}
+		scores = termScores
+		if len(scores) == 0 {
+			return nil
+		}
+	}
+
+	hits := make([]*Hit, 0, len(scores))
+	for key, s := range scores {
+		h := &Hit{Type: key.typ, ID: key.id, Score: s, Meta: ix.docs[key].doc.Meta}
+		if q.Filter == nil || q.Filter(h) {
+			hits = append(hits, h)
+		}
+	}
+	sort.Slice(hits, func(i, k int) bool {
+		if hits[i].Score != hits[k].Score {
+			return hits[i].Score > hits[k].Score
+		}
+		if hits[i].Type != hits[k].Type {
+			return hits[i].Type < hits[k].Type
+		}
+		return hits[i].ID < hits[k].ID
+	})
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// expand returns the words of the index a term matches, with the weight of the match.
+func (ix *Index) expand(term string, prefix bool) map[string]float64 {
+	words := map[string]float64{}
+	if _, ok := ix.postings[term]; ok {
+		words[term] = 1
+	}
+	if prefix {
+		n := 0
+		ix.words.AscendGreaterOrEqual(word(term), func(i btree.Item) bool {
+			w := string(i.(word))
+			if !strings.HasPrefix(w, term) || n == maxExpansions {
+				return false
+			}
+			if w != term {
+				words[w] = prefixWeight
+				n++
+			}
+			return true
+		})
+	}
+	maxDist := typoDistance(term)
+	if maxDist == 0 {
+		return words
+	}
+	n := 0
+	ix.words.Ascend(func(i btree.Item) bool {
+		w := string(i.(word))
+		if _, ok := words[w]; ok {
+			return true
+		}
+		if d := editDistance(term, w, maxDist); d <= maxDist {
+			words[w] = typoWeight / float64(d)
+			n++
+		}
+		return n < maxExpansions
+	})
+	return words
+}
+
+// bm25 scores a word of a document, summing its fields.
+func (ix *Index) bm25(w string, key docKey) float64 {
+	n := float64(len(ix.docs))
+	df := float64(len(ix.postings[w]))
+	idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+	d := ix.docs[key]
+	var score float64
+	for _, f := range d.doc.Fields {
+		tf := float64(d.freqs[w][f.Name])
+		if tf == 0 {
+			continue
+		}
+		boost := f.Boost
+		if boost == 0 {
+			boost = 1
+		}
+		avg := float64(ix.fieldWords[f.Name]) / n
+		norm := 1 - bm25B + bm25B*float64(d.lens[f.Name])/avg
+		score += boost * idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+	}
+	return score
+}
@@ -0,0 +1,148 @@
+package search
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/genjidb/genji/document"
+
+	log "go.amplifyedge.org/sys-share-v2/sys-core/service/logging"
+	"go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+)
+
+// watchBuffer is the number of changes the syncer may lag behind before it reloads the tables.
+const watchBuffer = 4096
+
+// Source maps the rows of a table to the documents of the index.
+type Source struct {
+	Table string
+	Type  string
+	// Document maps a row, it returns false for the rows left out of the index, as the soft deleted
+	// ones. It sets the ID of the document in any case, the deleted rows are removed by ID.
+	Document func(d document.Document) (Document, bool, error)
+}
+
+// Syncer keeps an index in sync with coredb tables: it loads their rows, then follows the changes
+// committed to them through coredb.Watch, whichever code path writes them.
+// The index is rebuilt from the tables on start, and again whenever the syncer falls behind.
+type Syncer struct {
+	cdb     *coredb.CoreDB
+	ix      *Index
+	logger  log.Logger
+	sources map[string]Source
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// NewSyncer creates a syncer of the sources into ix, Start starts it.
+func NewSyncer(cdb *coredb.CoreDB, ix *Index, l log.Logger, sources ...Source) *Syncer {
+	s := &Syncer{cdb: cdb, ix: ix, logger: l, sources: map[string]Source{}}
+	for _, src := range sources {
+		s.sources[src.Table] = src
+	}
+	return s
+}
+
+// Start loads the tables into the index and follows their changes until Close.
+func (s *Syncer) Start(ctx context.Context) error {
+	ctx, s.cancel = context.WithCancel(ctx)
+	w, err := s.load(ctx)
+	if err != nil {
+		s.cancel()
+		return err
+	}
+	s.done = make(chan struct{})
+	go s.follow(ctx, w)
+	return nil
+}
+
+// Close stops following the changes, the index keeps its documents.
+func (s *Syncer) Close() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	if s.done != nil {
+		<-s.done
+	}
+}
+
+// load watches the tables, then puts their rows in the index. The changes committed meanwhile
+// wait in the watcher, applied once loaded they leave the index as the tables are.
+func (s *Syncer) load(ctx context.Context) (*coredb.Watcher, error) {
+	var tables, types []string
+	for table, src := range s.sources {
+		tables, types = append(tables, table), append(types, src.Type)
+	}
+	w, err := s.cdb.Watch(ctx, coredb.WatchOptions{Tables: tables, Buffer: watchBuffer})
+	if err != nil {
+		return nil, err
+	}
+	s.ix.Reset(types...)
+	for table, src := range s.sources {
+		res, err := s.cdb.QueryContext(ctx, "SELECT * FROM "+table)
+		if err != nil {
+			w.Close()
+			return nil, err
+		}
+		err = res.Iterate(func(d document.Document) error {
+			return s.put(src, d)
+		})
+		if closeErr := res.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			w.Close()
+			return nil, fmt.Errorf("unable to index %s: %w", table, err)
+		}
+	}
+	return w, nil
+}
+
+func (s *Syncer) put(src Source, d document.Document) error {
+	doc, ok, err := src.Document(d)
+	if err != nil {
+		return err
+	}
+	doc.Type = src.Type
+	if !ok {
+		s.ix.Delete(src.Type, doc.ID)
+		return nil
+	}
+	s.ix.Put(doc)
+	return nil
+}
+
+func (s *Syncer) apply(ev coredb.ChangeEvent) error {
+	src := s.sources[ev.Table]
+	if ev.Op != coredb.ChangeDelete {
+		return s.put(src, ev.Doc)
+	}
+	doc, _, err := src.Document(ev.Old)
+	if err != nil {
+		return err
+	}
+	s.ix.Delete(src.Type, doc.ID)
+	return nil
+}
+
+// follow applies the changes, reloading the tables after an overflow of the watcher.
+func (s *Syncer) follow(ctx context.Context, w *coredb.Watcher) {
+	defer close(s.done)
+	for {
+		for ev := range w.Events() {
+			if err := s.apply(ev); err != nil {
+				s.logger.Errorf("search: unable to index a change of %s: %v", ev.Table, err)
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		s.logger.Warnf("search: resyncing the index after: %v", w.Err())
+		var err error
+		if w, err = s.load(ctx); err != nil {
+			s.logger.Errorf("search: unable to resync the index, it stops following the changes: %v", err)
+			return
+		}
+	}
+}
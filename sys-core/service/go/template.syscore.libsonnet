@@ -6,6 +6,9 @@ local dbcfg = import "vendor/github.com/amplify-edge/sys-share/sys-core/service/
       name: "core.db",
     },
     CoreCron:: dbcfg.Cron,
+    // no backup is pruned unless rules are set, e.g. keepLast: 7, keepDaily: 7, keepWeekly: 4,
+    // the backups taken before the backup chain only with pruneLegacy: true
+    CoreRetention:: {},
     CoreMail:: {
       senderName: "gutterbacon",
       senderMail: "gutterbacon@example.com",
@@ -28,4 +31,7 @@ local dbcfg = import "vendor/github.com/amplify-edge/sys-share/sys-core/service/
         cron: self.CoreCron,
     },
     mailConfig: self.CoreMail,
+    dbOptions: {
+      retention: self.CoreRetention,
+    },
 }
\ No newline at end of file
@@ -0,0 +1,59 @@
+package db_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+)
+
+type accessModel struct {
+	ID       string `genji:"id" coredb:"primary,sortable,filterable"`
+	Email    string `genji:"email" coredb:"filterable"`
+	Password string `genji:"password" coredb:"hidden"`
+	Profile  struct {
+		City string `genji:"city"`
+	} `genji:"profile" coredb:"filterable"`
+	Notes string `genji:"notes"`
+}
+
+func testFieldAccess(t *testing.T) {
+	fa := coresvc.NewFieldAccess(&accessModel{})
+	assert.NoError(t, fa.CheckSort("id"))
+	for _, column := range []string{"email", "password", "notes", "unknown"} {
+		assert.True(t, coresvc.IsInvalidQuery(fa.CheckSort(column)), column)
+	}
+	assert.NoError(t, fa.CheckFilter(&coresvc.Filter{And: []*coresvc.Filter{
+		{Field: "email", Op: coresvc.FilterLike, Value: "example.com"},
+		{Field: "profile.city", Op: coresvc.FilterEq, Value: "Berlin"},
+	}}))
+	for _, field := range []string{"password", "notes", "unknown"} {
+		err := fa.CheckFilter(&coresvc.Filter{Or: []*coresvc.Filter{
+			{Field: "id", Op: coresvc.FilterEq, Value: "1"},
+			{Field: field, Op: coresvc.FilterEq, Value: "1"},
+		}})
+		assert.True(t, coresvc.IsInvalidQuery(err), field)
+	}
+
+	// a model without sortable or filterable fields leaves its known columns open
+	cdb := newRepoItemsDB(t)
+	ctx := context.Background()
+	items, err := coresvc.NewRepository[repoItem](cdb, repoItemsTable, coresvc.RepositoryOptions{})
+	require.NoError(t, err)
+	_, _, err = items.List(ctx, coresvc.ListOptions{
+		PageRequest: coresvc.PageRequest{OrderBy: "name"},
+		Filter:      &coresvc.Filter{Field: "tags", Op: coresvc.FilterIn, Value: []interface{}{"tag"}},
+	})
+	assert.NoError(t, err)
+	for _, orderBy := range []string{"missing", "name DESC", "name; DROP TABLE repo_items"} {
+		_, _, err = items.List(ctx, coresvc.ListOptions{PageRequest: coresvc.PageRequest{OrderBy: orderBy}})
+		assert.True(t, coresvc.IsInvalidQuery(err), orderBy)
+	}
+	_, _, err = items.List(ctx, coresvc.ListOptions{
+		Filter: &coresvc.Filter{Field: "missing", Op: coresvc.FilterEq, Value: 1},
+	})
+	assert.True(t, coresvc.IsInvalidQuery(err))
+}
@@ -16,4 +16,30 @@ func TestDBService(t *testing.T) {
 	t.Run("Test Service Creation", testCoreDBService)
 	t.Run("Test Table Creation", testTableCreation)
 	t.Run("Test Table Insertion", testTableInsert)
+	t.Run("Test Migrations", testMigrations)
+	t.Run("Test Key Derivation", testDeriveKey)
+	t.Run("Test Rekey", testRekey)
+	t.Run("Test Incremental Backup", testIncrementalBackup)
+	t.Run("Test Backup Retention", testBackupRetention)
+	t.Run("Test Backup Verification", testBackupVerification)
+	t.Run("Test Restore Replaces Data", testRestoreReplacesData)
+	t.Run("Test Encrypted Backup", testEncryptedBackup)
+	t.Run("Test Export Import", testExportImport)
+	t.Run("Test Stats And GC", testStatsAndGC)
+	t.Run("Test Transactions", testTransactions)
+	t.Run("Test Query Context", testQueryContext)
+	t.Run("Test Repository", testRepository)
+	t.Run("Test Pagination", testPagination)
+	t.Run("Test Filter", testFilter)
+	t.Run("Test Field Access", testFieldAccess)
+	t.Run("Test Watch", testWatch)
+	t.Run("Test TTL", testTTL)
+	t.Run("Test Storage Engines", testStorageEngines)
+	t.Run("Test Test DB", testTestDB)
+	t.Run("Test Jobs", testJobs)
+	t.Run("Test Cron Locks", testCronLocks)
+	t.Run("Test Indexes", testIndexes)
+	t.Run("Test Search Index", testSearchIndex)
+	t.Run("Test Search Sync", testSearchSync)
+	t.Run("Test S3 Backup Target", testS3BackupTarget)
 }
@@ -0,0 +1,55 @@
+package db_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	sharedConfig "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
+	coreRpc "go.amplifyedge.org/sys-share-v2/sys-core/service/go/rpc/v2"
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+)
+
+// testS3BackupTarget runs against a MinIO (or any S3 compatible store) given by
+// COREDB_TEST_S3_ENDPOINT, COREDB_TEST_S3_BUCKET, COREDB_TEST_S3_ACCESS_KEY and COREDB_TEST_S3_SECRET_KEY.
+func testS3BackupTarget(t *testing.T) {
+	endpoint := os.Getenv("COREDB_TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("COREDB_TEST_S3_ENDPOINT not set")
+	}
+	dir, err := os.MkdirTemp("", "coredb-s3")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	opts := coresvc.Options{Target: coresvc.BackupTargetOptions{
+		Type: coresvc.BackupTargetS3,
+		S3: coresvc.S3Options{
+			Endpoint:  endpoint,
+			Bucket:    os.Getenv("COREDB_TEST_S3_BUCKET"),
+			Prefix:    "coredb-test-" + sharedConfig.NewID(),
+			AccessKey: os.Getenv("COREDB_TEST_S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("COREDB_TEST_S3_SECRET_KEY"),
+		},
+	}}
+	cdb, all := newBackupTestDB(t, filepath.Join(dir, "db"), filepath.Join(dir, "unused"), opts)
+	id := sharedConfig.NewID()
+	require.NoError(t, cdb.Exec("INSERT INTO "+tableName+"(id, foreign_id, blah) VALUES(?, ?, ?)", id, sharedConfig.NewID(), "blah"))
+	backup, err := all.Backup(context.Background(), &emptypb.Empty{})
+	require.NoError(t, err)
+	assert.Contains(t, backup.BackupFiles[0].BackupFile, "s3://")
+
+	listed, err := all.ListBackup(context.Background(), &coreRpc.ListBackupRequest{BackupVersion: backup.Version})
+	require.NoError(t, err)
+	require.Len(t, listed.BackupVersions, 1)
+
+	require.NoError(t, cdb.Exec("DELETE FROM "+tableName+" WHERE id = ?", id))
+	_, err = all.Restore(context.Background(), &coreRpc.RestoreAllRequest{RestoreVersion: backup.Version})
+	require.NoError(t, err)
+	_, err = cdb.QueryOne("SELECT id FROM "+tableName+" WHERE id = ?", id)
+	assert.NoError(t, err)
+}
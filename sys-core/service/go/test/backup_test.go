@@ -0,0 +1,241 @@
+package db_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.amplifyedge.org/sys-share-v2/sys-core/service/logging/zaplog"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	sharedConfig "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
+	coreRpc "go.amplifyedge.org/sys-share-v2/sys-core/service/go/rpc/v2"
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+)
+
+func newBackupTestDB(t *testing.T, dbDir, backupDir string, opts coresvc.Options) (*coresvc.CoreDB, *coresvc.AllDBService) {
+	cfg := sysCoreCfg.SysCoreConfig
+	// underscores in the name must not confuse the backup file name parsing
+	cfg.DbConfig.Name = "backup_test.db"
+	cfg.DbConfig.DbDir = dbDir
+	cfg.CronConfig.BackupDir = backupDir
+	require.NoError(t, os.MkdirAll(dbDir, 0755))
+	require.NoError(t, os.MkdirAll(cfg.CronConfig.BackupDir, 0755))
+	logger := zaplog.NewZapLogger(zaplog.DEBUG, "sys-core-test", true, "")
+	cdb, err := coresvc.NewCoreDBWithOptions(logger, &cfg, nil, opts)
+	require.NoError(t, err)
+	require.NoError(t, cdb.RegisterModels(map[string]coresvc.DbModel{tableName: &SomeData{}}))
+	require.NoError(t, cdb.MakeSchema())
+	all := coresvc.NewAllDBService()
+	all.RegisterCoreDB(cdb)
+	return cdb, all
+}
+
+func testIncrementalBackup(t *testing.T) {
+	dir, err := os.MkdirTemp("", "coredb-backup")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	backupDir := filepath.Join(dir, "backups")
+	opts := coresvc.Options{Backup: coresvc.BackupOptions{Incremental: true, FullEvery: 2}}
+	src, srcAll := newBackupTestDB(t, filepath.Join(dir, "src"), backupDir, opts)
+	insert := func(id string) {
+		require.NoError(t, src.Exec("INSERT INTO "+tableName+"(id, foreign_id, blah) VALUES(?, ?, ?)", id, sharedConfig.NewID(), "blah"))
+	}
+	ids := []string{sharedConfig.NewID(), sharedConfig.NewID(), sharedConfig.NewID()}
+	var versions []string
+	for _, id := range ids {
+		insert(id)
+		res, err := srcAll.Backup(context.Background(), &emptypb.Empty{})
+		require.NoError(t, err)
+		versions = append(versions, res.Version)
+	}
+	chain, err := src.BackupChain()
+	require.NoError(t, err)
+	require.Len(t, chain, 3)
+	assert.False(t, chain[0].Incremental)
+	assert.True(t, chain[1].Incremental)
+	assert.Equal(t, chain[0].File, chain[2].Base)
+	assert.Greater(t, chain[2].Since, chain[1].Since)
+
+	// restoring the second incremental replays the full backup and both incrementals
+	dst, dstAll := newBackupTestDB(t, filepath.Join(dir, "dst"), backupDir, opts)
+	_, err = dstAll.Restore(context.Background(), &coreRpc.RestoreAllRequest{RestoreVersion: versions[2]})
+	require.NoError(t, err)
+	for _, id := range ids {
+		doc, err := dst.QueryOne("SELECT id FROM "+tableName+" WHERE id = ?", id)
+		require.NoError(t, err)
+		assert.NotNil(t, doc)
+	}
+}
+
+func testBackupRetention(t *testing.T) {
+	dir, err := os.MkdirTemp("", "coredb-retention")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cdb, all := newBackupTestDB(t, filepath.Join(dir, "db"), filepath.Join(dir, "backups"), coresvc.Options{
+		Backup:    coresvc.BackupOptions{Incremental: true, FullEvery: 1},
+		Retention: coresvc.RetentionOptions{KeepLast: 1},
+	})
+	// a backup taken before the chain, it is kept since pruning legacy backups is not enabled
+	legacy := filepath.Join(dir, "backups", "ver-0.0.1_backup_test.db_202101010000.bak")
+	require.NoError(t, os.WriteFile(legacy, []byte("legacy"), 0600))
+	statuses, err := cdb.ListBackupStatus()
+	require.NoError(t, err)
+	require.Len(t, statuses, 1)
+	assert.True(t, statuses[0].Legacy)
+	assert.True(t, statuses[0].Protected)
+	for i := 0; i < 4; i++ {
+		_, err = all.Backup(context.Background(), &emptypb.Empty{})
+		require.NoError(t, err)
+	}
+	// the first chain got pruned, the newest backup is an incremental
+	// and its full base is protected along with it
+	_, err = os.Stat(legacy)
+	assert.NoError(t, err)
+	statuses, err = cdb.ListBackupStatus()
+	require.NoError(t, err)
+	require.Len(t, statuses, 3)
+	assert.True(t, statuses[0].Legacy)
+	assert.False(t, statuses[1].Incremental)
+	assert.True(t, statuses[2].Incremental)
+	for _, s := range statuses {
+		assert.True(t, s.Protected)
+	}
+	res, err := all.PruneBackups(context.Background(), &coresvc.BackupRequest{})
+	require.NoError(t, err)
+	assert.Empty(t, res.Results[0].Deleted)
+
+	listed, err := all.ListBackup(context.Background(), &coreRpc.ListBackupRequest{})
+	require.NoError(t, err)
+	var files []string
+	for _, v := range listed.BackupVersions {
+		for _, f := range v.BackupFiles {
+			files = append(files, f.BackupFile)
+		}
+	}
+	assert.ElementsMatch(t, []string{filepath.Base(legacy), statuses[1].File, statuses[2].File}, files)
+
+	// with PruneLegacy the scheduled legacy backups are dated from their version,
+	// the ones without a known creation time are still kept
+	pruneDir := filepath.Join(dir, "prune-backups")
+	_, pruneAll := newBackupTestDB(t, filepath.Join(dir, "prune-db"), pruneDir, coresvc.Options{
+		Retention: coresvc.RetentionOptions{KeepLast: 1, KeepDaily: 3, PruneLegacy: true},
+	})
+	now := time.Now().UTC()
+	oldScheduled := fmt.Sprintf("ver-independent-%d_backup_test.db_202101010000.bak", now.Add(-30*24*time.Hour).Unix())
+	recentScheduled := fmt.Sprintf("ver-independent-%d_backup_test.db_202101020000.bak", now.Add(-36*time.Hour).Unix())
+	for _, f := range []string{oldScheduled, recentScheduled, filepath.Base(legacy)} {
+		require.NoError(t, os.WriteFile(filepath.Join(pruneDir, f), []byte("legacy"), 0600))
+	}
+	_, err = pruneAll.Backup(context.Background(), &emptypb.Empty{})
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(pruneDir, oldScheduled))
+	assert.True(t, os.IsNotExist(err))
+	for _, f := range []string{recentScheduled, filepath.Base(legacy)} {
+		_, err = os.Stat(filepath.Join(pruneDir, f))
+		assert.NoError(t, err)
+	}
+}
+
+func testBackupVerification(t *testing.T) {
+	dir, err := os.MkdirTemp("", "coredb-verify")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cdb, all := newBackupTestDB(t, filepath.Join(dir, "db"), filepath.Join(dir, "backups"), coresvc.Options{})
+	require.NoError(t, cdb.Exec("INSERT INTO "+tableName+"(id, foreign_id, blah) VALUES(?, ?, ?)", sharedConfig.NewID(), sharedConfig.NewID(), "blah"))
+	backup, err := all.Backup(context.Background(), &emptypb.Empty{})
+	require.NoError(t, err)
+
+	listed, err := all.ListBackup(context.Background(), &coreRpc.ListBackupRequest{BackupVersion: backup.Version})
+	require.NoError(t, err)
+	require.Len(t, listed.BackupVersions, 1)
+	assert.Equal(t, backup.Version, listed.BackupVersions[0].Version)
+
+	res, err := all.VerifyBackup(context.Background(), &coresvc.VerifyBackupRequest{BackupVersion: backup.Version})
+	require.NoError(t, err)
+	assert.True(t, res.Results[0].Valid)
+
+	// corrupt the backup, it has to be rejected before anything is restored
+	f, err := os.OpenFile(backup.BackupFiles[0].BackupFile, os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("garbage"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	res, err = all.VerifyBackup(context.Background(), &coresvc.VerifyBackupRequest{BackupVersion: backup.Version})
+	require.NoError(t, err)
+	assert.False(t, res.Results[0].Valid)
+	assert.NotEmpty(t, res.Results[0].Files[0].Error)
+	_, err = all.Restore(context.Background(), &coreRpc.RestoreAllRequest{RestoreVersion: backup.Version})
+	assert.Error(t, err)
+}
+
+func testRestoreReplacesData(t *testing.T) {
+	dir, err := os.MkdirTemp("", "coredb-restore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cdb, all := newBackupTestDB(t, filepath.Join(dir, "db"), filepath.Join(dir, "backups"), coresvc.Options{})
+	kept, dropped := sharedConfig.NewID(), sharedConfig.NewID()
+	require.NoError(t, cdb.Exec("INSERT INTO "+tableName+"(id, foreign_id, blah) VALUES(?, ?, ?)", kept, sharedConfig.NewID(), "blah"))
+	backup, err := all.Backup(context.Background(), &emptypb.Empty{})
+	require.NoError(t, err)
+	require.NoError(t, cdb.Exec("INSERT INTO "+tableName+"(id, foreign_id, blah) VALUES(?, ?, ?)", dropped, sharedConfig.NewID(), "blah"))
+
+	_, err = all.Restore(context.Background(), &coreRpc.RestoreAllRequest{RestoreVersion: backup.Version})
+	require.NoError(t, err)
+	_, err = cdb.QueryOne("SELECT id FROM "+tableName+" WHERE id = ?", kept)
+	assert.NoError(t, err)
+	_, err = cdb.QueryOne("SELECT id FROM "+tableName+" WHERE id = ?", dropped)
+	assert.Error(t, err)
+
+	rollbacks, err := filepath.Glob(filepath.Join(dir, "db", "*.rollback-*"))
+	require.NoError(t, err)
+	assert.Len(t, rollbacks, 1)
+}
+
+func testEncryptedBackup(t *testing.T) {
+	dir, err := os.MkdirTemp("", "coredb-encrypted")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	backupDir := filepath.Join(dir, "backups")
+	opts := coresvc.Options{Backup: coresvc.BackupOptions{Compression: coresvc.BackupCompressionZstd, EncryptKey: "backup-secret"}}
+	src, srcAll := newBackupTestDB(t, filepath.Join(dir, "src"), backupDir, opts)
+	id := sharedConfig.NewID()
+	require.NoError(t, src.Exec("INSERT INTO "+tableName+"(id, foreign_id, blah) VALUES(?, ?, ?)", id, sharedConfig.NewID(), "recognisable plaintext"))
+	backup, err := srcAll.Backup(context.Background(), &emptypb.Empty{})
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(backup.BackupFiles[0].BackupFile)
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "recognisable plaintext")
+	res, err := srcAll.VerifyBackup(context.Background(), &coresvc.VerifyBackupRequest{BackupVersion: backup.Version})
+	require.NoError(t, err)
+	assert.True(t, res.Results[0].Valid)
+
+	// restoring requires the backup key, not the database key
+	_, noKeyAll := newBackupTestDB(t, filepath.Join(dir, "nokey"), backupDir, coresvc.Options{})
+	_, err = noKeyAll.Restore(context.Background(), &coreRpc.RestoreAllRequest{RestoreVersion: backup.Version})
+	assert.Error(t, err)
+	wrongKey := opts
+	wrongKey.Backup.EncryptKey = "wrong-secret"
+	_, wrongKeyAll := newBackupTestDB(t, filepath.Join(dir, "wrongkey"), backupDir, wrongKey)
+	_, err = wrongKeyAll.Restore(context.Background(), &coreRpc.RestoreAllRequest{RestoreVersion: backup.Version})
+	assert.Error(t, err)
+
+	dst, dstAll := newBackupTestDB(t, filepath.Join(dir, "dst"), backupDir, opts)
+	_, err = dstAll.Restore(context.Background(), &coreRpc.RestoreAllRequest{RestoreVersion: backup.Version})
+	require.NoError(t, err)
+	doc, err := dst.QueryOne("SELECT id FROM "+tableName+" WHERE id = ?", id)
+	require.NoError(t, err)
+	assert.NotNil(t, doc)
+}
@@ -0,0 +1,107 @@
+package db_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.amplifyedge.org/sys-share-v2/sys-core/service/logging/zaplog"
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+)
+
+func testCronLocks(t *testing.T) {
+	dir, err := os.MkdirTemp("", "coredb-cronlock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	t.Run("lease", func(t *testing.T) {
+		opts := coresvc.Options{Engine: coresvc.EngineOptions{Kind: coresvc.EngineSQLite}}
+		testCronReplicas(t, func() *coresvc.CoreDB {
+			cdb, _ := newBackupTestDB(t, filepath.Join(dir, "lease"), filepath.Join(dir, "backups"), opts)
+			return cdb
+		})
+	})
+	t.Run("file", func(t *testing.T) {
+		opts := coresvc.Options{
+			Engine: coresvc.EngineOptions{Kind: coresvc.EngineMemory},
+			Cron:   coresvc.CronOptions{Lock: coresvc.CronLockFile},
+		}
+		testCronReplicas(t, func() *coresvc.CoreDB {
+			cdb, _ := newBackupTestDB(t, filepath.Join(dir, "file"), filepath.Join(dir, "backups"), opts)
+			return cdb
+		})
+	})
+	t.Run("invalid", func(t *testing.T) {
+		cfg := sysCoreCfg.SysCoreConfig
+		cfg.DbConfig.DbDir = filepath.Join(dir, "invalid")
+		cfg.CronConfig.BackupDir = filepath.Join(dir, "backups")
+		logger := zaplog.NewZapLogger(zaplog.DEBUG, "sys-core-test", true, "")
+		for _, opts := range []coresvc.Options{
+			{Engine: coresvc.EngineOptions{Kind: coresvc.EngineMemory}, Cron: coresvc.CronOptions{Lock: "zookeeper"}},
+			{Engine: coresvc.EngineOptions{Kind: coresvc.EngineMemory}, Cron: coresvc.CronOptions{Lock: coresvc.CronLockLease}},
+		} {
+			_, err := coresvc.NewCoreDBWithOptions(logger, &cfg, nil, opts)
+			assert.Error(t, err)
+		}
+	})
+}
+
+// testCronReplicas runs a job every second on two replicas, once per schedule,
+// and on the other replica once the first one is closed.
+func testCronReplicas(t *testing.T, open func() *coresvc.CoreDB) {
+	var mu sync.Mutex
+	runs := map[int]map[int64]int{}
+	register := func(cdb *coresvc.CoreDB, replica int) {
+		runs[replica] = map[int64]int{}
+		require.NoError(t, cdb.RegisterJob("tick", "@every 1s", func(context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			runs[replica][time.Now().Unix()]++
+			return nil
+		}))
+	}
+	count := func(replica int) int {
+		mu.Lock()
+		defer mu.Unlock()
+		n := 0
+		for _, c := range runs[replica] {
+			n += c
+		}
+		return n
+	}
+	first, second := open(), open()
+	register(first, 1)
+	register(second, 2)
+	time.Sleep(3500 * time.Millisecond)
+
+	mu.Lock()
+	seconds := map[int64]int{}
+	for _, r := range runs {
+		for s, c := range r {
+			seconds[s] += c
+		}
+	}
+	mu.Unlock()
+	assert.GreaterOrEqual(t, len(seconds), 2)
+	for s, c := range seconds {
+		assert.Equal(t, 1, c, "runs at %d", s)
+	}
+	// the replica running the job keeps it
+	leader, other := first, second
+	leaderID, otherID := 1, 2
+	if count(1) == 0 {
+		leader, other, leaderID, otherID = second, first, 2, 1
+	}
+	assert.Zero(t, count(otherID))
+	assert.Greater(t, count(leaderID), 0)
+
+	require.NoError(t, leader.Close())
+	assert.Eventually(t, func() bool { return count(otherID) > 0 }, 5*time.Second, 100*time.Millisecond)
+	require.NoError(t, other.Close())
+}
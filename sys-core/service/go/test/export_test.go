@@ -0,0 +1,77 @@
+package db_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	sharedConfig "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+)
+
+type exportStream struct {
+	chunks []*coresvc.ExportChunk
+}
+
+func (s *exportStream) Context() context.Context { return context.Background() }
+
+func (s *exportStream) Send(chunk *coresvc.ExportChunk) error {
+	s.chunks = append(s.chunks, chunk)
+	return nil
+}
+
+func testExportImport(t *testing.T) {
+	dir, err := os.MkdirTemp("", "coredb-export")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	src, srcAll := newBackupTestDB(t, filepath.Join(dir, "src"), filepath.Join(dir, "backups"), coresvc.Options{})
+	for _, blah := range []string{"keep one", "keep two, with a comma", "keep three"} {
+		require.NoError(t, src.Exec("INSERT INTO "+tableName+"(id, foreign_id, blah) VALUES(?, ?, ?)", sharedConfig.NewID(), sharedConfig.NewID(), blah))
+	}
+	require.NoError(t, src.Exec("INSERT INTO "+tableName+"(id, foreign_id, blah) VALUES(?, ?, ?)", sharedConfig.NewID(), sharedConfig.NewID(), "other"))
+
+	for _, format := range []string{coresvc.ExportFormatJSONL, coresvc.ExportFormatCSV} {
+		var buf bytes.Buffer
+		rows, err := src.ExportTable(context.Background(), &buf, tableName, coresvc.ExportOptions{
+			Format:  format,
+			Filter:  map[string]interface{}{"blah": "keep"},
+			Matcher: "like",
+		})
+		require.NoError(t, err)
+		assert.EqualValues(t, 3, rows)
+
+		dst, _ := newBackupTestDB(t, filepath.Join(dir, "dst-"+format), filepath.Join(dir, "backups"), coresvc.Options{})
+		imported, err := dst.ImportTable(context.Background(), &buf, tableName, format)
+		require.NoError(t, err)
+		assert.EqualValues(t, 3, imported)
+		doc, err := dst.QueryOne("SELECT blah FROM "+tableName+" WHERE blah = ?", "keep two, with a comma")
+		require.NoError(t, err)
+		assert.NotNil(t, doc)
+		_, err = dst.QueryOne("SELECT blah FROM "+tableName+" WHERE blah = ?", "other")
+		assert.Error(t, err)
+	}
+
+	// the streaming export cuts tables into chunks, csv starting with the header row
+	stream := &exportStream{}
+	require.NoError(t, srcAll.Export(&coresvc.ExportRequest{
+		DbName:        "backup_test.db",
+		ExportOptions: coresvc.ExportOptions{Format: coresvc.ExportFormatCSV, Columns: []string{"id", "blah"}},
+	}, stream))
+	require.NotEmpty(t, stream.chunks)
+	assert.True(t, strings.HasPrefix(string(stream.chunks[0].Data), "id,blah\n"))
+
+	err = srcAll.Export(&coresvc.ExportRequest{
+		DbName:        "backup_test.db",
+		ExportOptions: coresvc.ExportOptions{Columns: []string{"password"}},
+	}, &exportStream{})
+	assert.Error(t, err)
+	_, err = src.ImportTable(context.Background(), strings.NewReader(`{"password": "secret"}`), tableName, coresvc.ExportFormatJSONL)
+	assert.Error(t, err)
+}
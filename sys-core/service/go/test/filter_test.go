@@ -0,0 +1,77 @@
+package db_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	sharedConfig "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+)
+
+func testFilter(t *testing.T) {
+	cdb := newRepoItemsDB(t)
+	ctx := context.Background()
+	items, err := coresvc.NewRepository[repoItem](cdb, repoItemsTable, coresvc.RepositoryOptions{})
+	require.NoError(t, err)
+	for i, name := range []string{"alpha", "beta", "gamma", "delta", "epsilon"} {
+		require.NoError(t, items.Insert(ctx, repoItem{Code: sharedConfig.NewID(), Name: name, CreatedAt: int64(i + 1)}))
+	}
+	// a row without created_at
+	require.NoError(t, cdb.Exec("INSERT INTO "+repoItemsTable+"(code, name) VALUES(?, ?)", sharedConfig.NewID(), "zeta"))
+
+	names := func(filter string) []string {
+		f, err := coresvc.ParseFilter([]byte(filter), "")
+		require.NoError(t, err)
+		list, _, err := items.List(ctx, coresvc.ListOptions{Filter: f, PageRequest: coresvc.PageRequest{OrderBy: "name"}})
+		require.NoError(t, err)
+		var names []string
+		for _, item := range list {
+			names = append(names, item.Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"alpha", "beta", "delta", "gamma"}, names(`{"and": [
+		{"field": "name", "op": "like", "value": "a"},
+		{"field": "created_at", "op": "lte", "value": 4}
+	]}`))
+	assert.Equal(t, []string{"beta", "delta", "epsilon", "zeta"}, names(`{"or": [
+		{"field": "created_at", "op": "between", "value": [4, 5]},
+		{"field": "name", "op": "in", "value": ["beta"]},
+		{"field": "created_at", "op": "is_null"}
+	]}`))
+	assert.Equal(t, []string{"alpha", "gamma"}, names(`{"and": [
+		{"field": "created_at", "op": "not_null"},
+		{"field": "name", "op": "not_in", "value": ["beta", "delta", "epsilon"]}
+	]}`))
+	// filters built in code may use typed slices
+	for _, bounds := range []interface{}{[]int64{2, 3}, [2]int{2, 3}, []interface{}{2, 3}} {
+		list, _, err := items.List(ctx, coresvc.ListOptions{
+			Filter:      &coresvc.Filter{Field: "created_at", Op: coresvc.FilterBetween, Value: bounds},
+			PageRequest: coresvc.PageRequest{OrderBy: "name"},
+		})
+		require.NoError(t, err)
+		require.Len(t, list, 2, bounds)
+		assert.Equal(t, "beta", list[0].Name)
+		assert.Equal(t, "gamma", list[1].Name)
+	}
+	assert.True(t, coresvc.IsInvalidFilter((&coresvc.Filter{Field: "created_at", Op: coresvc.FilterBetween, Value: []int64{1, 2, 3}}).Validate()))
+	// the older map of field to value uses the matcher, like compares numbers for equality
+	assert.Equal(t, []string{"beta", "delta", "epsilon", "zeta"}, names(`{"name": "e"}`))
+	assert.Equal(t, []string{"delta"}, names(`{"name": "e", "created_at": 4}`))
+
+	for _, invalid := range []string{
+		`{"field": "name", "op": "matches", "value": "a"}`,
+		`{"field": "name; DROP TABLE x", "op": "eq", "value": "a"}`,
+		`{"field": "created_at", "op": "between", "value": [1]}`,
+		`{"field": "name", "op": "eq", "value": "a", "or": [{"field": "name", "op": "is_null"}]}`,
+		`{"and": []}`,
+		`[1, 2]`,
+	} {
+		_, err := coresvc.ParseFilter([]byte(invalid), "")
+		assert.True(t, coresvc.IsInvalidFilter(err), invalid)
+	}
+}
@@ -0,0 +1,147 @@
+package db_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+)
+
+const indexedTable = "indexed_items"
+
+type indexedItem struct {
+	Id        string   `genji:"id" coredb:"primary"`
+	Email     string   `genji:"email" coredb:"unique"`
+	AccountId string   `genji:"account_id" coredb:"index"`
+	OrgId     string   `genji:"org_id" coredb:"index=org"`
+	ProjectId string   `genji:"project_id" coredb:"index,index=project|by_project"`
+	Tags      []string `genji:"tags"`
+}
+
+func (i indexedItem) CreateSQL() []string {
+	return coresvc.NewModelTable(indexedTable, i).CreateTable()
+}
+
+type badIndexItem struct {
+	Id     string `genji:"id" coredb:"primary,unique=pair"`
+	Handle string `genji:"handle" coredb:"unique=pair"`
+}
+
+func (b badIndexItem) CreateSQL() []string {
+	return coresvc.NewModelTable("bad_index_items", b).CreateTable()
+}
+
+type compositeIndexItem struct {
+	Id        string `genji:"id" coredb:"primary"`
+	AccountId string `genji:"account_id" coredb:"index=scope"`
+	OrgId     string `genji:"org_id" coredb:"index=scope"`
+}
+
+func (c compositeIndexItem) CreateSQL() []string {
+	return coresvc.NewModelTable("composite_index_items", c).CreateTable()
+}
+
+func testIndexes(t *testing.T) {
+	dir, err := os.MkdirTemp("", "coredb-indexes")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Equal(t, []coresvc.Index{
+		{Name: "idx_indexed_items_account_id", Table: indexedTable, Column: "account_id"},
+		{Name: "idx_indexed_items_by_project", Table: indexedTable, Column: "project_id"},
+		{Name: "idx_indexed_items_email", Table: indexedTable, Column: "email", Unique: true},
+		{Name: "idx_indexed_items_org", Table: indexedTable, Column: "org_id"},
+		{Name: "idx_indexed_items_project", Table: indexedTable, Column: "project_id"},
+		{Name: "idx_indexed_items_project_id", Table: indexedTable, Column: "project_id"},
+	}, coresvc.GetStructIndexes(indexedTable, indexedItem{}))
+	assert.Equal(t, []string{
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_indexed_items_email ON indexed_items(email)",
+		"CREATE INDEX IF NOT EXISTS idx_indexed_items_org ON indexed_items(org_id)",
+	}, []string{
+		coresvc.GetStructIndexes(indexedTable, indexedItem{})[2].Statement(),
+		coresvc.GetStructIndexes(indexedTable, indexedItem{})[3].Statement(),
+	})
+
+	opts := coresvc.Options{Engine: coresvc.EngineOptions{Kind: coresvc.EngineMemory}}
+	cdb, all := newBackupTestDB(t, filepath.Join(dir, "db"), filepath.Join(dir, "backups"), opts)
+	defer cdb.Close()
+	// genji has no index on several columns
+	for table, model := range map[string]coresvc.DbModel{"bad_index_items": badIndexItem{}, "composite_index_items": compositeIndexItem{}} {
+		err = cdb.RegisterModels(map[string]coresvc.DbModel{table: model})
+		require.Error(t, err, table)
+		assert.Contains(t, err.Error(), "several columns", table)
+	}
+	require.NoError(t, cdb.RegisterModels(map[string]coresvc.DbModel{tableName: &SomeData{}, indexedTable: indexedItem{}}))
+	require.NoError(t, cdb.MakeSchema())
+	require.NoError(t, cdb.Exec("CREATE INDEX idx_some_datas_blah ON some_datas(blah)"))
+
+	ctx := context.Background()
+	require.NoError(t, cdb.InsertFixture(ctx, indexedTable,
+		map[string]interface{}{"id": "1", "email": "a@example.com", "account_id": "acc", "org_id": "org", "project_id": "p1"},
+		map[string]interface{}{"id": "2", "email": "b@example.com", "account_id": "acc", "org_id": "org", "project_id": "p2"},
+	))
+	assert.Error(t, cdb.Exec("INSERT INTO indexed_items (id, email, account_id, org_id, project_id) VALUES ('3', 'a@example.com', 'acc', 'org', 'p3')"))
+
+	list, err := all.ListIndexes(ctx, &coresvc.IndexRequest{DbName: "backup_test.db"})
+	require.NoError(t, err)
+	require.Len(t, list.Results, 1)
+	infos := map[string]*coresvc.IndexInfo{}
+	for _, info := range list.Results[0].Indexes {
+		infos[info.Name] = info
+	}
+	require.Len(t, infos, 8)
+	assert.True(t, infos["idx_indexed_items_org"].Declared)
+	assert.True(t, infos["idx_indexed_items_org"].Present)
+	assert.Equal(t, "org_id", infos["idx_indexed_items_org"].Path)
+	assert.False(t, infos["idx_some_datas_blah"].Declared)
+	assert.True(t, infos["idx_some_datas_blah"].Present)
+	list, err = all.ListIndexes(ctx, &coresvc.IndexRequest{Table: tableName})
+	require.NoError(t, err)
+	assert.Len(t, list.Results[0].Indexes, 2)
+
+	// a dropped index is created again, and filled in, on rebuild
+	dropped, err := all.DropIndex(ctx, &coresvc.IndexRequest{DbName: "backup_test.db", Index: "idx_indexed_items_email"})
+	require.NoError(t, err)
+	for _, info := range dropped.Indexes {
+		assert.Equal(t, info.Name != "idx_indexed_items_email", info.Present, info.Name)
+	}
+	require.NoError(t, cdb.Exec("INSERT INTO indexed_items (id, email, account_id, org_id, project_id) VALUES ('3', 'a@example.com', 'acc', 'org', 'p3')"))
+	_, err = all.RebuildIndexes(ctx, &coresvc.IndexRequest{DbName: "backup_test.db", Table: indexedTable})
+	assert.Error(t, err)
+	require.NoError(t, cdb.Exec("DELETE FROM indexed_items WHERE id = '3'"))
+	rebuilt, err := all.RebuildIndexes(ctx, &coresvc.IndexRequest{DbName: "backup_test.db", Table: indexedTable})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"idx_indexed_items_account_id", "idx_indexed_items_by_project", "idx_indexed_items_email",
+		"idx_indexed_items_org", "idx_indexed_items_project", "idx_indexed_items_project_id",
+	}, rebuilt.Rebuilt)
+	assert.Error(t, cdb.Exec("INSERT INTO indexed_items (id, email, account_id, org_id, project_id) VALUES ('3', 'a@example.com', 'acc', 'org', 'p3')"))
+	res, err := cdb.QueryOne("SELECT id FROM indexed_items WHERE account_id = ? AND org_id = ? AND project_id = ?", "acc", "org", "p2")
+	require.NoError(t, err)
+	var got indexedItem
+	require.NoError(t, res.StructScan(&got))
+	assert.Equal(t, "2", got.Id)
+
+	// as does MakeSchema
+	require.NoError(t, cdb.DropIndex(ctx, "idx_indexed_items_account_id"))
+	require.NoError(t, cdb.MakeSchema())
+	res, err = cdb.QueryOne("SELECT id FROM indexed_items WHERE account_id = ? AND project_id = ?", "acc", "p1")
+	require.NoError(t, err)
+	require.NoError(t, res.StructScan(&got))
+	assert.Equal(t, "1", got.Id)
+	require.NoError(t, cdb.Exec("DELETE FROM indexed_items WHERE account_id = 'acc'"))
+
+	_, err = all.DropIndex(ctx, &coresvc.IndexRequest{DbName: "backup_test.db", Index: "idx_unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = all.RebuildIndexes(ctx, &coresvc.IndexRequest{DbName: "backup_test.db", Index: "idx_unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = all.DropIndex(ctx, &coresvc.IndexRequest{Index: "idx_indexed_items_email"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,137 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+)
+
+func testJobs(t *testing.T) {
+	dir, err := os.MkdirTemp("", "coredb-jobs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cdb, all := newBackupTestDB(t, filepath.Join(dir, "db"), filepath.Join(dir, "backups"), coresvc.Options{})
+	ctx := context.Background()
+	var names []string
+	for _, js := range cdb.Jobs() {
+		names = append(names, js.Name)
+	}
+	assert.Equal(t, []string{"backup", "gc", "ttl"}, names)
+
+	// the failures are recorded, with the runs asked for
+	require.NoError(t, cdb.RegisterJob("failing", "", func(context.Context) error {
+		return errors.New("out of disk")
+	}))
+	assert.Error(t, cdb.RegisterJob("failing", "", func(context.Context) error { return nil }))
+	assert.Error(t, cdb.RegisterJob("bad spec", "every now and then", func(context.Context) error { return nil }))
+	res, err := cdb.RunJob(ctx, "failing")
+	require.NoError(t, err)
+	assert.Equal(t, "out of disk", res.Error)
+	assert.True(t, res.Manual)
+	js, err := cdb.Job("failing")
+	require.NoError(t, err)
+	require.NotNil(t, js.LastRun)
+	assert.Equal(t, "out of disk", js.LastRun.Error)
+	assert.Zero(t, js.NextRun)
+
+	require.NoError(t, cdb.RegisterJob("panicking", "", func(context.Context) error {
+		panic("nil map")
+	}))
+	res, err = cdb.RunJob(ctx, "panicking")
+	require.NoError(t, err)
+	assert.Contains(t, res.Error, "nil map")
+
+	// only the last runs are kept
+	for i := 0; i < 25; i++ {
+		_, err = cdb.RunJob(ctx, "failing")
+		require.NoError(t, err)
+	}
+	js, err = cdb.Job("failing")
+	require.NoError(t, err)
+	assert.Len(t, js.History, 20)
+
+	// a job does not run twice at once
+	started, release := make(chan struct{}), make(chan struct{})
+	require.NoError(t, cdb.RegisterJob("slow", "", func(context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}))
+	done := make(chan error)
+	go func() {
+		_, err := cdb.RunJob(ctx, "slow")
+		done <- err
+	}()
+	<-started
+	js, err = cdb.Job("slow")
+	require.NoError(t, err)
+	assert.True(t, js.Running)
+	_, err = cdb.RunJob(ctx, "slow")
+	assert.Error(t, err)
+	close(release)
+	require.NoError(t, <-done)
+
+	// the scheduled runs stop while paused
+	var ticks int32
+	require.NoError(t, cdb.RegisterJob("ticking", "@every 1s", func(context.Context) error {
+		atomic.AddInt32(&ticks, 1)
+		return nil
+	}))
+	js, err = cdb.Job("ticking")
+	require.NoError(t, err)
+	assert.Greater(t, js.NextRun, int64(0))
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&ticks) > 0 }, 5*time.Second, 50*time.Millisecond)
+	paused, err := all.PauseJob(ctx, &coresvc.JobRequest{DbName: "backup_test.db", Job: "ticking"})
+	require.NoError(t, err)
+	assert.True(t, paused.Job.Paused)
+	assert.Zero(t, paused.Job.NextRun)
+	assert.False(t, paused.Job.LastRun.Manual)
+	resumed, err := all.ResumeJob(ctx, &coresvc.JobRequest{DbName: "backup_test.db", Job: "ticking"})
+	require.NoError(t, err)
+	assert.False(t, resumed.Job.Paused)
+	assert.Greater(t, resumed.Job.NextRun, int64(0))
+
+	// functions registered the old way are named after their spec
+	require.NoError(t, cdb.RegisterCronFunction("@daily", func() {}))
+	require.NoError(t, cdb.RegisterCronFunction("@daily", func() {}))
+	_, err = cdb.Job("@daily #2")
+	assert.NoError(t, err)
+
+	list, err := all.ListJobs(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, list.Results, 1)
+	assert.Len(t, list.Results[0].Jobs, 9)
+	run, err := all.RunJob(ctx, &coresvc.JobRequest{DbName: "backup_test.db", Job: "backup"})
+	require.NoError(t, err)
+	assert.Empty(t, run.Result.Error)
+	_, err = all.RunJob(ctx, &coresvc.JobRequest{DbName: "backup_test.db", Job: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = all.PauseJob(ctx, &coresvc.JobRequest{DbName: "backup_test.db"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// without the scheduler, as offline, the jobs only run when asked
+	offline, _ := newBackupTestDB(t, filepath.Join(dir, "offline"), filepath.Join(dir, "offline-backups"),
+		coresvc.Options{Cron: coresvc.CronOptions{Disabled: true}})
+	var offlineTicks int32
+	require.NoError(t, offline.RegisterJob("ticking", "@every 1s", func(context.Context) error {
+		atomic.AddInt32(&offlineTicks, 1)
+		return nil
+	}))
+	time.Sleep(1500 * time.Millisecond)
+	assert.Zero(t, atomic.LoadInt32(&offlineTicks))
+	_, err = offline.RunJob(ctx, "ticking")
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&offlineTicks))
+}
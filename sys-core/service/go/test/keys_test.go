@@ -0,0 +1,38 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+)
+
+func testDeriveKey(t *testing.T) {
+	opts := coresvc.KeyOptions{}
+	k1, err := opts.DeriveKey("a.db", "secret")
+	require.NoError(t, err)
+	assert.Len(t, k1, 32)
+	k2, err := opts.DeriveKey("b.db", "secret")
+	require.NoError(t, err)
+	assert.NotEqual(t, k1, k2)
+
+	legacy, err := coresvc.KeyOptions{Kdf: coresvc.KdfMD5}.DeriveKey("a.db", "secret")
+	require.NoError(t, err)
+	assert.Len(t, legacy, 16)
+
+	_, err = coresvc.KeyOptions{Kdf: "rot13"}.DeriveKey("a.db", "secret")
+	assert.Error(t, err)
+}
+
+func testRekey(t *testing.T) {
+	oldKey := sysCoreCfg.SysCoreConfig.DbConfig.EncryptKey
+	assert.Error(t, sysCoreSvc.Rekey(""))
+	require.NoError(t, sysCoreSvc.Rekey("anotherTestKey!@"))
+	res, err := sysCoreSvc.QueryOne("SELECT id FROM " + tableName)
+	require.NoError(t, err)
+	assert.NotNil(t, res)
+	// restore the configured key for subsequent runs
+	require.NoError(t, sysCoreSvc.Rekey(oldKey))
+}
@@ -0,0 +1,52 @@
+package db_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+)
+
+var (
+	blahIdx = fmt.Sprintf("idx_%s_blah", tableName)
+)
+
+func testMigrations(t *testing.T) {
+	err := sysCoreSvc.RegisterMigrations([]coresvc.Migration{
+		{
+			Version:     2,
+			Description: "index blah",
+			Up:          []string{fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s(blah)", blahIdx, tableName)},
+			Down:        []string{fmt.Sprintf("DROP INDEX %s", blahIdx)},
+		},
+		{
+			Version:     1,
+			Description: "noop",
+		},
+	})
+	require.NoError(t, err)
+	assert.Error(t, sysCoreSvc.RegisterMigrations([]coresvc.Migration{{Version: 1}, {Version: 1}}))
+
+	statuses, err := sysCoreSvc.MigrateUp(1)
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	assert.True(t, statuses[0].Applied)
+	assert.False(t, statuses[1].Applied)
+
+	statuses, err = sysCoreSvc.MigrateUp(0)
+	require.NoError(t, err)
+	assert.True(t, statuses[1].Applied)
+	version, err := sysCoreSvc.SchemaVersion()
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+
+	_, err = sysCoreSvc.MigrateDown(3)
+	assert.Error(t, err)
+	statuses, err = sysCoreSvc.MigrateDown(0)
+	require.NoError(t, err)
+	assert.False(t, statuses[0].Applied)
+	assert.False(t, statuses[1].Applied)
+}
@@ -0,0 +1,103 @@
+package db_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/genjidb/genji/document"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	sharedConfig "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+)
+
+func testPagination(t *testing.T) {
+	dir, err := os.MkdirTemp("", "coredb-pagination")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cdb, _ := newBackupTestDB(t, filepath.Join(dir, "db"), filepath.Join(dir, "backups"), coresvc.Options{})
+	ctx := context.Background()
+	query := coresvc.PageQuery{Table: tableName, Columns: "id, foreign_id, blah"}
+
+	// an empty table gives an empty last page
+	query.Limit = 2
+	page, err := cdb.QueryPage(ctx, query)
+	require.NoError(t, err)
+	assert.Empty(t, page.Docs)
+	assert.False(t, page.HasMore)
+	assert.Empty(t, page.NextCursor)
+
+	var want []SomeData
+	for _, blah := range []string{"a", "a", "a", "b", "b", "c", "c"} {
+		sd := SomeData{ID: sharedConfig.NewID(), ForeignID: sharedConfig.NewID(), Blah: blah}
+		require.NoError(t, cdb.Exec("INSERT INTO "+tableName+"(id, foreign_id, blah) VALUES(?, ?, ?)", sd.ID, sd.ForeignID, sd.Blah))
+		want = append(want, sd)
+	}
+	// the rows without a sort key, null or missing, come first
+	for _, stmt := range []string{
+		"INSERT INTO " + tableName + "(id, foreign_id, blah) VALUES(?, ?, NULL)",
+		"INSERT INTO " + tableName + "(id, foreign_id) VALUES(?, ?)",
+		"INSERT INTO " + tableName + "(id, foreign_id) VALUES(?, ?)",
+	} {
+		sd := SomeData{ID: sharedConfig.NewID(), ForeignID: sharedConfig.NewID()}
+		require.NoError(t, cdb.Exec(stmt, sd.ID, sd.ForeignID))
+		want = append(want, sd)
+	}
+
+	// rows sharing a sort key are neither skipped nor repeated across pages,
+	// the total is only counted for the first one
+	listAll := func(descending bool) []SomeData {
+		var got []SomeData
+		query.PageRequest = coresvc.PageRequest{OrderBy: "blah", Descending: descending, Limit: 2}
+		for {
+			page, err := cdb.QueryPage(ctx, query)
+			require.NoError(t, err)
+			if query.Cursor == "" {
+				assert.EqualValues(t, len(want), page.Total)
+			} else {
+				assert.EqualValues(t, -1, page.Total)
+			}
+			require.NoError(t, page.Iterate(func(d document.Document) error {
+				var sd SomeData
+				if err := document.StructScan(d, &sd); err != nil {
+					return err
+				}
+				got = append(got, sd)
+				return nil
+			}))
+			if !page.HasMore {
+				assert.Empty(t, page.NextCursor)
+				return got
+			}
+			query.Cursor = page.NextCursor
+		}
+	}
+	sort.Slice(want, func(i, j int) bool {
+		if want[i].Blah != want[j].Blah {
+			return want[i].Blah < want[j].Blah
+		}
+		return want[i].ID < want[j].ID
+	})
+	assert.Equal(t, want, listAll(false))
+	for i, j := 0, len(want)-1; i < j; i, j = i+1, j-1 {
+		want[i], want[j] = want[j], want[i]
+	}
+	assert.Equal(t, want, listAll(true))
+
+	// the filter applies to the rows and the total
+	query.PageRequest = coresvc.PageRequest{OrderBy: "blah"}
+	query.Filter = coresvc.FilterBuilder(map[string]interface{}{"blah": "b"}, "eq")
+	page, err = cdb.QueryPage(ctx, query)
+	require.NoError(t, err)
+	assert.Len(t, page.Docs, 2)
+	assert.EqualValues(t, 2, page.Total)
+
+	query.Cursor = "not a cursor"
+	_, err = cdb.QueryPage(ctx, query)
+	assert.Error(t, err)
+}
@@ -0,0 +1,81 @@
+package db_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/genjidb/genji/document"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	sharedConfig "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+)
+
+func testQueryContext(t *testing.T) {
+	dir, err := os.MkdirTemp("", "coredb-query")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// every statement is slower than the threshold, so the slow query log runs as well
+	opts := coresvc.Options{Query: coresvc.QueryOptions{Timeout: 1000, SlowThreshold: 1}}
+	cdb, _ := newBackupTestDB(t, filepath.Join(dir, "db"), filepath.Join(dir, "backups"), opts)
+	insert := "INSERT INTO " + tableName + "(id, foreign_id, blah) VALUES(?, ?, ?)"
+	ctx := context.Background()
+	require.NoError(t, cdb.ExecContext(ctx, insert, sharedConfig.NewID(), sharedConfig.NewID(), "blah"))
+
+	res, err := cdb.QueryContext(ctx, "SELECT id FROM "+tableName)
+	require.NoError(t, err)
+	count := 0
+	require.NoError(t, res.Iterate(func(d document.Document) error {
+		count++
+		return nil
+	}))
+	require.NoError(t, res.Close())
+	assert.Equal(t, 1, count)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = cdb.QueryContext(canceled, "SELECT id FROM "+tableName)
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = cdb.QueryOneContext(canceled, "SELECT id FROM "+tableName)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, cdb.ExecContext(canceled, insert, sharedConfig.NewID(), sharedConfig.NewID(), "blah"), context.Canceled)
+
+	expired, cancel := context.WithDeadline(ctx, time.Now().Add(-time.Second))
+	defer cancel()
+	_, err = cdb.QueryContext(expired, "SELECT id FROM "+tableName)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// the canceled insert was not committed
+	doc, err := cdb.QueryOne("SELECT COUNT(*) FROM " + tableName)
+	require.NoError(t, err)
+	var n int64
+	require.NoError(t, doc.Doc.Iterate(func(_ string, v document.Value) error {
+		n, _ = v.V.(int64)
+		return nil
+	}))
+	assert.EqualValues(t, 1, n)
+
+	// the rows are read up front, closing the store does not wait for the result
+	res, err = cdb.QueryContext(ctx, "SELECT id FROM "+tableName)
+	require.NoError(t, err)
+	closed := make(chan error, 1)
+	go func() { closed <- cdb.Close() }()
+	select {
+	case err := <-closed:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("closing the database waited for an open result")
+	}
+	count = 0
+	require.NoError(t, res.Iterate(func(d document.Document) error {
+		count++
+		return nil
+	}))
+	assert.Equal(t, 1, count)
+	require.NoError(t, res.Close())
+}
@@ -0,0 +1,111 @@
+package db_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	sharedConfig "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
+	"go.amplifyedge.org/sys-share-v2/sys-core/service/logging/zaplog"
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+)
+
+const repoItemsTable = "repo_items"
+
+type repoItem struct {
+	Code      string   `genji:"code" coredb:"primary"`
+	Name      string   `genji:"name"`
+	Tags      []string `genji:"tags"`
+	CreatedAt int64    `genji:"created_at"`
+}
+
+func (r repoItem) CreateSQL() []string {
+	return coresvc.NewTable(repoItemsTable, coresvc.GetStructTags(r), nil).CreateTable()
+}
+
+// newRepoItemsDB opens an in memory database with the repo items next to the some datas.
+func newRepoItemsDB(t *testing.T) *coresvc.CoreDB {
+	cdb, err := coresvc.NewTestDB(zaplog.NewZapLogger(zaplog.DEBUG, "sys-core-test", true, ""))
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, cdb.Close()) })
+	require.NoError(t, cdb.RegisterModels(map[string]coresvc.DbModel{
+		tableName:      &SomeData{},
+		repoItemsTable: repoItem{},
+	}))
+	require.NoError(t, cdb.MakeSchema())
+	return cdb
+}
+
+func testRepository(t *testing.T) {
+	cdb := newRepoItemsDB(t)
+	ctx := context.Background()
+
+	_, err := coresvc.NewRepository[repoItem](cdb, "unknown", coresvc.RepositoryOptions{})
+	assert.Error(t, err)
+
+	items, err := coresvc.NewRepository[repoItem](cdb, repoItemsTable, coresvc.RepositoryOptions{})
+	require.NoError(t, err)
+	for i, name := range []string{"first", "second", "third"} {
+		require.NoError(t, items.Insert(ctx, repoItem{
+			Code:      sharedConfig.NewID(),
+			Name:      name,
+			Tags:      []string{"tag"},
+			CreatedAt: int64(i + 1),
+		}))
+	}
+
+	var names []string
+	req := coresvc.PageRequest{Limit: 2}
+	for {
+		page, info, err := items.List(ctx, coresvc.ListOptions{PageRequest: req})
+		require.NoError(t, err)
+		if req.Cursor == "" {
+			assert.EqualValues(t, 3, info.Total)
+		}
+		for _, item := range page {
+			names = append(names, item.Name)
+		}
+		if !info.HasMore {
+			break
+		}
+		req.Cursor = info.NextCursor
+	}
+	assert.Equal(t, []string{"first", "second", "third"}, names)
+
+	page, _, err := items.List(ctx, coresvc.ListOptions{
+		Filter: &coresvc.Filter{Field: "name", Op: coresvc.FilterLike, Value: "ir"},
+	})
+	require.NoError(t, err)
+	require.Len(t, page, 2)
+
+	count, err := items.Count(ctx, nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, count)
+
+	second, err := items.Get(ctx, map[string]interface{}{"name": "second"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tag"}, second.Tags)
+	second.Name = "updated"
+	require.NoError(t, items.Update(ctx, second))
+	got, err := items.GetByKey(ctx, second.Code)
+	require.NoError(t, err)
+	assert.Equal(t, second, got)
+
+	require.NoError(t, items.DeleteByKey(ctx, second.Code))
+	_, err = items.GetByKey(ctx, second.Code)
+	assert.Error(t, err)
+	assert.Error(t, items.Delete(ctx, nil))
+
+	// pointer models and transactions
+	datas, err := coresvc.NewRepository[*SomeData](cdb, tableName, coresvc.RepositoryOptions{})
+	require.NoError(t, err)
+	id := sharedConfig.NewID()
+	require.NoError(t, cdb.Update(ctx, func(tx *coresvc.Tx) error {
+		return datas.WithTx(tx).Insert(ctx, &SomeData{ID: id, ForeignID: sharedConfig.NewID(), Blah: "blah"})
+	}))
+	sd, err := datas.GetByKey(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "blah", sd.Blah)
+}
@@ -0,0 +1,120 @@
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/genjidb/genji/document"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.amplifyedge.org/sys-share-v2/sys-core/service/logging/zaplog"
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+	"go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/search"
+)
+
+func hitIDs(hits []*search.Hit) []string {
+	ids := []string{}
+	for _, h := range hits {
+		ids = append(ids, h.ID)
+	}
+	return ids
+}
+
+func testSearchIndex(t *testing.T) {
+	ix := search.NewIndex()
+	ix.Put(search.Document{Type: "account", ID: "a1", Fields: []search.Field{{Name: "email", Text: "john.doe@example.com"}}})
+	ix.Put(search.Document{Type: "account", ID: "a2", Fields: []search.Field{{Name: "email", Text: "johnny.walker@example.com"}}})
+	ix.Put(search.Document{Type: "account", ID: "a3", Fields: []search.Field{{Name: "email", Text: "jane.roe@example.org"}}})
+	ix.Put(search.Document{Type: "org", ID: "o1", Meta: map[string]string{"owner": "a1"}, Fields: []search.Field{
+		{Name: "name", Text: "Doe Industries", Boost: 2},
+		{Name: "contact", Text: "contact@doe.example.com"},
+	}})
+	assert.Equal(t, 4, ix.Len())
+
+	// every term matches, the last one as a prefix
+	assert.Equal(t, []string{"a1"}, hitIDs(ix.Search(search.Query{Text: "john doe"})))
+	assert.Equal(t, []string{"a1", "a2"}, hitIDs(ix.Search(search.Query{Text: "example.com joh"})))
+	assert.Empty(t, ix.Search(search.Query{Text: "joh example.com"}))
+	assert.Empty(t, ix.Search(search.Query{Text: " .@ "}))
+	// an exact match ranks above a prefix one, a boosted field above the others
+	assert.Equal(t, []string{"a1", "a2"}, hitIDs(ix.Search(search.Query{Text: "john"})))
+	assert.Equal(t, []string{"o1", "a1"}, hitIDs(ix.Search(search.Query{Text: "doe"})))
+	// typos
+	assert.Equal(t, []string{"a2"}, hitIDs(ix.Search(search.Query{Text: "walkre"})))
+	assert.Equal(t, []string{"o1"}, hitIDs(ix.Search(search.Query{Text: "industreis"})))
+	assert.Empty(t, ix.Search(search.Query{Text: "jon"}))
+
+	// types, filter and limit
+	assert.Equal(t, []string{"a1"}, hitIDs(ix.Search(search.Query{Text: "doe", Types: []string{"account"}})))
+	hits := ix.Search(search.Query{Text: "doe", Filter: func(h *search.Hit) bool { return h.Type == "account" }})
+	assert.Equal(t, []string{"a1"}, hitIDs(hits))
+	hits = ix.Search(search.Query{Text: "example", Filter: func(h *search.Hit) bool { return h.ID != "a1" }, Limit: 2})
+	assert.Len(t, hits, 2)
+	assert.NotContains(t, hitIDs(hits), "a1")
+	hits = ix.Search(search.Query{Text: "industries"})
+	require.Len(t, hits, 1)
+	assert.Equal(t, "a1", hits[0].Meta["owner"])
+
+	// replacing and deleting documents
+	ix.Put(search.Document{Type: "account", ID: "a1", Fields: []search.Field{{Name: "email", Text: "jd@example.net"}}})
+	assert.Empty(t, ix.Search(search.Query{Text: "john doe"}))
+	assert.Equal(t, []string{"a1"}, hitIDs(ix.Search(search.Query{Text: "jd"})))
+	ix.Delete("account", "a1")
+	assert.Empty(t, ix.Search(search.Query{Text: "jd"}))
+	ix.Reset("account")
+	assert.Equal(t, 1, ix.Len())
+	ix.Reset()
+	assert.Zero(t, ix.Len())
+}
+
+func testSearchSync(t *testing.T) {
+	ctx := context.Background()
+	cdb := newRepoItemsDB(t)
+	items, err := coresvc.NewRepository[repoItem](cdb, repoItemsTable, coresvc.RepositoryOptions{})
+	require.NoError(t, err)
+	require.NoError(t, items.Insert(ctx, repoItem{Code: "item-1", Name: "blue widget"}))
+	require.NoError(t, items.Insert(ctx, repoItem{Code: "item-2", Name: "red widget"}))
+	// the archived items stay out of the index
+	require.NoError(t, items.Insert(ctx, repoItem{Code: "item-3", Name: "old widget", Tags: []string{"archived"}}))
+
+	ix := search.NewIndex()
+	syncer := search.NewSyncer(cdb, ix, zaplog.NewZapLogger(zaplog.DEBUG, "sys-core-test", true, ""), search.Source{
+		Table: repoItemsTable,
+		Type:  "item",
+		Document: func(d document.Document) (search.Document, bool, error) {
+			var it repoItem
+			if err := document.StructScan(d, &it); err != nil {
+				return search.Document{}, false, err
+			}
+			archived := len(it.Tags) > 0 && it.Tags[0] == "archived"
+			return search.Document{ID: it.Code, Fields: []search.Field{{Name: "name", Text: it.Name}}}, !archived, nil
+		},
+	})
+	require.NoError(t, syncer.Start(ctx))
+	defer syncer.Close()
+	assert.Equal(t, 2, ix.Len())
+	assert.Equal(t, []string{"item-1"}, hitIDs(ix.Search(search.Query{Text: "blue"})))
+
+	found := func(text string, ids ...string) func() bool {
+		return func() bool {
+			return assert.ObjectsAreEqual(append([]string{}, ids...), hitIDs(ix.Search(search.Query{Text: text})))
+		}
+	}
+	require.NoError(t, items.Insert(ctx, repoItem{Code: "item-4", Name: "green gadget"}))
+	assert.Eventually(t, found("gadget", "item-4"), 5*time.Second, 20*time.Millisecond)
+	require.NoError(t, items.Update(ctx, repoItem{Code: "item-2", Name: "red gizmo"}))
+	assert.Eventually(t, found("gizmo", "item-2"), 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, []string{"item-1"}, hitIDs(ix.Search(search.Query{Text: "widget"})))
+	require.NoError(t, items.Update(ctx, repoItem{Code: "item-1", Name: "blue widget", Tags: []string{"archived"}}))
+	assert.Eventually(t, found("widget"), 5*time.Second, 20*time.Millisecond)
+	require.NoError(t, items.DeleteByKey(ctx, "item-4"))
+	assert.Eventually(t, found("gadget"), 5*time.Second, 20*time.Millisecond)
+
+	// the index keeps its documents once closed, without following the changes
+	syncer.Close()
+	require.NoError(t, items.Insert(ctx, repoItem{Code: "item-5", Name: "yellow gizmo"}))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, []string{"item-2"}, hitIDs(ix.Search(search.Query{Text: "gizmo"})))
+}
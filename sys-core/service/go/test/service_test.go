@@ -60,7 +60,7 @@ func testCoreDBService(t *testing.T) {
 	sysCoreSvc, err = coresvc.NewCoreDB(logger, &sysCoreCfg.SysCoreConfig, nil)
 	assert.NoError(t, err)
 
-	t.Logf("sys-core-svc: %v", *sysCoreSvc)
+	t.Logf("sys-core-svc: %v", sysCoreSvc)
 }
 
 func testTableCreation(t *testing.T) {
@@ -0,0 +1,48 @@
+package db_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	sharedConfig "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+)
+
+func testStatsAndGC(t *testing.T) {
+	dir, err := os.MkdirTemp("", "coredb-stats")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cdb, all := newBackupTestDB(t, filepath.Join(dir, "db"), filepath.Join(dir, "backups"), coresvc.Options{})
+	for i := 0; i < 3; i++ {
+		require.NoError(t, cdb.Exec("INSERT INTO "+tableName+"(id, foreign_id, blah) VALUES(?, ?, ?)", sharedConfig.NewID(), sharedConfig.NewID(), "blah"))
+	}
+	_, err = all.Backup(context.Background(), &emptypb.Empty{})
+	require.NoError(t, err)
+
+	health, err := all.Health(context.Background(), nil)
+	require.NoError(t, err)
+	assert.True(t, health.Healthy)
+
+	gc, err := all.GC(context.Background(), &coresvc.GCRequest{DbName: "backup_test.db", Flatten: true})
+	require.NoError(t, err)
+	require.Len(t, gc.Results, 1)
+
+	stats, err := all.Stats(context.Background(), &coresvc.BackupRequest{DbName: "backup_test.db"})
+	require.NoError(t, err)
+	require.Len(t, stats.Results, 1)
+	s := stats.Results[0]
+	assert.Greater(t, s.DiskSize, int64(0))
+	require.Len(t, s.Tables, 1)
+	assert.Equal(t, tableName, s.Tables[0].Table)
+	assert.EqualValues(t, 3, s.Tables[0].Keys)
+	require.NotNil(t, s.LastBackup)
+	require.Len(t, s.LastCron, 1)
+	assert.Empty(t, s.LastCron[0].Error)
+}
@@ -0,0 +1,72 @@
+package db_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+)
+
+func testTestDB(t *testing.T) {
+	ctx := context.Background()
+	cdb := newRepoItemsDB(t)
+	other := newRepoItemsDB(t)
+	items, err := coresvc.NewRepository[repoItem](cdb, repoItemsTable, coresvc.RepositoryOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, cdb.LoadFixtures(ctx, "./testdata/fixtures"))
+	count, err := items.Count(ctx, nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, count)
+	first, err := items.GetByKey(ctx, "fixture-1")
+	require.NoError(t, err)
+	assert.Equal(t, repoItem{Code: "fixture-1", Name: "first fixture", Tags: []string{"a", "b"}, CreatedAt: 1}, first)
+	sd, err := cdb.QueryOne("SELECT blah FROM some_datas WHERE id = ?", "1yX6cP5bQwJ8sBnk0sE6Z7Z8aTh")
+	require.NoError(t, err)
+	var got SomeData
+	require.NoError(t, sd.StructScan(&got))
+	assert.Equal(t, "second", got.Blah)
+
+	// the databases of the tests are apart from each other
+	otherItems, err := coresvc.NewRepository[repoItem](other, repoItemsTable, coresvc.RepositoryOptions{})
+	require.NoError(t, err)
+	count, err = otherItems.Count(ctx, nil)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	// the rows are back as they were once reset
+	snap, err := cdb.Snapshot(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, snap.Rows(repoItemsTable))
+	assert.Equal(t, 2, snap.Rows(tableName))
+	require.NoError(t, items.DeleteByKey(ctx, "fixture-1"))
+	require.NoError(t, cdb.InsertFixture(ctx, repoItemsTable, map[string]interface{}{"code": "fixture-4", "name": "fourth fixture"}))
+	require.NoError(t, cdb.Reset(ctx, snap))
+	again, err := items.GetByKey(ctx, "fixture-1")
+	require.NoError(t, err)
+	assert.Equal(t, "first fixture", again.Name)
+	_, err = items.GetByKey(ctx, "fixture-4")
+	assert.Error(t, err)
+	count, err = items.Count(ctx, nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, count)
+
+	require.NoError(t, cdb.Reset(ctx, nil))
+	count, err = items.Count(ctx, nil)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	// fixtures of unknown tables or columns are refused
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "unknown.yml"), []byte("- id: 1\n"), 0644))
+	assert.Error(t, cdb.LoadFixtures(ctx, filepath.Join(dir, "unknown.yml")))
+	assert.Error(t, cdb.InsertFixture(ctx, repoItemsTable, map[string]interface{}{"code": "x", "color": "red"}))
+	assert.Error(t, cdb.InsertFixture(ctx, repoItemsTable, "not a row"))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "repo_items.yml"), []byte("code: not a list\n"), 0644))
+	assert.Error(t, cdb.LoadFixtures(ctx, dir))
+}
@@ -0,0 +1,91 @@
+package db_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/genjidb/genji/document"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	sharedConfig "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+)
+
+const ttlSessionsTable = "ttl_sessions"
+
+type ttlSession struct {
+	ID             string `genji:"id" coredb:"primary"`
+	Token          string `genji:"token"`
+	TokenExpiresAt int64  `genji:"token_expires_at" coredb:"expires,clears=token"`
+	ExpiresAt      int64  `genji:"expires_at" coredb:"expires"`
+	CreatedAt      int64  `genji:"created_at"`
+}
+
+func (s ttlSession) CreateSQL() []string {
+	return coresvc.NewTable(ttlSessionsTable, coresvc.GetStructTags(s), nil).CreateTable()
+}
+
+type badExpiry struct {
+	ID        string `genji:"id" coredb:"primary"`
+	ExpiresAt string `genji:"expires_at" coredb:"expires"`
+}
+
+func (b badExpiry) CreateSQL() []string { return nil }
+
+func testTTL(t *testing.T) {
+	dir, err := os.MkdirTemp("", "coredb-ttl")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cdb, _ := newBackupTestDB(t, filepath.Join(dir, "db"), filepath.Join(dir, "backups"), coresvc.Options{
+		TTL: coresvc.TTLOptions{Disabled: true},
+	})
+	assert.Error(t, cdb.RegisterModels(map[string]coresvc.DbModel{"bad": badExpiry{}}))
+	require.NoError(t, cdb.RegisterModels(map[string]coresvc.DbModel{ttlSessionsTable: ttlSession{}}))
+	require.NoError(t, cdb.MakeSchema())
+
+	ctx := context.Background()
+	now := sharedConfig.CurrentTimestamp()
+	sessions, err := coresvc.NewRepository[ttlSession](cdb, ttlSessionsTable, coresvc.RepositoryOptions{})
+	require.NoError(t, err)
+	for _, s := range []ttlSession{
+		{ID: "expired", Token: "a", ExpiresAt: now - 10, CreatedAt: 1},
+		{ID: "live", Token: "b", TokenExpiresAt: now - 10, ExpiresAt: now + 3600, CreatedAt: 2},
+		{ID: "forever", Token: "c", TokenExpiresAt: now + 3600, CreatedAt: 3},
+	} {
+		require.NoError(t, sessions.Insert(ctx, s))
+	}
+
+	// expired rows are left out of reads before they are swept
+	_, err = sessions.GetByKey(ctx, "expired")
+	assert.Error(t, err)
+	count, err := sessions.Count(ctx, nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, count)
+	list, info, err := sessions.List(ctx, coresvc.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.EqualValues(t, 2, info.Total)
+
+	require.NoError(t, cdb.SweepExpired(ctx))
+	doc, err := cdb.QueryOne("SELECT COUNT(*) FROM " + ttlSessionsTable)
+	require.NoError(t, err)
+	var total int64
+	require.NoError(t, doc.Doc.Iterate(func(_ string, v document.Value) error {
+		total, _ = v.V.(int64)
+		return nil
+	}))
+	assert.EqualValues(t, 2, total)
+
+	live, err := sessions.GetByKey(ctx, "live")
+	require.NoError(t, err)
+	assert.Empty(t, live.Token)
+	assert.Zero(t, live.TokenExpiresAt)
+	assert.Equal(t, now+3600, live.ExpiresAt)
+	forever, err := sessions.GetByKey(ctx, "forever")
+	require.NoError(t, err)
+	assert.Equal(t, "c", forever.Token)
+}
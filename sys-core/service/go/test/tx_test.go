@@ -0,0 +1,60 @@
+package db_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	sharedConfig "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+)
+
+func testTransactions(t *testing.T) {
+	dir, err := os.MkdirTemp("", "coredb-tx")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cdb, _ := newBackupTestDB(t, filepath.Join(dir, "db"), filepath.Join(dir, "backups"), coresvc.Options{})
+	ctx := context.Background()
+	insert := "INSERT INTO " + tableName + "(id, foreign_id, blah) VALUES(?, ?, ?)"
+	update := "UPDATE " + tableName + " SET blah = ? WHERE id = ?"
+
+	// statements run in order, the same statement may run twice
+	id := sharedConfig.NewID()
+	require.NoError(t, cdb.ExecAll(ctx,
+		coresvc.Statement{Query: insert, Args: []interface{}{id, sharedConfig.NewID(), "first"}},
+		coresvc.Statement{Query: update, Args: []interface{}{"second", id}},
+		coresvc.Statement{Query: update, Args: []interface{}{"third", id}},
+	))
+	var sd SomeData
+	doc, err := cdb.QueryOne("SELECT id, foreign_id, blah FROM "+tableName+" WHERE id = ?", id)
+	require.NoError(t, err)
+	require.NoError(t, doc.StructScan(&sd))
+	assert.Equal(t, "third", sd.Blah)
+
+	// a failing callback rolls back every statement of the transaction
+	rolledBack := sharedConfig.NewID()
+	err = cdb.Update(ctx, func(tx *coresvc.Tx) error {
+		if err := tx.Exec(insert, rolledBack, sharedConfig.NewID(), "blah"); err != nil {
+			return err
+		}
+		// reads see the writes of the transaction
+		if _, err := tx.QueryOne("SELECT id FROM "+tableName+" WHERE id = ?", rolledBack); err != nil {
+			return err
+		}
+		return fmt.Errorf("abort")
+	})
+	assert.EqualError(t, err, "abort")
+	_, err = cdb.QueryOne("SELECT id FROM "+tableName+" WHERE id = ?", rolledBack)
+	assert.Error(t, err)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	err = cdb.View(canceled, func(tx *coresvc.Tx) error { return nil })
+	assert.ErrorIs(t, err, context.Canceled)
+}
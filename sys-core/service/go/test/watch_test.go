@@ -0,0 +1,90 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/genjidb/genji/document"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	sharedConfig "go.amplifyedge.org/sys-share-v2/sys-core/service/config"
+	coresvc "go.amplifyedge.org/sys-v2/sys-core/service/go/pkg/coredb"
+)
+
+func nextChange(t *testing.T, w *coresvc.Watcher) coresvc.ChangeEvent {
+	select {
+	case ev, ok := <-w.Events():
+		require.True(t, ok, "watcher closed")
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change event")
+	}
+	return coresvc.ChangeEvent{}
+}
+
+func docName(t *testing.T, d document.Document) string {
+	v, err := d.GetByField("name")
+	require.NoError(t, err)
+	return v.V.(string)
+}
+
+func testWatch(t *testing.T) {
+	cdb := newRepoItemsDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := cdb.Watch(ctx, coresvc.WatchOptions{Tables: []string{"unknown"}})
+	assert.Error(t, err)
+	w, err := cdb.Watch(ctx, coresvc.WatchOptions{Tables: []string{repoItemsTable}})
+	require.NoError(t, err)
+
+	items, err := coresvc.NewRepository[repoItem](cdb, repoItemsTable, coresvc.RepositoryOptions{})
+	require.NoError(t, err)
+	item := repoItem{Code: sharedConfig.NewID(), Name: "first", CreatedAt: 1}
+	require.NoError(t, items.Insert(ctx, item))
+	// other tables and rolled back transactions are not seen
+	require.NoError(t, cdb.Exec("INSERT INTO "+tableName+"(id, foreign_id, blah) VALUES(?, ?, ?)", sharedConfig.NewID(), sharedConfig.NewID(), "blah"))
+	assert.Error(t, cdb.Update(ctx, func(tx *coresvc.Tx) error {
+		if err := items.WithTx(tx).Insert(ctx, repoItem{Code: sharedConfig.NewID(), Name: "rolled back"}); err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	}))
+	item.Name = "updated"
+	require.NoError(t, items.Update(ctx, item))
+	require.NoError(t, items.DeleteByKey(ctx, item.Code))
+
+	ev := nextChange(t, w)
+	assert.Equal(t, coresvc.ChangeInsert, ev.Op)
+	assert.Equal(t, repoItemsTable, ev.Table)
+	assert.Equal(t, "first", docName(t, ev.Doc))
+	assert.Nil(t, ev.Old)
+	assert.NotZero(t, ev.CommittedAt)
+	ev = nextChange(t, w)
+	assert.Equal(t, coresvc.ChangeUpdate, ev.Op)
+	assert.Equal(t, "updated", docName(t, ev.Doc))
+	assert.Equal(t, "first", docName(t, ev.Old))
+	ev = nextChange(t, w)
+	assert.Equal(t, coresvc.ChangeDelete, ev.Op)
+	assert.Nil(t, ev.Doc)
+	assert.Equal(t, "updated", docName(t, ev.Old))
+
+	// a reader falling behind is closed with an overflow
+	slow, err := cdb.Watch(ctx, coresvc.WatchOptions{Buffer: 1})
+	require.NoError(t, err)
+	for _, name := range []string{"one", "two"} {
+		require.NoError(t, items.Insert(ctx, repoItem{Code: sharedConfig.NewID(), Name: name}))
+	}
+	assert.Equal(t, "one", docName(t, nextChange(t, slow).Doc))
+	_, ok := <-slow.Events()
+	assert.False(t, ok)
+	assert.True(t, coresvc.IsWatchOverflow(slow.Err()))
+
+	cancel()
+	for range w.Events() {
+	}
+	assert.NoError(t, w.Err())
+}